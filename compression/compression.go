@@ -0,0 +1,122 @@
+// This package opens files that may be compressed, choosing the codec from
+// the file extension: .gz for gzip and .zst for Zstandard. Everything is
+// streamed, so memory use does not grow with the file. Gzip uses the
+// standard library; Zstandard is implemented in this package.
+
+package compression
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	Gzip = ".gz"
+	Zstd = ".zst"
+)
+
+// Extension returns the compression extension of filename, "" if it is not
+// compressed.
+func Extension(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case Gzip:
+		return Gzip
+	case Zstd:
+		return Zstd
+	}
+	return ""
+}
+
+// Strip returns filename without its compression extension, so that the
+// extension of the content, such as .csv, can be read from it.
+func Strip(filename string) string {
+	return strings.TrimSuffix(filename, filename[len(filename)-len(Extension(filename)):])
+}
+
+// Open opens filename for reading, decompressing it if needed.
+func Open(filename string) (io.ReadCloser, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	switch Extension(filename) {
+	case Gzip:
+		reader, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		return &gzipReader{Reader: reader, file: file}, nil
+	case Zstd:
+		return &zstdReader{zstdDecoder: newZstdDecoder(file), file: file}, nil
+	}
+	return file, nil
+}
+
+// Create creates filename for writing, compressing what is written if
+// needed. Close must be called to finish the stream.
+func Create(filename string) (io.WriteCloser, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	switch Extension(filename) {
+	case Gzip:
+		return &gzipWriter{Writer: gzip.NewWriter(file), file: file}, nil
+	case Zstd:
+		return &zstdWriter{zstdEncoder: newZstdEncoder(file), file: file}, nil
+	}
+	return file, nil
+}
+
+type gzipReader struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (reader *gzipReader) Close() error {
+	err := reader.Reader.Close()
+	if closeErr := reader.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+type gzipWriter struct {
+	*gzip.Writer
+	file *os.File
+}
+
+func (writer *gzipWriter) Close() error {
+	err := writer.Writer.Close()
+	if closeErr := writer.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+type zstdReader struct {
+	*zstdDecoder
+	file *os.File
+}
+
+func (reader *zstdReader) Close() error {
+	return reader.file.Close()
+}
+
+type zstdWriter struct {
+	*zstdEncoder
+	file *os.File
+}
+
+func (writer *zstdWriter) Close() error {
+	err := writer.zstdEncoder.Close()
+	if closeErr := writer.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
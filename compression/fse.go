@@ -0,0 +1,241 @@
+package compression
+
+import "math/bits"
+
+// An FSE (finite state entropy) table decodes one symbol per state and
+// moves to the next state with a few bits from the stream. It is built from
+// a normalized distribution: counts that add up to 1<<log, where -1 stands
+// for a probability below one count.
+
+type fseEntry struct {
+	symbol uint8
+	bits   uint8  // Bits read to find the next state
+	base   uint16 // Next state before those bits are added
+}
+
+type fseTable struct {
+	log     uint8
+	entries []fseEntry
+}
+
+// readDistribution reads a normalized distribution from the start of data
+// and returns it with the number of bytes it took.
+func readDistribution(data []byte, maxSymbol int, maxLog uint8) ([]int16, uint8, int, error) {
+	in := &forwardBits{data: data}
+	log := uint8(in.read(4)) + 5
+	if log > maxLog {
+		return nil, 0, 0, errCorrupt
+	}
+
+	var counts []int16
+	remaining := 1<<log + 1
+	threshold := 1 << log
+	width := int(log) + 1
+	previousZero := false
+	for remaining > 1 {
+		if previousZero {
+			// Runs of zero counts are given as 2-bit repeat counts
+			for {
+				repeat := in.read(2)
+				for i := uint32(0); i < repeat; i++ {
+					counts = append(counts, 0)
+				}
+				if repeat != 3 {
+					break
+				}
+			}
+		}
+		if len(counts) > maxSymbol {
+			return nil, 0, 0, errCorrupt
+		}
+
+		// Small values take one bit less than large ones
+		largest := 2*threshold - 1 - remaining
+		count := int(in.read(width - 1))
+		if count >= largest {
+			count += int(in.read(1)) << (width - 1)
+			if count >= threshold {
+				count -= largest
+			}
+		}
+		count--
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+		if remaining < 1 {
+			return nil, 0, 0, errCorrupt
+		}
+		counts = append(counts, int16(count))
+		previousZero = count == 0
+		for remaining < threshold {
+			width--
+			threshold >>= 1
+		}
+	}
+
+	size := (in.pos + 7) / 8
+	if remaining != 1 || size > len(data) {
+		return nil, 0, 0, errCorrupt
+	}
+	return counts, log, size, nil
+}
+
+// spread places each symbol at as many positions of the table as its
+// count, the symbols below one count at the end.
+func spread(counts []int16, log uint8) ([]uint8, error) {
+	size := 1 << log
+	symbols := make([]uint8, size)
+	high := size - 1
+	for symbol, count := range counts {
+		if count == -1 {
+			symbols[high] = uint8(symbol)
+			high--
+		}
+	}
+
+	step := size>>1 + size>>3 + 3
+	position := 0
+	for symbol, count := range counts {
+		for i := 0; i < int(count); i++ {
+			symbols[position] = uint8(symbol)
+			position = (position + step) & (size - 1)
+			for position > high {
+				position = (position + step) & (size - 1)
+			}
+		}
+	}
+	if position != 0 {
+		return nil, errCorrupt
+	}
+	return symbols, nil
+}
+
+func newFSETable(counts []int16, log uint8) (*fseTable, error) {
+	symbols, err := spread(counts, log)
+	if err != nil {
+		return nil, err
+	}
+
+	next := make([]uint16, len(counts))
+	for symbol, count := range counts {
+		if count == -1 {
+			next[symbol] = 1
+		} else {
+			next[symbol] = uint16(count)
+		}
+	}
+
+	table := &fseTable{log: log, entries: make([]fseEntry, len(symbols))}
+	for i, symbol := range symbols {
+		state := next[symbol]
+		next[symbol]++
+		width := log + 1 - uint8(bits.Len16(state))
+		table.entries[i] = fseEntry{symbol: symbol, bits: width, base: state<<width - uint16(len(symbols))}
+	}
+	return table, nil
+}
+
+// rleTable always decodes symbol, without reading any bits.
+func rleTable(symbol uint8) *fseTable {
+	return &fseTable{entries: []fseEntry{{symbol: symbol}}}
+}
+
+// fseState is a decoder's position in a table.
+type fseState struct {
+	table *fseTable
+	state uint16
+}
+
+func (state *fseState) init(in *reverseBits) {
+	state.state = uint16(in.read(state.table.log))
+}
+
+func (state *fseState) symbol() uint8 {
+	return state.table.entries[state.state].symbol
+}
+
+func (state *fseState) update(in *reverseBits) {
+	entry := state.table.entries[state.state]
+	state.state = entry.base + uint16(in.read(entry.bits))
+}
+
+// fseEncoder is the table an encoder walks backwards through, so that the
+// decoder's walk gives the symbols in order.
+type fseEncoder struct {
+	log       uint8
+	states    []uint16
+	transform []fseTransform
+}
+
+// fseTransform takes a state to the number of bits to write for a symbol
+// and to the symbol's states.
+type fseTransform struct {
+	deltaBits  int // Bits to write, in the high 16 bits, less the state's offset
+	deltaState int
+}
+
+func newFSEEncoder(counts []int16, log uint8) (*fseEncoder, error) {
+	symbols, err := spread(counts, log)
+	if err != nil {
+		return nil, err
+	}
+	size := 1 << log
+
+	// The states of each symbol, in the order the decoder numbers them
+	start := make([]int, len(counts)+1)
+	for symbol, count := range counts {
+		if count == -1 {
+			count = 1
+		}
+		start[symbol+1] = start[symbol] + int(count)
+	}
+	encoder := &fseEncoder{log: log, states: make([]uint16, size)}
+	for i, symbol := range symbols {
+		encoder.states[start[symbol]] = uint16(size + i)
+		start[symbol]++
+	}
+
+	encoder.transform = make([]fseTransform, len(counts))
+	total := 0
+	for symbol, count := range counts {
+		transform := &encoder.transform[symbol]
+		switch count {
+		case 0:
+			transform.deltaBits = (int(log)+1)<<16 - size
+		case -1, 1:
+			transform.deltaBits = int(log)<<16 - size
+			transform.deltaState = total - 1
+			total++
+		default:
+			width := int(log) - (bits.Len(uint(count-1)) - 1)
+			transform.deltaBits = width<<16 - int(count)<<width
+			transform.deltaState = total - int(count)
+			total += int(count)
+		}
+	}
+	return encoder, nil
+}
+
+// start returns the state the encoder begins in to write symbol last.
+func (encoder *fseEncoder) start(symbol uint8) int {
+	transform := encoder.transform[symbol]
+	width := (transform.deltaBits + 1<<15) >> 16
+	value := width<<16 - transform.deltaBits
+	return int(encoder.states[value>>width+transform.deltaState])
+}
+
+// encode writes the bits that lead from symbol's state to state, and
+// returns symbol's state.
+func (encoder *fseEncoder) encode(out *bitWriter, state int, symbol uint8) int {
+	transform := encoder.transform[symbol]
+	width := (state + transform.deltaBits) >> 16
+	out.add(uint64(state), uint(width))
+	return int(encoder.states[state>>width+transform.deltaState])
+}
+
+// flush writes the state the decoder starts from.
+func (encoder *fseEncoder) flush(out *bitWriter, state int) {
+	out.add(uint64(state), uint(encoder.log))
+}
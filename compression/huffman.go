@@ -0,0 +1,307 @@
+package compression
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"sort"
+)
+
+// Literals are Huffman coded. A table is described by a weight per symbol:
+// a symbol of weight w > 0 has a code of maxBits+1-w bits, and the weights
+// are chosen so that the codes fill the code space exactly.
+
+type huffmanEntry struct {
+	symbol uint8
+	bits   uint8
+}
+
+// huffmanTable decodes the symbol that starts the next maxBits bits.
+type huffmanTable struct {
+	maxBits uint8
+	entries []huffmanEntry
+}
+
+// readHuffmanTable reads a table description from the start of data and
+// returns the table with the number of bytes the description took.
+func readHuffmanTable(data []byte) (*huffmanTable, int, error) {
+	if len(data) == 0 {
+		return nil, 0, errCorrupt
+	}
+	var weights []uint8
+	size := 1
+	if header := int(data[0]); header < 128 {
+		// FSE-compressed weights, in header bytes
+		size += header
+		if size > len(data) {
+			return nil, 0, errCorrupt
+		}
+		var err error
+		if weights, err = readCompressedWeights(data[1:size]); err != nil {
+			return nil, 0, err
+		}
+	} else {
+		// 4-bit weights, two to a byte
+		count := header - 127
+		size += (count + 1) / 2
+		if size > len(data) {
+			return nil, 0, errCorrupt
+		}
+		weights = make([]uint8, count)
+		for i := range weights {
+			weights[i] = data[1+i/2] >> (4 * (1 - i%2)) & 15
+		}
+	}
+
+	// The weight of the last symbol completes the code space
+	total := 0
+	for _, weight := range weights {
+		if weight > maxHuffmanBits {
+			return nil, 0, errCorrupt
+		}
+		if weight > 0 {
+			total += 1 << (weight - 1)
+		}
+	}
+	if total == 0 {
+		return nil, 0, errCorrupt
+	}
+	maxBits := bits.Len(uint(total))
+	rest := 1<<maxBits - total
+	if maxBits > maxHuffmanBits || rest&(rest-1) != 0 || len(weights) > 255 {
+		return nil, 0, errCorrupt
+	}
+	weights = append(weights, uint8(bits.Len(uint(rest))))
+
+	table := &huffmanTable{maxBits: uint8(maxBits), entries: make([]huffmanEntry, 1<<maxBits)}
+	for symbol, code := range huffmanCodes(weights, maxBits) {
+		if weights[symbol] == 0 {
+			continue
+		}
+		length := 1 << (weights[symbol] - 1)
+		first := int(code) << (weights[symbol] - 1)
+		for i := first; i < first+length; i++ {
+			table.entries[i] = huffmanEntry{symbol: uint8(symbol), bits: uint8(maxBits + 1 - int(weights[symbol]))}
+		}
+	}
+	return table, size, nil
+}
+
+// readCompressedWeights decodes weights written with an FSE table and two
+// interleaved states.
+func readCompressedWeights(data []byte) ([]uint8, error) {
+	counts, log, size, err := readDistribution(data, 255, 6)
+	if err != nil {
+		return nil, err
+	}
+	table, err := newFSETable(counts, log)
+	if err != nil {
+		return nil, err
+	}
+	in, err := newReverseBits(data[size:])
+	if err != nil {
+		return nil, err
+	}
+
+	states := [2]fseState{{table: table}, {table: table}}
+	states[0].init(in)
+	states[1].init(in)
+	var weights []uint8
+	for i := 0; ; i = 1 - i {
+		if len(weights) >= 255 {
+			return nil, errCorrupt
+		}
+		weights = append(weights, states[i].symbol())
+		states[i].update(in)
+		if in.left < 0 {
+			// The other state holds the last weight
+			return append(weights, states[1-i].symbol()), nil
+		}
+	}
+}
+
+// huffmanCodes returns the code of each symbol. Codes are handed out from
+// the longest to the shortest, in symbol order for equal lengths.
+func huffmanCodes(weights []uint8, maxBits int) []uint16 {
+	next := make([]int, maxBits+2)
+	position := 0
+	for weight := 1; weight <= maxBits+1; weight++ {
+		next[weight] = position
+		for _, w := range weights {
+			if int(w) == weight {
+				position += 1 << (weight - 1)
+			}
+		}
+	}
+	codes := make([]uint16, len(weights))
+	for symbol, weight := range weights {
+		if weight > 0 {
+			codes[symbol] = uint16(next[weight] >> (weight - 1))
+			next[weight] += 1 << (weight - 1)
+		}
+	}
+	return codes
+}
+
+// decode fills out from one Huffman stream, which must be used up exactly.
+func (table *huffmanTable) decode(data []byte, out []byte) error {
+	in, err := newReverseBits(data)
+	if err != nil {
+		return err
+	}
+	for i := range out {
+		entry := table.entries[in.peek(table.maxBits)]
+		out[i] = entry.symbol
+		in.left -= int(entry.bits)
+	}
+	if in.left != 0 {
+		return errCorrupt
+	}
+	return nil
+}
+
+// decodeStreams fills out from the four streams of data, which start with
+// the sizes of the first three.
+func (table *huffmanTable) decodeStreams(data []byte, out []byte) error {
+	segment := (len(out) + 3) / 4
+	if len(data) < 6 || 3*segment > len(out) {
+		return errCorrupt
+	}
+	start := 6
+	for i := 0; i < 4; i++ {
+		end := len(data)
+		if i < 3 {
+			end = start + int(binary.LittleEndian.Uint16(data[2*i:]))
+		}
+		if end > len(data) || start > end {
+			return errCorrupt
+		}
+		last := segment * (i + 1)
+		if i == 3 {
+			last = len(out)
+		}
+		if err := table.decode(data[start:end], out[segment*i:last]); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// huffmanEncoder holds the code of each byte value.
+type huffmanEncoder struct {
+	weights []uint8 // Up to the last symbol in use, which the description leaves out
+	codes   []uint16
+	lengths []uint8
+}
+
+// newHuffmanEncoder builds codes of at most maxHuffmanBits bits for the
+// byte counts, which must have at least two symbols in use. Long codes are
+// shortened by flattening the counts until they fit.
+func newHuffmanEncoder(counts *[256]int) *huffmanEncoder {
+	var symbols []int
+	last := 0
+	for symbol, count := range counts {
+		if count > 0 {
+			symbols = append(symbols, symbol)
+			last = symbol
+		}
+	}
+
+	scaled := make([]int, len(symbols))
+	for i, symbol := range symbols {
+		scaled[i] = counts[symbol]
+	}
+	lengths := huffmanLengths(scaled)
+	for maxLength(lengths) > maxHuffmanBits {
+		for i := range scaled {
+			scaled[i] = (scaled[i] + 1) / 2
+		}
+		lengths = huffmanLengths(scaled)
+	}
+
+	maxBits := maxLength(lengths)
+	encoder := &huffmanEncoder{weights: make([]uint8, last+1), lengths: make([]uint8, last+1)}
+	for i, symbol := range symbols {
+		encoder.weights[symbol] = uint8(maxBits + 1 - lengths[i])
+		encoder.lengths[symbol] = uint8(lengths[i])
+	}
+	encoder.codes = huffmanCodes(encoder.weights, maxBits)
+	return encoder
+}
+
+// huffmanLengths returns the Huffman code length of each count.
+func huffmanLengths(counts []int) []int {
+	n := len(counts)
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return counts[order[a]] < counts[order[b]] })
+
+	// Leaves in increasing order, then the merged nodes, which are created
+	// in increasing order too
+	weight := make([]int, 2*n-1)
+	parent := make([]int, 2*n-1)
+	for i, leaf := range order {
+		weight[i] = counts[leaf]
+	}
+	leaf, merged := 0, n
+	smallest := func(next int) int {
+		if leaf < n && (merged >= next || weight[leaf] <= weight[merged]) {
+			leaf++
+			return leaf - 1
+		}
+		merged++
+		return merged - 1
+	}
+	for next := n; next < 2*n-1; next++ {
+		a := smallest(next)
+		b := smallest(next)
+		weight[next] = weight[a] + weight[b]
+		parent[a], parent[b] = next, next
+	}
+
+	depth := make([]int, 2*n-1)
+	lengths := make([]int, n)
+	for i := 2*n - 3; i >= 0; i-- {
+		depth[i] = depth[parent[i]] + 1
+		if i < n {
+			lengths[order[i]] = depth[i]
+		}
+	}
+	return lengths
+}
+
+func maxLength(lengths []int) int {
+	longest := 0
+	for _, length := range lengths {
+		if length > longest {
+			longest = length
+		}
+	}
+	return longest
+}
+
+// description returns the table description with 4-bit weights, or false
+// if there are too many symbols for that form.
+func (encoder *huffmanEncoder) description() ([]byte, bool) {
+	count := len(encoder.weights) - 1
+	if count > 128 {
+		return nil, false
+	}
+	description := make([]byte, 1+(count+1)/2)
+	description[0] = byte(127 + count)
+	for i, weight := range encoder.weights[:count] {
+		description[1+i/2] |= weight << (4 * (1 - i%2))
+	}
+	return description, true
+}
+
+// encode writes data as one stream, backwards so that it is read forwards.
+func (encoder *huffmanEncoder) encode(data []byte) []byte {
+	out := &bitWriter{out: make([]byte, 0, len(data)/2+8)}
+	for i := len(data) - 1; i >= 0; i-- {
+		out.add(uint64(encoder.codes[data[i]]), uint(encoder.lengths[data[i]]))
+	}
+	return out.close()
+}
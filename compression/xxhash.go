@@ -0,0 +1,95 @@
+package compression
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// xxhash64 is the 64-bit xxHash with seed 0, whose low 32 bits are a
+// Zstandard frame's content checksum.
+type xxhash64 struct {
+	state    [4]uint64
+	buffer   [32]byte
+	buffered int
+	total    uint64
+}
+
+const (
+	prime64a = 11400714785074694791
+	prime64b = 14029467366897019727
+	prime64c = 1609587929392839161
+	prime64d = 9650029242287828579
+	prime64e = 2870177450012600261
+)
+
+func newXXHash64() *xxhash64 {
+	a, b := uint64(prime64a), uint64(prime64b)
+	return &xxhash64{state: [4]uint64{a + b, b, 0, -a}}
+}
+
+func xxhashRound(accumulator uint64, input uint64) uint64 {
+	return bits.RotateLeft64(accumulator+input*prime64b, 31) * prime64a
+}
+
+func (hash *xxhash64) Write(data []byte) (int, error) {
+	n := len(data)
+	hash.total += uint64(n)
+	if hash.buffered > 0 {
+		copied := copy(hash.buffer[hash.buffered:], data)
+		hash.buffered += copied
+		data = data[copied:]
+		if hash.buffered < len(hash.buffer) {
+			return n, nil
+		}
+		hash.stripe(hash.buffer[:])
+		hash.buffered = 0
+	}
+	for ; len(data) >= 32; data = data[32:] {
+		hash.stripe(data)
+	}
+	hash.buffered = copy(hash.buffer[:], data)
+	return n, nil
+}
+
+func (hash *xxhash64) stripe(data []byte) {
+	for i := range hash.state {
+		hash.state[i] = xxhashRound(hash.state[i], binary.LittleEndian.Uint64(data[8*i:]))
+	}
+}
+
+func (hash *xxhash64) Sum64() uint64 {
+	var sum uint64
+	if hash.total >= 32 {
+		state := hash.state
+		sum = bits.RotateLeft64(state[0], 1) + bits.RotateLeft64(state[1], 7) +
+			bits.RotateLeft64(state[2], 12) + bits.RotateLeft64(state[3], 18)
+		for _, value := range state {
+			sum = (sum^xxhashRound(0, value))*prime64a + prime64d
+		}
+	} else {
+		sum = prime64e
+	}
+	sum += hash.total
+
+	rest := hash.buffer[:hash.buffered]
+	for ; len(rest) >= 8; rest = rest[8:] {
+		sum ^= xxhashRound(0, binary.LittleEndian.Uint64(rest))
+		sum = bits.RotateLeft64(sum, 27)*prime64a + prime64d
+	}
+	if len(rest) >= 4 {
+		sum ^= uint64(binary.LittleEndian.Uint32(rest)) * prime64a
+		sum = bits.RotateLeft64(sum, 23)*prime64b + prime64c
+		rest = rest[4:]
+	}
+	for _, b := range rest {
+		sum ^= uint64(b) * prime64e
+		sum = bits.RotateLeft64(sum, 11) * prime64a
+	}
+
+	sum ^= sum >> 33
+	sum *= prime64b
+	sum ^= sum >> 29
+	sum *= prime64c
+	sum ^= sum >> 32
+	return sum
+}
@@ -0,0 +1,203 @@
+package compression
+
+// Zstandard (RFC 8878) is implemented here, like the rest of the repository,
+// with the standard library only. The reader decodes any frame that does not
+// need a dictionary. The writer uses greedy matching, Huffman-coded literals
+// and the predefined sequence codes, which gives up some ratio for a small
+// encoder; the frames it writes can be read by any Zstandard decoder.
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"sort"
+)
+
+const (
+	zstdMagic      = 0xFD2FB528
+	skippableMagic = 0x184D2A50 // The low 4 bits are free
+	maxBlockSize   = 1 << 17
+	maxWindowSize  = 1 << 27 // Largest window the reader accepts, the reference decoder's default
+	maxHuffmanBits = 11
+)
+
+// Block types
+const (
+	blockRaw = iota
+	blockRLE
+	blockCompressed
+	blockReserved
+)
+
+// Literals section types
+const (
+	literalsRaw = iota
+	literalsRLE
+	literalsCompressed
+	literalsTreeless
+)
+
+// Compression modes of the sequence codes
+const (
+	modePredefined = iota
+	modeRLE
+	modeFSE
+	modeRepeat
+)
+
+var errCorrupt = errors.New("zstd: corrupt stream")
+
+// lengthCode is the value a literal or match length code stands for: its
+// baseline plus the given number of extra bits read after it.
+type lengthCode struct {
+	baseline uint32
+	bits     uint8
+}
+
+var literalLengthCodes = []lengthCode{
+	{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}, {5, 0}, {6, 0}, {7, 0},
+	{8, 0}, {9, 0}, {10, 0}, {11, 0}, {12, 0}, {13, 0}, {14, 0}, {15, 0},
+	{16, 1}, {18, 1}, {20, 1}, {22, 1}, {24, 2}, {28, 2}, {32, 3}, {40, 3},
+	{48, 4}, {64, 6}, {128, 7}, {256, 8}, {512, 9}, {1024, 10}, {2048, 11}, {4096, 12},
+	{8192, 13}, {16384, 14}, {32768, 15}, {65536, 16},
+}
+
+var matchLengthCodes = []lengthCode{
+	{3, 0}, {4, 0}, {5, 0}, {6, 0}, {7, 0}, {8, 0}, {9, 0}, {10, 0},
+	{11, 0}, {12, 0}, {13, 0}, {14, 0}, {15, 0}, {16, 0}, {17, 0}, {18, 0},
+	{19, 0}, {20, 0}, {21, 0}, {22, 0}, {23, 0}, {24, 0}, {25, 0}, {26, 0},
+	{27, 0}, {28, 0}, {29, 0}, {30, 0}, {31, 0}, {32, 0}, {33, 0}, {34, 0},
+	{35, 1}, {37, 1}, {39, 1}, {41, 1}, {43, 2}, {47, 2}, {51, 3}, {59, 3},
+	{67, 4}, {83, 4}, {99, 5}, {131, 7}, {259, 8}, {515, 9}, {1027, 10}, {2051, 11},
+	{4099, 12}, {8195, 13}, {16387, 14}, {32771, 15}, {65539, 16},
+}
+
+// lengthCodeOf returns the code whose range holds value.
+func lengthCodeOf(codes []lengthCode, value uint32) uint8 {
+	return uint8(sort.Search(len(codes), func(i int) bool { return codes[i].baseline > value }) - 1)
+}
+
+// The three kinds of sequence code, in the order their tables are given
+const (
+	literalLengths = iota
+	offsets
+	matchLengths
+)
+
+// sequenceCodes describes each kind of sequence code: its largest symbol,
+// the largest accuracy a table for it may have, and its predefined
+// distribution.
+var sequenceCodes = [3]struct {
+	maxSymbol  int
+	maxLog     uint8
+	log        uint8
+	predefined []int16
+}{
+	literalLengths: {35, 9, 6, []int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}},
+	offsets: {31, 8, 5, []int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}},
+	matchLengths: {52, 9, 6, []int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}},
+}
+
+// forwardBits reads a bit stream from its first byte on, low bits first, as
+// the FSE table descriptions are written.
+type forwardBits struct {
+	data []byte
+	pos  int // In bits
+}
+
+// read returns the next n bits, n <= 24. Bits past the end read as zeros.
+func (in *forwardBits) read(n int) uint32 {
+	value := uint32(load64(in.data, in.pos>>3)>>(in.pos&7)) & (1<<n - 1)
+	in.pos += n
+	return value
+}
+
+// reverseBits reads a bit stream from its end back to its start, as the
+// Huffman and sequence streams are written. The last byte holds a marker
+// bit above the first bit of the stream.
+type reverseBits struct {
+	data []byte
+	left int // Bits not yet read, counted from the start of data
+}
+
+func newReverseBits(data []byte) (*reverseBits, error) {
+	if len(data) == 0 || data[len(data)-1] == 0 {
+		return nil, errCorrupt
+	}
+	return &reverseBits{data: data, left: 8*(len(data)-1) + bits.Len8(data[len(data)-1]) - 1}, nil
+}
+
+// peek returns the next n bits without consuming them, n <= 56, the first
+// bit to be read being the most significant. Bits before the start of the
+// stream read as zeros.
+func (in *reverseBits) peek(n uint8) uint64 {
+	start := in.left - int(n)
+	if start >= 0 {
+		return load64(in.data, start>>3) >> (start & 7) & (1<<n - 1)
+	}
+	if in.left <= 0 {
+		return 0
+	}
+	return load64(in.data, 0) & (1<<in.left - 1) << -start
+}
+
+func (in *reverseBits) read(n uint8) uint64 {
+	if n == 0 {
+		return 0
+	}
+	value := in.peek(n)
+	in.left -= int(n)
+	return value
+}
+
+// load64 reads the little-endian uint64 at data[i:], padded with zeros.
+func load64(data []byte, i int) uint64 {
+	if i+8 <= len(data) {
+		return binary.LittleEndian.Uint64(data[i:])
+	}
+	var value uint64
+	for j := len(data) - 1; j >= i; j-- {
+		value = value<<8 | uint64(data[j])
+	}
+	return value
+}
+
+// bitWriter writes a bit stream low bits first. Streams meant to be read
+// backwards are closed with a marker bit.
+type bitWriter struct {
+	out   []byte
+	value uint64
+	count uint
+}
+
+// add appends the low n bits of value, n <= 32.
+func (writer *bitWriter) add(value uint64, n uint) {
+	writer.value |= value & (1<<n - 1) << writer.count
+	writer.count += n
+	for writer.count >= 8 {
+		writer.out = append(writer.out, byte(writer.value))
+		writer.value >>= 8
+		writer.count -= 8
+	}
+}
+
+// close writes the marker bit and the last partial byte.
+func (writer *bitWriter) close() []byte {
+	writer.add(1, 1)
+	if writer.count > 0 {
+		writer.out = append(writer.out, byte(writer.value))
+	}
+	return writer.out
+}
@@ -0,0 +1,466 @@
+package compression
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// zstdDecoder streams the content of one or more Zstandard frames, one
+// block at a time.
+type zstdDecoder struct {
+	in  *bufio.Reader
+	err error // Sticky, io.EOF after the last frame
+
+	window     []byte // Decoded content that matches may refer to
+	returned   int    // Bytes of window already returned by Read
+	windowSize int
+
+	// State of the current frame
+	inFrame     bool
+	lastBlock   bool
+	checksum    bool
+	contentSize int64 // -1 if the frame does not give it
+	decoded     int64
+	hash        *xxhash64
+	huffman     *huffmanTable
+	tables      [3]*fseTable
+	repeats     [3]int
+
+	block    []byte
+	literals []byte
+}
+
+func newZstdDecoder(in io.Reader) *zstdDecoder {
+	return &zstdDecoder{in: bufio.NewReader(in)}
+}
+
+func (decoder *zstdDecoder) Read(data []byte) (int, error) {
+	for decoder.returned == len(decoder.window) {
+		if decoder.err != nil {
+			return 0, decoder.err
+		}
+		decoder.err = decoder.next()
+	}
+	n := copy(data, decoder.window[decoder.returned:])
+	decoder.returned += n
+	return n, nil
+}
+
+// next reads a frame header, a block or the end of a frame.
+func (decoder *zstdDecoder) next() error {
+	if !decoder.inFrame {
+		return decoder.readFrameHeader()
+	}
+	if decoder.lastBlock {
+		return decoder.endFrame()
+	}
+
+	// Keep only the window once it has all been returned
+	if excess := len(decoder.window) - decoder.windowSize; excess > decoder.windowSize+maxBlockSize {
+		decoder.window = append(decoder.window[:0], decoder.window[excess:]...)
+		decoder.returned = len(decoder.window)
+	}
+
+	var header [3]byte
+	if _, err := io.ReadFull(decoder.in, header[:]); err != nil {
+		return unexpected(err)
+	}
+	value := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	decoder.lastBlock = value&1 == 1
+	size := value >> 3
+	blockSize := maxBlockSize
+	if decoder.windowSize < blockSize {
+		blockSize = decoder.windowSize
+	}
+	if size > blockSize {
+		return errCorrupt
+	}
+
+	start := len(decoder.window)
+	switch value >> 1 & 3 {
+	case blockRaw:
+		decoder.window = append(decoder.window, make([]byte, size)...)
+		if _, err := io.ReadFull(decoder.in, decoder.window[start:]); err != nil {
+			return unexpected(err)
+		}
+	case blockRLE:
+		value, err := decoder.in.ReadByte()
+		if err != nil {
+			return unexpected(err)
+		}
+		for i := 0; i < size; i++ {
+			decoder.window = append(decoder.window, value)
+		}
+	case blockCompressed:
+		decoder.block = append(decoder.block[:0], make([]byte, size)...)
+		if _, err := io.ReadFull(decoder.in, decoder.block); err != nil {
+			return unexpected(err)
+		}
+		if err := decoder.decodeBlock(decoder.block); err != nil {
+			return err
+		}
+		if len(decoder.window)-start > blockSize {
+			return errCorrupt
+		}
+	default:
+		return errCorrupt
+	}
+	decoder.decoded += int64(len(decoder.window) - start)
+	decoder.hash.Write(decoder.window[start:])
+	return nil
+}
+
+func (decoder *zstdDecoder) readFrameHeader() error {
+	var magic [4]byte
+	if n, err := io.ReadFull(decoder.in, magic[:]); err != nil {
+		if n == 0 && err == io.EOF {
+			return io.EOF
+		}
+		return unexpected(err)
+	}
+	switch value := binary.LittleEndian.Uint32(magic[:]); {
+	case value&^15 == skippableMagic:
+		var size [4]byte
+		if _, err := io.ReadFull(decoder.in, size[:]); err != nil {
+			return unexpected(err)
+		}
+		_, err := io.CopyN(io.Discard, decoder.in, int64(binary.LittleEndian.Uint32(size[:])))
+		return unexpected(err)
+	case value != zstdMagic:
+		return errors.New("zstd: not a Zstandard stream")
+	}
+
+	descriptor, err := decoder.in.ReadByte()
+	if err != nil {
+		return unexpected(err)
+	}
+	singleSegment := descriptor&(1<<5) != 0
+	if descriptor&(1<<3) != 0 {
+		return errCorrupt
+	}
+	var windowDescriptor byte
+	if !singleSegment {
+		if windowDescriptor, err = decoder.in.ReadByte(); err != nil {
+			return unexpected(err)
+		}
+	}
+	dictionarySize := [4]int{0, 1, 2, 4}[descriptor&3]
+	contentSizeSize := [4]int{0, 2, 4, 8}[descriptor>>6]
+	if singleSegment && contentSizeSize == 0 {
+		contentSizeSize = 1
+	}
+	fields := make([]byte, dictionarySize+contentSizeSize)
+	if _, err := io.ReadFull(decoder.in, fields); err != nil {
+		return unexpected(err)
+	}
+	if load64(fields[:dictionarySize], 0) != 0 {
+		return errors.New("zstd: frames that need a dictionary are not supported")
+	}
+
+	decoder.contentSize = -1
+	if contentSizeSize > 0 {
+		decoder.contentSize = int64(load64(fields[dictionarySize:], 0))
+		if contentSizeSize == 2 {
+			decoder.contentSize += 256
+		}
+	}
+	if singleSegment {
+		decoder.windowSize = int(decoder.contentSize)
+		if decoder.contentSize > maxWindowSize {
+			return fmt.Errorf("zstd: window of %d bytes is too large", decoder.contentSize)
+		}
+	} else {
+		log := 10 + uint(windowDescriptor>>3)
+		if log > 27 {
+			return fmt.Errorf("zstd: window of 2^%d bytes is too large", log)
+		}
+		decoder.windowSize = 1<<log + 1<<log/8*int(windowDescriptor&7)
+	}
+
+	decoder.inFrame = true
+	decoder.lastBlock = false
+	decoder.checksum = descriptor&(1<<2) != 0
+	decoder.decoded = 0
+	decoder.hash = newXXHash64()
+	decoder.huffman = nil
+	decoder.tables = [3]*fseTable{}
+	decoder.repeats = [3]int{1, 4, 8}
+	decoder.window = decoder.window[:0]
+	decoder.returned = 0
+	return nil
+}
+
+func (decoder *zstdDecoder) endFrame() error {
+	decoder.inFrame = false
+	if decoder.contentSize >= 0 && decoder.decoded != decoder.contentSize {
+		return errCorrupt
+	}
+	if decoder.checksum {
+		var checksum [4]byte
+		if _, err := io.ReadFull(decoder.in, checksum[:]); err != nil {
+			return unexpected(err)
+		}
+		if binary.LittleEndian.Uint32(checksum[:]) != uint32(decoder.hash.Sum64()) {
+			return errors.New("zstd: checksum mismatch")
+		}
+	}
+	return nil
+}
+
+// decodeBlock appends the content of a compressed block to the window.
+func (decoder *zstdDecoder) decodeBlock(data []byte) error {
+	literals, size, err := decoder.decodeLiterals(data)
+	if err != nil {
+		return err
+	}
+	data = data[size:]
+
+	if len(data) == 0 {
+		return errCorrupt
+	}
+	count := int(data[0])
+	size = 1
+	switch {
+	case count == 0:
+		if len(data) != 1 {
+			return errCorrupt
+		}
+		decoder.window = append(decoder.window, literals...)
+		return nil
+	case count == 255:
+		if len(data) < 3 {
+			return errCorrupt
+		}
+		count = int(data[1]) + int(data[2])<<8 + 0x7F00
+		size = 3
+	case count >= 128:
+		if len(data) < 2 {
+			return errCorrupt
+		}
+		count = (count-128)<<8 + int(data[1])
+		size = 2
+	}
+	if size >= len(data) || data[size]&3 != 0 {
+		return errCorrupt
+	}
+	modes := data[size]
+	data = data[size+1:]
+	for kind := range decoder.tables {
+		mode := modes >> (6 - 2*kind) & 3
+		size, err := decoder.readSequenceTable(kind, int(mode), data)
+		if err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+
+	in, err := newReverseBits(data)
+	if err != nil {
+		return err
+	}
+	literalLength := fseState{table: decoder.tables[literalLengths]}
+	offset := fseState{table: decoder.tables[offsets]}
+	matchLength := fseState{table: decoder.tables[matchLengths]}
+	literalLength.init(in)
+	offset.init(in)
+	matchLength.init(in)
+
+	for i := 0; i < count; i++ {
+		literalCode, offsetCode, matchCode := literalLength.symbol(), offset.symbol(), matchLength.symbol()
+		if int(literalCode) >= len(literalLengthCodes) || int(matchCode) >= len(matchLengthCodes) || offsetCode > 31 {
+			return errCorrupt
+		}
+		offsetValue := 1<<offsetCode + int(in.read(offsetCode))
+		match := int(matchLengthCodes[matchCode].baseline) + int(in.read(matchLengthCodes[matchCode].bits))
+		literal := int(literalLengthCodes[literalCode].baseline) + int(in.read(literalLengthCodes[literalCode].bits))
+		if i+1 < count {
+			literalLength.update(in)
+			matchLength.update(in)
+			offset.update(in)
+		}
+
+		if literal > len(literals) {
+			return errCorrupt
+		}
+		decoder.window = append(decoder.window, literals[:literal]...)
+		literals = literals[literal:]
+
+		distance := decoder.offset(offsetValue, literal)
+		if distance <= 0 || distance > len(decoder.window) {
+			return errCorrupt
+		}
+		// The match may overlap what it writes, so it is copied in runs
+		from := len(decoder.window) - distance
+		for match > 0 {
+			run := len(decoder.window) - from
+			if run > match {
+				run = match
+			}
+			decoder.window = append(decoder.window, decoder.window[from:from+run]...)
+			from += run
+			match -= run
+		}
+	}
+	if in.left != 0 {
+		return errCorrupt
+	}
+	decoder.window = append(decoder.window, literals...)
+	return nil
+}
+
+// offset resolves an offset value to a distance and updates the repeated
+// offsets. Values 1 to 3 refer to the repeated offsets, shifted by one when
+// the sequence has no literals.
+func (decoder *zstdDecoder) offset(value int, literals int) int {
+	repeats := &decoder.repeats
+	if value > 3 {
+		repeats[0], repeats[1], repeats[2] = value-3, repeats[0], repeats[1]
+		return repeats[0]
+	}
+	index := value - 1
+	if literals == 0 {
+		index++
+	}
+	switch index {
+	case 0:
+		return repeats[0]
+	case 1:
+		repeats[0], repeats[1] = repeats[1], repeats[0]
+	case 2:
+		repeats[0], repeats[1], repeats[2] = repeats[2], repeats[0], repeats[1]
+	case 3:
+		repeats[0], repeats[1], repeats[2] = repeats[0]-1, repeats[0], repeats[1]
+	}
+	return repeats[0]
+}
+
+// readSequenceTable sets the table of one kind of sequence code and
+// returns the number of bytes its description took.
+func (decoder *zstdDecoder) readSequenceTable(kind int, mode int, data []byte) (int, error) {
+	code := sequenceCodes[kind]
+	switch mode {
+	case modePredefined:
+		decoder.tables[kind] = predefinedTables[kind]
+		return 0, nil
+	case modeRLE:
+		if len(data) == 0 || int(data[0]) > code.maxSymbol {
+			return 0, errCorrupt
+		}
+		decoder.tables[kind] = rleTable(data[0])
+		return 1, nil
+	case modeFSE:
+		counts, log, size, err := readDistribution(data, code.maxSymbol, code.maxLog)
+		if err != nil {
+			return 0, err
+		}
+		if decoder.tables[kind], err = newFSETable(counts, log); err != nil {
+			return 0, err
+		}
+		return size, nil
+	}
+	if decoder.tables[kind] == nil {
+		return 0, errCorrupt
+	}
+	return 0, nil
+}
+
+var predefinedTables = func() (tables [3]*fseTable) {
+	for kind, code := range sequenceCodes {
+		table, err := newFSETable(code.predefined, code.log)
+		if err != nil {
+			panic(err)
+		}
+		tables[kind] = table
+	}
+	return tables
+}()
+
+// decodeLiterals returns the literals of a block and the size of the
+// literals section.
+func (decoder *zstdDecoder) decodeLiterals(data []byte) ([]byte, int, error) {
+	if len(data) == 0 {
+		return nil, 0, errCorrupt
+	}
+	kind, format := int(data[0]&3), int(data[0]>>2&3)
+
+	if kind == literalsRaw || kind == literalsRLE {
+		header := [4]int{1, 2, 1, 3}[format]
+		if len(data) < header {
+			return nil, 0, errCorrupt
+		}
+		size := int(load64(data[:header], 0) >> 4)
+		if header == 1 {
+			size = int(data[0] >> 3)
+		}
+		if size > maxBlockSize {
+			return nil, 0, errCorrupt
+		}
+		if kind == literalsRaw {
+			if len(data) < header+size {
+				return nil, 0, errCorrupt
+			}
+			return data[header : header+size], header + size, nil
+		}
+		if len(data) < header+1 {
+			return nil, 0, errCorrupt
+		}
+		decoder.literals = decoder.literals[:0]
+		for i := 0; i < size; i++ {
+			decoder.literals = append(decoder.literals, data[header])
+		}
+		return decoder.literals, header + 1, nil
+	}
+
+	// Huffman-coded literals in one stream or four
+	header, width := 3, uint(10)
+	switch format {
+	case 2:
+		header, width = 4, 14
+	case 3:
+		header, width = 5, 18
+	}
+	if len(data) < header {
+		return nil, 0, errCorrupt
+	}
+	sizes := load64(data[:header], 0) >> 4
+	size := int(sizes & (1<<width - 1))
+	compressed := int(sizes >> width & (1<<width - 1))
+	if size > maxBlockSize || len(data) < header+compressed {
+		return nil, 0, errCorrupt
+	}
+	streams := data[header : header+compressed]
+
+	if kind == literalsCompressed {
+		table, tableSize, err := readHuffmanTable(streams)
+		if err != nil {
+			return nil, 0, err
+		}
+		decoder.huffman = table
+		streams = streams[tableSize:]
+	} else if decoder.huffman == nil {
+		return nil, 0, errCorrupt
+	}
+
+	if cap(decoder.literals) < size {
+		decoder.literals = make([]byte, size)
+	}
+	literals := decoder.literals[:size]
+	var err error
+	if format == 0 {
+		err = decoder.huffman.decode(streams, literals)
+	} else {
+		err = decoder.huffman.decodeStreams(streams, literals)
+	}
+	return literals, header + compressed, err
+}
+
+// unexpected reports a stream that ends inside a frame.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
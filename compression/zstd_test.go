@@ -0,0 +1,135 @@
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testResults imitates the engines' CSV results, a row per body per frame.
+// The files in testdata are testResults(300) compressed by the reference
+// zstd command, at its default level and with -19.
+func testResults(frames int) []byte {
+	var out bytes.Buffer
+	out.WriteString("Frame,Body Name,PosX,PosY,VelX,VelY\n")
+	for frame := 0; frame < frames; frame++ {
+		for body := 1; body <= 20; body++ {
+			angle := 2 * math.Pi * float64(frame%50*body) / 50
+			radius := 100 * float64(body)
+			fmt.Fprintf(&out, "%d,Planet %d,%.2f,%.2f,%.2f,%.2f\n", frame, body,
+				radius*math.Cos(angle), radius*math.Sin(angle), -radius*math.Sin(angle), radius*math.Cos(angle))
+		}
+	}
+	return out.Bytes()
+}
+
+func readFile(t *testing.T, filename string) []byte {
+	t.Helper()
+	in, err := Open(filename)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer in.Close()
+	data, err := io.ReadAll(in)
+	if err != nil {
+		t.Fatalf("reading %s: %v", filename, err)
+	}
+	return data
+}
+
+func TestZstdRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 300000)
+	rng.Read(random)
+	everyByte := make([]byte, 4096)
+	for i := range everyByte {
+		everyByte[i] = byte(i)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short", []byte("Frame,Body Name\n")},
+		{"one byte repeated", bytes.Repeat([]byte{'x'}, 200000)},
+		{"random", random},
+		{"every byte value", bytes.Repeat(everyByte, 20)},
+		// Several blocks, with matches reaching back past the window
+		{"results", testResults(15000)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "results.csv.zst")
+			out, err := Create(filename)
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			// Uneven writes, as a CSV writer flushes them
+			for data := test.data; len(data) > 0; {
+				n := 1 + rng.Intn(70000)
+				if n > len(data) {
+					n = len(data)
+				}
+				if _, err := out.Write(data[:n]); err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+				data = data[n:]
+			}
+			if err := out.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			if got := readFile(t, filename); !bytes.Equal(got, test.data) {
+				t.Errorf("read back %d bytes that differ from the %d written", len(got), len(test.data))
+			}
+			if test.name == "results" {
+				info, err := os.Stat(filename)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ratio := float64(info.Size()) / float64(len(test.data)); ratio > 0.3 {
+					t.Errorf("compressed to %.0f%% of the size", 100*ratio)
+				}
+			}
+		})
+	}
+}
+
+func TestZstdReference(t *testing.T) {
+	want := testResults(300)
+	for _, name := range []string{"results.csv.zst", "results-19.csv.zst"} {
+		if got := readFile(t, filepath.Join("testdata", name)); !bytes.Equal(got, want) {
+			t.Errorf("%s: read %d bytes that differ from the %d expected", name, len(got), len(want))
+		}
+	}
+}
+
+func TestZstdCorrupt(t *testing.T) {
+	var compressed bytes.Buffer
+	out := newZstdEncoder(&compressed)
+	out.Write(testResults(100))
+	out.Close()
+	stream := compressed.Bytes()
+
+	truncated := stream[:len(stream)/2]
+	if _, err := io.ReadAll(newZstdDecoder(bytes.NewReader(truncated))); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated stream: error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	// The last four bytes are the checksum
+	damaged := append([]byte{}, stream...)
+	damaged[len(damaged)-1] ^= 1
+	if _, err := io.ReadAll(newZstdDecoder(bytes.NewReader(damaged))); err == nil {
+		t.Error("damaged checksum: no error")
+	}
+
+	if _, err := io.ReadAll(newZstdDecoder(bytes.NewReader([]byte("Frame,Body Name\n")))); err == nil {
+		t.Error("plain text: no error")
+	}
+}
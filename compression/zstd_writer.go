@@ -0,0 +1,368 @@
+package compression
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+const (
+	zstdWindowLog = 20
+	zstdWindow    = 1 << zstdWindowLog
+	zstdHashLog   = 16
+	minMatch      = 4 // At the last offset
+	minNewMatch   = 7 // At a new offset, which costs more to code
+)
+
+// zstdEncoder compresses what is written to it into one Zstandard frame,
+// a block at a time. Close ends the frame; it does not close out.
+type zstdEncoder struct {
+	out     io.Writer
+	err     error // Sticky
+	started bool
+
+	history []byte  // Content still inside the window, then the block being filled
+	pending int     // Start of the block being filled
+	short   []int32 // Last position in history of each hash of 4 bytes, plus one
+	long    []int32 // The same for 8 bytes
+	repeats [3]int
+	hash    *xxhash64
+	block   []byte
+}
+
+// sequence copies literals bytes of literals, then match bytes from the
+// given offset value back.
+type sequence struct {
+	literals, offsetValue, match uint32
+}
+
+func newZstdEncoder(out io.Writer) *zstdEncoder {
+	return &zstdEncoder{
+		out:     out,
+		short:   make([]int32, 1<<zstdHashLog),
+		long:    make([]int32, 1<<zstdHashLog),
+		repeats: [3]int{1, 4, 8},
+		hash:    newXXHash64(),
+	}
+}
+
+func (encoder *zstdEncoder) Write(data []byte) (int, error) {
+	written := 0
+	for encoder.err == nil && written < len(data) {
+		n := len(data) - written
+		if room := maxBlockSize - (len(encoder.history) - encoder.pending); n > room {
+			n = room
+		}
+		encoder.history = append(encoder.history, data[written:written+n]...)
+		encoder.hash.Write(data[written : written+n])
+		written += n
+		if len(encoder.history)-encoder.pending == maxBlockSize {
+			encoder.err = encoder.writeBlock(false)
+		}
+	}
+	return written, encoder.err
+}
+
+// Close writes the last block and the checksum.
+func (encoder *zstdEncoder) Close() error {
+	if encoder.err != nil {
+		return encoder.err
+	}
+	encoder.err = encoder.writeBlock(true)
+	if encoder.err == nil {
+		var checksum [4]byte
+		binary.LittleEndian.PutUint32(checksum[:], uint32(encoder.hash.Sum64()))
+		_, encoder.err = encoder.out.Write(checksum[:])
+	}
+	err := encoder.err
+	if err == nil {
+		encoder.err = errors.New("zstd: write after close")
+	}
+	return err
+}
+
+func (encoder *zstdEncoder) writeBlock(last bool) error {
+	out := encoder.block[:0]
+	if !encoder.started {
+		// No content size and no dictionary, with a checksum
+		out = binary.LittleEndian.AppendUint32(out, zstdMagic)
+		out = append(out, 1<<2, (zstdWindowLog-10)<<3)
+		encoder.started = true
+	}
+
+	content := encoder.history[encoder.pending:]
+	repeats := encoder.repeats
+	compressed := encoder.compress()
+	kind, payload := blockCompressed, compressed
+	if len(compressed) >= len(content) {
+		// The decoder never sees these sequences
+		encoder.repeats = repeats
+		kind, payload = blockRaw, content
+		if len(content) > 1 && allEqual(content) {
+			kind, payload = blockRLE, content[:1]
+		}
+	}
+
+	header := len(content) << 3
+	if kind == blockCompressed {
+		header = len(compressed) << 3
+	}
+	header |= kind << 1
+	if last {
+		header |= 1
+	}
+	out = append(out, byte(header), byte(header>>8), byte(header>>16))
+	out = append(out, payload...)
+	encoder.block = out
+	if _, err := encoder.out.Write(out); err != nil {
+		return err
+	}
+
+	encoder.pending = len(encoder.history)
+	if excess := len(encoder.history) - zstdWindow; excess > zstdWindow {
+		encoder.history = append(encoder.history[:0], encoder.history[excess:]...)
+		encoder.pending -= excess
+		for _, table := range [][]int32{encoder.short, encoder.long} {
+			for i, position := range table {
+				table[i] = 0
+				if int(position) > excess {
+					table[i] = position - int32(excess)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func allEqual(data []byte) bool {
+	for _, b := range data {
+		if b != data[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// compress returns the pending block as the body of a compressed block.
+// Matches are found greedily: at the last offset first, then through hash
+// tables of the last 8-byte and 4-byte prefixes. Short matches at a new
+// offset are left as literals, which the Huffman code makes cheaper.
+func (encoder *zstdEncoder) compress() []byte {
+	history := encoder.history
+	end := len(history)
+	var literals []byte
+	var sequences []sequence
+
+	literal := encoder.pending
+	for i := encoder.pending; i+8 <= end; {
+		short, long := encoder.insert(i)
+
+		distance, match := 0, 0
+		if repeat := encoder.repeats[0]; i > literal && repeat <= i {
+			if length := matchLength(history, i, i-repeat); length >= minMatch {
+				distance, match = repeat, length
+			}
+		}
+		for _, candidate := range [2]int{long, short} {
+			if distance == 0 && candidate >= 0 && i-candidate <= zstdWindow {
+				if length := matchLength(history, i, candidate); length >= minNewMatch {
+					distance, match = i-candidate, length
+				}
+			}
+		}
+		if distance == 0 {
+			// Step faster through data that does not match
+			i += 1 + (i-literal)>>7
+			continue
+		}
+
+		for i > literal && i > distance && history[i-1] == history[i-1-distance] {
+			i--
+			match++
+		}
+		literals = append(literals, history[literal:i]...)
+		sequences = append(sequences, encoder.sequence(i-literal, distance, match))
+		for next := i + match; i < next; i++ {
+			if i+8 <= end {
+				encoder.insert(i)
+			}
+		}
+		literal = i
+	}
+	literals = append(literals, history[literal:end]...)
+
+	out := encodeLiterals(nil, literals)
+	return encodeSequences(out, sequences)
+}
+
+// insert records position i in the hash tables, and returns the last
+// positions with its 4-byte and 8-byte hashes, or -1.
+func (encoder *zstdEncoder) insert(i int) (int, int) {
+	short := &encoder.short[binary.LittleEndian.Uint32(encoder.history[i:])*2654435761>>(32-zstdHashLog)]
+	long := &encoder.long[binary.LittleEndian.Uint64(encoder.history[i:])*0x9E3779B185EBCA87>>(64-zstdHashLog)]
+	last, previous := int(*short)-1, int(*long)-1
+	*short, *long = int32(i+1), int32(i+1)
+	return last, previous
+}
+
+// matchLength returns how many bytes from i on repeat those from the
+// earlier position from.
+func matchLength(history []byte, i int, from int) int {
+	length := 0
+	for i+length < len(history) && history[i+length] == history[from+length] {
+		length++
+	}
+	return length
+}
+
+// sequence codes distance as the last offset when it can, and keeps the
+// repeated offsets as the decoder will.
+func (encoder *zstdEncoder) sequence(literals int, distance int, match int) sequence {
+	offsetValue := distance + 3
+	if literals > 0 && distance == encoder.repeats[0] {
+		offsetValue = 1
+	} else {
+		encoder.repeats = [3]int{distance, encoder.repeats[0], encoder.repeats[1]}
+	}
+	return sequence{literals: uint32(literals), offsetValue: uint32(offsetValue), match: uint32(match)}
+}
+
+// encodeLiterals appends the literals section, Huffman coded when that is
+// smaller.
+func encodeLiterals(out []byte, literals []byte) []byte {
+	var counts [256]int
+	distinct := 0
+	for _, b := range literals {
+		if counts[b] == 0 {
+			distinct++
+		}
+		counts[b]++
+	}
+	raw := len(literals)
+	switch {
+	case distinct == 1 && len(literals) > 1:
+		return append(literalsHeader(out, literalsRLE, len(literals)), literals[0])
+	case len(literals) < 64 || distinct == 1:
+		return append(literalsHeader(out, literalsRaw, raw), literals...)
+	}
+
+	huffman := newHuffmanEncoder(&counts)
+	description, ok := huffman.description()
+	if !ok {
+		return append(literalsHeader(out, literalsRaw, raw), literals...)
+	}
+	format, width, header := 0, 10, 3
+	var streams []byte
+	if len(literals) < 256 {
+		streams = huffman.encode(literals)
+	} else {
+		// Four streams, after a table of the sizes of the first three
+		streams = make([]byte, 6)
+		segment := (len(literals) + 3) / 4
+		for i := 0; i < 4; i++ {
+			last := segment * (i + 1)
+			if i == 3 {
+				last = len(literals)
+			}
+			stream := huffman.encode(literals[segment*i : last])
+			if i < 3 {
+				binary.LittleEndian.PutUint16(streams[2*i:], uint16(len(stream)))
+			}
+			streams = append(streams, stream...)
+		}
+		format = 1
+		switch size := len(description) + len(streams); {
+		case size > 16383 || len(literals) > 16383:
+			format, width, header = 3, 18, 5
+		case size > 1023 || len(literals) > 1023:
+			format, width, header = 2, 14, 4
+		}
+	}
+
+	compressed := len(description) + len(streams)
+	if header+compressed >= len(literalsHeader(nil, literalsRaw, raw))+raw {
+		return append(literalsHeader(out, literalsRaw, raw), literals...)
+	}
+	sizes := uint64(literalsCompressed) | uint64(format)<<2 | uint64(len(literals))<<4 | uint64(compressed)<<(4+width)
+	for i := 0; i < header; i++ {
+		out = append(out, byte(sizes>>(8*i)))
+	}
+	out = append(out, description...)
+	return append(out, streams...)
+}
+
+// literalsHeader appends the header of raw or RLE literals.
+func literalsHeader(out []byte, kind int, size int) []byte {
+	switch {
+	case size < 32:
+		return append(out, byte(kind|size<<3))
+	case size < 4096:
+		return append(out, byte(kind|1<<2|size<<4), byte(size>>4))
+	}
+	return append(out, byte(kind|3<<2|size<<4), byte(size>>4), byte(size>>12))
+}
+
+var predefinedEncoders = func() (encoders [3]*fseEncoder) {
+	for kind, code := range sequenceCodes {
+		encoder, err := newFSEEncoder(code.predefined, code.log)
+		if err != nil {
+			panic(err)
+		}
+		encoders[kind] = encoder
+	}
+	return encoders
+}()
+
+// encodeSequences appends the sequences section, coded with the predefined
+// tables. The sequences are written last first, as they are read backwards.
+func encodeSequences(out []byte, sequences []sequence) []byte {
+	n := len(sequences)
+	switch {
+	case n < 128:
+		out = append(out, byte(n))
+	case n < 0x7F00:
+		out = append(out, byte(n>>8+128), byte(n))
+	default:
+		out = append(out, 255, byte(n-0x7F00), byte((n-0x7F00)>>8))
+	}
+	if n == 0 {
+		return out
+	}
+	out = append(out, modePredefined<<6|modePredefined<<4|modePredefined<<2)
+
+	type codes struct{ literal, offset, match uint8 }
+	coded := make([]codes, n)
+	for i, sequence := range sequences {
+		coded[i] = codes{
+			literal: lengthCodeOf(literalLengthCodes, sequence.literals),
+			offset:  uint8(bits.Len32(sequence.offsetValue) - 1),
+			match:   lengthCodeOf(matchLengthCodes, sequence.match),
+		}
+	}
+
+	writer := &bitWriter{}
+	extra := func(i int) {
+		literal := literalLengthCodes[coded[i].literal]
+		writer.add(uint64(sequences[i].literals-literal.baseline), uint(literal.bits))
+		match := matchLengthCodes[coded[i].match]
+		writer.add(uint64(sequences[i].match-match.baseline), uint(match.bits))
+		writer.add(uint64(sequences[i].offsetValue), uint(coded[i].offset))
+	}
+
+	literalCodes, offsetCodes, matchCodes := predefinedEncoders[literalLengths], predefinedEncoders[offsets], predefinedEncoders[matchLengths]
+	literalState := literalCodes.start(coded[n-1].literal)
+	offsetState := offsetCodes.start(coded[n-1].offset)
+	matchState := matchCodes.start(coded[n-1].match)
+	extra(n - 1)
+	for i := n - 2; i >= 0; i-- {
+		offsetState = offsetCodes.encode(writer, offsetState, coded[i].offset)
+		matchState = matchCodes.encode(writer, matchState, coded[i].match)
+		literalState = literalCodes.encode(writer, literalState, coded[i].literal)
+		extra(i)
+	}
+	matchCodes.flush(writer, matchState)
+	offsetCodes.flush(writer, offsetState)
+	literalCodes.flush(writer, literalState)
+	return append(out, writer.close()...)
+}
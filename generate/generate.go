@@ -0,0 +1,209 @@
+// This package generates initial conditions in the input format read by
+// utils.ReadInput, so that test systems do not have to be written by hand.
+// Every model is seeded, so the same configuration always gives the same bodies.
+
+package generate
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"proj3-redesigned/utils"
+	"sort"
+	"strconv"
+)
+
+// Config holds the parameters shared by the models. Models ignore the fields
+// they have no use for.
+type Config struct {
+	N           int     // Number of bodies, excluding any central body
+	Mass        float64 // Total mass of the bodies
+	Radius      float64 // Scale radius of the model
+	CentralMass float64 // Mass of the central body of the kepler model
+	G           float64 // Gravitational constant used for the velocities
+	Seed        int64
+}
+
+// DefaultConfig returns the configuration of the generate command's defaults,
+// sized like the bundled datasets.
+func DefaultConfig() Config {
+	return Config{N: 100, Mass: 5e21, Radius: 1e5, CentralMass: 5e23, G: utils.G, Seed: 1}
+}
+
+// Models lists the model names accepted by Generate.
+var Models = []string{"disc", "plummer", "hernquist", "king", "kepler", "exponential", "collision", "solar"}
+
+// Generate builds the bodies of the named model.
+func Generate(model string, config Config) ([]*utils.Body, error) {
+	if config.N <= 0 && model != "solar" {
+		return nil, fmt.Errorf("model %s needs a positive number of bodies", model)
+	}
+	rng := rand.New(rand.NewSource(config.Seed))
+
+	var bodies []*utils.Body
+	switch model {
+	case "disc":
+		bodies = uniformDisc(rng, config)
+	case "plummer":
+		bodies = plummer(rng, config)
+	case "hernquist":
+		bodies = hernquist(rng, config)
+	case "king":
+		bodies = king(rng, config)
+	case "kepler":
+		bodies = keplerDisc(rng, config)
+	case "exponential":
+		bodies = exponentialDisc(rng, config)
+	case "collision":
+		bodies = collision(rng, config)
+	case "solar":
+		bodies = solarSystem(rng, config)
+	default:
+		return nil, fmt.Errorf("unknown model %q", model)
+	}
+	return bodies, nil
+}
+
+// Write saves bodies in the input format, after a header giving the frame
+// count and either SI units or, for any other G, the constant itself.
+func Write(filename string, bodies []*utils.Body, frames int, G float64) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	header := [][]string{{"Format", strconv.Itoa(utils.FormatVersion)}}
+	if G == utils.G {
+		header = append(header, []string{"Units", "si"})
+	} else {
+		header = append(header, []string{"G", strconv.FormatFloat(G, 'g', -1, 64)})
+	}
+	header = append(header,
+		[]string{"Frames", strconv.Itoa(frames)},
+		[]string{"Dimension", "2"},
+		append([]string{"Columns"}, utils.DefaultColumns[:6]...),
+	)
+	if err := writer.WriteAll(header); err != nil {
+		return err
+	}
+	for _, body := range bodies {
+		record := []string{
+			body.Name,
+			strconv.FormatFloat(body.Positions.X, 'g', -1, 64),
+			strconv.FormatFloat(body.Positions.Y, 'g', -1, 64),
+			strconv.FormatFloat(body.Velocities.X, 'g', -1, 64),
+			strconv.FormatFloat(body.Velocities.Y, 'g', -1, 64),
+			strconv.FormatFloat(body.Mass, 'g', -1, 64),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// newBody names bodies the way the hand-written datasets do.
+func newBody(index int, position utils.Vector2, velocity utils.Vector2, mass float64) *utils.Body {
+	return &utils.Body{
+		Name:       fmt.Sprintf("Planet %d", index+1),
+		Positions:  position,
+		Velocities: velocity,
+		Mass:       mass,
+	}
+}
+
+func polar(radius float64, angle float64) utils.Vector2 {
+	return utils.Vector2{X: radius * math.Cos(angle), Y: radius * math.Sin(angle)}
+}
+
+// projected returns the in-plane part of a point at radius r in a random
+// direction in three dimensions.
+func projected(rng *rand.Rand, r float64) utils.Vector2 {
+	z := 2*rng.Float64() - 1
+	return polar(r*math.Sqrt(1-z*z), 2*math.Pi*rng.Float64())
+}
+
+func gaussian(rng *rand.Rand, sigma float64) utils.Vector2 {
+	return utils.Vector2{X: sigma * rng.NormFloat64(), Y: sigma * rng.NormFloat64()}
+}
+
+// toCenterOfMass moves the bodies into their centre-of-mass frame.
+func toCenterOfMass(bodies []*utils.Body) {
+	position, velocity := (&utils.Bodies{NodeBodies: bodies}).CenterOfMass()
+	for _, body := range bodies {
+		body.Positions = body.Positions.Subtract(position)
+		body.Velocities = body.Velocities.Subtract(velocity)
+	}
+}
+
+// virialize rescales the velocities about the centre of mass so that the
+// kinetic energy is half the magnitude of the potential energy.
+func virialize(bodies []*utils.Body, G float64) {
+	toCenterOfMass(bodies)
+	kinetic, potential := 0.0, 0.0
+	for i, body := range bodies {
+		kinetic += body.KineticEnergy(utils.Vector2{})
+		for _, other := range bodies[i+1:] {
+			potential -= G * body.Mass * other.Mass / body.Positions.Subtract(other.Positions).Magnitude()
+		}
+	}
+	if kinetic == 0 {
+		return
+	}
+	scale := math.Sqrt(0.5 * math.Abs(potential) / kinetic)
+	for _, body := range bodies {
+		body.Velocities = body.Velocities.Multiply(scale)
+	}
+}
+
+// rotate sets every body on the circular orbit that balances the radial
+// part of the force from all the other bodies, counter-clockwise about the
+// origin, plus a random velocity of the given fraction of that speed.
+func rotate(rng *rand.Rand, bodies []*utils.Body, G float64, dispersion float64) {
+	for _, body := range bodies {
+		radius := body.Positions.Magnitude()
+		if radius == 0 {
+			continue
+		}
+		var acceleration utils.Vector2
+		for _, other := range bodies {
+			if other == body {
+				continue
+			}
+			r := other.Positions.Subtract(body.Positions)
+			distance := r.Magnitude()
+			acceleration = acceleration.Add(r.Multiply(G * other.Mass / (distance * distance * distance)))
+		}
+		inward := -acceleration.Dot(body.Positions) / radius
+		speed := math.Sqrt(math.Max(inward, 0) * radius)
+		tangent := utils.Vector2{X: -body.Positions.Y / radius, Y: body.Positions.X / radius}
+		body.Velocities = tangent.Multiply(speed).Add(gaussian(rng, dispersion*speed))
+	}
+}
+
+// enclosedSpeeds returns circular speeds from the mass enclosed within each
+// body's radius, for setups too large for rotate.
+func enclosedSpeeds(bodies []*utils.Body, G float64, centralMass float64) []float64 {
+	order := make([]int, len(bodies))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return bodies[order[a]].Positions.Magnitude() < bodies[order[b]].Positions.Magnitude()
+	})
+	speeds := make([]float64, len(bodies))
+	enclosed := centralMass
+	for _, i := range order {
+		radius := bodies[i].Positions.Magnitude()
+		if radius > 0 {
+			speeds[i] = math.Sqrt(G * enclosed / radius)
+		}
+		enclosed += bodies[i].Mass
+	}
+	return speeds
+}
@@ -0,0 +1,208 @@
+package generate
+
+import (
+	"math"
+	"math/rand"
+	"proj3-redesigned/utils"
+)
+
+// Beyond this many bodies the rotating discs use the enclosed mass rather
+// than the full force to set their circular speeds.
+const directLimit = 5000
+
+// uniformDisc spreads bodies evenly over a disc of Radius with isotropic velocities.
+func uniformDisc(rng *rand.Rand, config Config) []*utils.Body {
+	bodies := make([]*utils.Body, config.N)
+	for i := range bodies {
+		position := polar(config.Radius*math.Sqrt(rng.Float64()), 2*math.Pi*rng.Float64())
+		bodies[i] = newBody(i, position, gaussian(rng, 1), config.Mass/float64(config.N))
+	}
+	virialize(bodies, config.G)
+	return bodies
+}
+
+// plummer samples a Plummer sphere of scale radius Radius, with speeds from
+// its distribution function (Aarseth, Henon & Wielen 1974), projected onto the plane.
+func plummer(rng *rand.Rand, config Config) []*utils.Body {
+	bodies := make([]*utils.Body, config.N)
+	for i := range bodies {
+		// Invert the cumulative mass, leaving out the sparse outer 1%
+		u := 0.99 * rng.Float64()
+		r := config.Radius / math.Sqrt(math.Pow(u, -2.0/3.0)-1)
+
+		// Von Neumann rejection for q = v / v_escape from q^2 (1 - q^2)^3.5
+		q := 0.0
+		for {
+			q = rng.Float64()
+			if 0.1*rng.Float64() < q*q*math.Pow(1-q*q, 3.5) {
+				break
+			}
+		}
+		escape := math.Sqrt(2*config.G*config.Mass/config.Radius) * math.Pow(1+r*r/(config.Radius*config.Radius), -0.25)
+
+		bodies[i] = newBody(i, projected(rng, r), projected(rng, q*escape), config.Mass/float64(config.N))
+	}
+	virialize(bodies, config.G)
+	return bodies
+}
+
+// hernquist samples a Hernquist sphere of scale radius Radius, cut at 20
+// scale radii and projected onto the plane.
+func hernquist(rng *rand.Rand, config Config) []*utils.Body {
+	bodies := make([]*utils.Body, config.N)
+	cut := math.Pow(20.0/21.0, 2)
+	for i := range bodies {
+		// M(<r) = M r^2 / (r + a)^2
+		s := math.Sqrt(cut * rng.Float64())
+		r := config.Radius * s / (1 - s)
+		// A third of the local potential depth per component
+		sigma := math.Sqrt(config.G * config.Mass / (r + config.Radius) / 3)
+		bodies[i] = newBody(i, projected(rng, r), gaussian(rng, sigma), config.Mass/float64(config.N))
+	}
+	virialize(bodies, config.G)
+	return bodies
+}
+
+// king samples King's (1962) surface density profile with core radius
+// Radius and tidal radius 10 Radius, with a dispersion that follows the density.
+func king(rng *rand.Rand, config Config) []*utils.Body {
+	core, tidal := config.Radius, 10*config.Radius
+	edge := 1 / math.Sqrt(1+(tidal/core)*(tidal/core))
+	density := func(radius float64) float64 {
+		d := 1/math.Sqrt(1+(radius/core)*(radius/core)) - edge
+		return d * d
+	}
+	central := density(0)
+
+	bodies := make([]*utils.Body, config.N)
+	for i := range bodies {
+		// Rejection on R * Sigma(R), which is bounded by tidal * Sigma(0)
+		radius := 0.0
+		for {
+			radius = tidal * rng.Float64()
+			if rng.Float64()*tidal*central < radius*density(radius) {
+				break
+			}
+		}
+		sigma := math.Sqrt(density(radius) / central)
+		bodies[i] = newBody(i, polar(radius, 2*math.Pi*rng.Float64()), gaussian(rng, sigma), config.Mass/float64(config.N))
+	}
+	virialize(bodies, config.G)
+	return bodies
+}
+
+// keplerDisc places a cold disc of bodies between 0.1 Radius and Radius on
+// circular orbits around a central body of CentralMass.
+func keplerDisc(rng *rand.Rand, config Config) []*utils.Body {
+	bodies := make([]*utils.Body, 0, config.N+1)
+	for i := 0; i < config.N; i++ {
+		inner := 0.1 * config.Radius
+		radius := math.Sqrt(inner*inner + (config.Radius*config.Radius-inner*inner)*rng.Float64())
+		bodies = append(bodies, newBody(i, polar(radius, 2*math.Pi*rng.Float64()), utils.Vector2{}, config.Mass/float64(config.N)))
+	}
+	central := &utils.Body{Name: "Star", Mass: config.CentralMass}
+
+	if config.N <= directLimit {
+		rotate(rng, append(bodies, central), config.G, 0)
+	} else {
+		for i, speed := range enclosedSpeeds(bodies, config.G, config.CentralMass) {
+			position := bodies[i].Positions
+			radius := position.Magnitude()
+			bodies[i].Velocities = utils.Vector2{X: -position.Y / radius, Y: position.X / radius}.Multiply(speed)
+		}
+	}
+
+	bodies = append([]*utils.Body{central}, bodies...)
+	toCenterOfMass(bodies)
+	return bodies
+}
+
+// exponentialDisc samples a rotating disc with surface density falling as
+// exp(-R / Radius), cut at 10 Radius, with a 10% velocity dispersion.
+func exponentialDisc(rng *rand.Rand, config Config) []*utils.Body {
+	bodies := make([]*utils.Body, config.N)
+	for i := range bodies {
+		// R exp(-R) is a gamma distribution with shape 2
+		radius := math.Inf(1)
+		for radius > 10*config.Radius {
+			radius = -config.Radius * math.Log(rng.Float64()*rng.Float64())
+		}
+		bodies[i] = newBody(i, polar(radius, 2*math.Pi*rng.Float64()), utils.Vector2{}, config.Mass/float64(config.N))
+	}
+
+	if config.N <= directLimit {
+		rotate(rng, bodies, config.G, 0.1)
+	} else {
+		for i, speed := range enclosedSpeeds(bodies, config.G, 0) {
+			position := bodies[i].Positions
+			radius := position.Magnitude()
+			tangent := utils.Vector2{X: -position.Y / radius, Y: position.X / radius}
+			bodies[i].Velocities = tangent.Multiply(speed).Add(gaussian(rng, 0.1*speed))
+		}
+	}
+	toCenterOfMass(bodies)
+	return bodies
+}
+
+// collision sets two Plummer galaxies of half the bodies each on a parabolic
+// encounter, starting 10 Radius apart with an impact parameter of 2 Radius.
+func collision(rng *rand.Rand, config Config) []*utils.Body {
+	half := config
+	half.N = config.N / 2
+	half.Mass = config.Mass / 2
+	first := plummer(rng, half)
+	half.N = config.N - half.N
+	second := plummer(rng, half)
+
+	separation := utils.Vector2{X: 10 * config.Radius, Y: 2 * config.Radius}
+	speed := math.Sqrt(2 * config.G * config.Mass / separation.Magnitude())
+	// Moving along x only leaves the y offset as the impact parameter
+	approach := utils.Vector2{X: speed / 2}
+
+	for _, body := range first {
+		body.Positions = body.Positions.Subtract(separation.Multiply(0.5))
+		body.Velocities = body.Velocities.Add(approach)
+	}
+	for i, body := range second {
+		body.Name = newBody(len(first)+i, utils.Vector2{}, utils.Vector2{}, 0).Name
+		body.Positions = body.Positions.Add(separation.Multiply(0.5))
+		body.Velocities = body.Velocities.Subtract(approach)
+	}
+	return append(first, second...)
+}
+
+// solarSystem is the Sun and the eight planets on circular orbits at their
+// semi-major axes, in SI units, with seeded orbital phases.
+func solarSystem(rng *rand.Rand, config Config) []*utils.Body {
+	const au = 1.495978707e11
+	const sunMass = 1.98847e30
+	planets := []struct {
+		name string
+		axis float64 // AU
+		mass float64 // kg
+	}{
+		{"Mercury", 0.387, 3.301e23},
+		{"Venus", 0.723, 4.867e24},
+		{"Earth", 1.000, 5.972e24},
+		{"Mars", 1.524, 6.417e23},
+		{"Jupiter", 5.203, 1.898e27},
+		{"Saturn", 9.537, 5.683e26},
+		{"Uranus", 19.19, 8.681e25},
+		{"Neptune", 30.07, 1.024e26},
+	}
+
+	bodies := []*utils.Body{{Name: "Sun", Mass: sunMass}}
+	for _, planet := range planets {
+		radius := planet.axis * au
+		angle := 2 * math.Pi * rng.Float64()
+		speed := math.Sqrt(config.G * (sunMass + planet.mass) / radius)
+		bodies = append(bodies, &utils.Body{
+			Name:       planet.name,
+			Positions:  polar(radius, angle),
+			Velocities: polar(speed, angle+math.Pi/2),
+			Mass:       planet.mass,
+		})
+	}
+	toCenterOfMass(bodies)
+	return bodies
+}
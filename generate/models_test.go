@@ -0,0 +1,43 @@
+package generate
+
+import (
+	"math"
+	"proj3-redesigned/utils"
+	"testing"
+)
+
+// centre returns the centre of mass and its velocity.
+func centre(bodies []*utils.Body) (utils.Vector2, utils.Vector2) {
+	var mass float64
+	var position, velocity utils.Vector2
+	for _, body := range bodies {
+		mass += body.Mass
+		position = position.Add(body.Positions.Multiply(body.Mass))
+		velocity = velocity.Add(body.Velocities.Multiply(body.Mass))
+	}
+	return position.Multiply(1 / mass), velocity.Multiply(1 / mass)
+}
+
+func TestCollisionIsOffset(t *testing.T) {
+	config := DefaultConfig()
+	bodies, err := Generate("collision", config)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	firstPosition, firstVelocity := centre(bodies[:config.N/2])
+	secondPosition, secondVelocity := centre(bodies[config.N/2:])
+	separation := secondPosition.Subtract(firstPosition)
+	velocity := secondVelocity.Subtract(firstVelocity)
+
+	if separation.Dot(velocity) >= 0 {
+		t.Errorf("galaxies at %v moving at %v do not approach", separation, velocity)
+	}
+
+	// The specific angular momentum of the pair is the separation times the
+	// velocity across it, which the 2 Radius impact parameter sets
+	momentum := separation.X*velocity.Y - separation.Y*velocity.X
+	want := 2 * config.Radius * velocity.Magnitude()
+	if math.Abs(momentum-want) > 0.1*want {
+		t.Errorf("angular momentum = %g, want about %g", momentum, want)
+	}
+}
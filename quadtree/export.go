@@ -0,0 +1,308 @@
+package quadtree
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"proj3-redesigned/compression"
+	"proj3-redesigned/utils"
+	"proj3-redesigned/vtk"
+	"strconv"
+	"strings"
+)
+
+// Cell is the geometry and contents of one node of a tree.
+type Cell struct {
+	Depth     int // 0 for the root
+	Region    [2]utils.Vector2
+	TotalMass float64
+	Center    utils.Vector2 // Centre of mass
+	Bodies    int           // Bodies anywhere below the node
+	Leaf      bool
+}
+
+// Cells lists every node of the tree depth first, parents before children.
+// The engines store a placeholder mass in the root, so its mass and centre
+// are summed from what lies directly below it.
+func Cells(root *utils.QuadNode) []Cell {
+	var cells []Cell
+	var walk func(node *utils.QuadNode, depth int) int
+	walk = func(node *utils.QuadNode, depth int) int {
+		index := len(cells)
+		cells = append(cells, Cell{
+			Depth:     depth,
+			Region:    node.Region,
+			TotalMass: node.TotalMass,
+			Center:    node.Center,
+			Leaf:      node.IsLeaf(),
+		})
+		bodies := 0
+		if node.BodiesPtr != nil {
+			bodies = len(node.BodiesPtr.NodeBodies)
+		}
+		for _, child := range node.Children {
+			if child != nil {
+				bodies += walk(child, depth+1)
+			}
+		}
+		cells[index].Bodies = bodies
+		return bodies
+	}
+	if root != nil {
+		walk(root, 0)
+		cells[0].TotalMass, cells[0].Center = rootMass(root)
+	}
+	return cells
+}
+
+// rootMass returns the mass and centre of mass of the root's children, or
+// of its bodies if it is a leaf.
+func rootMass(root *utils.QuadNode) (float64, utils.Vector2) {
+	var mass float64
+	var weighted utils.Vector2
+	add := func(m float64, position utils.Vector2) {
+		mass += m
+		weighted = weighted.Add(position.Multiply(m))
+	}
+	if root.BodiesPtr != nil {
+		for _, body := range root.BodiesPtr.NodeBodies {
+			add(body.Mass, body.Positions)
+		}
+	}
+	for _, child := range root.Children {
+		if child != nil {
+			add(child.TotalMass, child.Center)
+		}
+	}
+	if mass == 0 {
+		return 0, utils.Vector2{}
+	}
+	return mass, weighted.Multiply(1 / mass)
+}
+
+// Exporter writes the tree of each frame it is given.
+type Exporter interface {
+	WriteTree(frame int, time float64, root *utils.QuadNode) error
+	Close() error
+}
+
+// ExportFormat returns the format of a tree export file from its extension:
+// .csv, .json, each optionally followed by .gz or .zst, or .pvd for VTK.
+func ExportFormat(filename string) (string, error) {
+	switch strings.ToLower(filepath.Ext(compression.Strip(filename))) {
+	case ".csv":
+		return "csv", nil
+	case ".json":
+		return "json", nil
+	case ".pvd":
+		if compression.Extension(filename) != "" {
+			return "", fmt.Errorf("%s: VTK output cannot be compressed", filename)
+		}
+		return "vtk", nil
+	}
+	return "", fmt.Errorf("%s: unknown tree export format (want a .csv or .json file, optionally .gz or .zst, or a .pvd file)", filename)
+}
+
+// CreateExporter opens a tree export in the format of the file's extension.
+// Lengths, masses and times are converted to the output units.
+func CreateExporter(filename string, conversion utils.Conversion) (Exporter, error) {
+	format, err := ExportFormat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if format == "vtk" {
+		collection, err := vtk.CreateCollection(filename)
+		if err != nil {
+			return nil, err
+		}
+		return &vtkExporter{collection: collection, conversion: conversion}, nil
+	}
+
+	file, err := compression.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	out := bufio.NewWriter(file)
+	if format == "json" {
+		fmt.Fprint(out, "{\"frames\":[")
+		return &jsonExporter{file: file, out: out, conversion: conversion}, nil
+	}
+	fmt.Fprintln(out, "Frame,Depth,MinX,MinY,MaxX,MaxY,TotalMass,CenterX,CenterY,Bodies,Leaf")
+	return &csvExporter{file: file, out: out, conversion: conversion}, nil
+}
+
+// convert returns a cell in the output units.
+func convert(cell Cell, conversion utils.Conversion) Cell {
+	cell.Region[0] = cell.Region[0].Multiply(conversion.Length)
+	cell.Region[1] = cell.Region[1].Multiply(conversion.Length)
+	cell.Center = cell.Center.Multiply(conversion.Length)
+	cell.TotalMass *= conversion.Mass
+	return cell
+}
+
+// closeWriter flushes out and closes the file under it.
+func closeWriter(out *bufio.Writer, file io.Closer) error {
+	err := out.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// csvExporter writes one row per cell, keeping every digit.
+type csvExporter struct {
+	file       io.WriteCloser
+	out        *bufio.Writer
+	conversion utils.Conversion
+}
+
+func (exporter *csvExporter) WriteTree(frame int, time float64, root *utils.QuadNode) error {
+	format := func(value float64) string {
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	for _, cell := range Cells(root) {
+		cell = convert(cell, exporter.conversion)
+		fmt.Fprintf(exporter.out, "%d,%d,%s,%s,%s,%s,%s,%s,%s,%d,%t\n", frame, cell.Depth,
+			format(cell.Region[0].X), format(cell.Region[0].Y), format(cell.Region[1].X), format(cell.Region[1].Y),
+			format(cell.TotalMass), format(cell.Center.X), format(cell.Center.Y), cell.Bodies, cell.Leaf)
+	}
+	return exporter.out.Flush()
+}
+
+func (exporter *csvExporter) Close() error {
+	return closeWriter(exporter.out, exporter.file)
+}
+
+// jsonExporter writes {"frames":[{"frame":0,"time":...,"cells":[...]},...]}.
+// The closing brackets are written by Close.
+type jsonExporter struct {
+	file       io.WriteCloser
+	out        *bufio.Writer
+	conversion utils.Conversion
+	frames     int
+}
+
+type jsonCell struct {
+	Depth     int        `json:"depth"`
+	Min       [2]float64 `json:"min"`
+	Max       [2]float64 `json:"max"`
+	TotalMass float64    `json:"mass"`
+	Center    [2]float64 `json:"center"`
+	Bodies    int        `json:"bodies"`
+	Leaf      bool       `json:"leaf"`
+}
+
+type jsonFrame struct {
+	Frame int        `json:"frame"`
+	Time  float64    `json:"time"`
+	Cells []jsonCell `json:"cells"`
+}
+
+func (exporter *jsonExporter) WriteTree(frame int, time float64, root *utils.QuadNode) error {
+	record := jsonFrame{Frame: frame, Time: time * exporter.conversion.Time}
+	for _, cell := range Cells(root) {
+		cell = convert(cell, exporter.conversion)
+		record.Cells = append(record.Cells, jsonCell{
+			Depth:     cell.Depth,
+			Min:       [2]float64{cell.Region[0].X, cell.Region[0].Y},
+			Max:       [2]float64{cell.Region[1].X, cell.Region[1].Y},
+			TotalMass: cell.TotalMass,
+			Center:    [2]float64{cell.Center.X, cell.Center.Y},
+			Bodies:    cell.Bodies,
+			Leaf:      cell.Leaf,
+		})
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("frame %d: %w", frame, err)
+	}
+	if exporter.frames > 0 {
+		exporter.out.WriteString(",")
+	}
+	exporter.out.WriteString("\n")
+	exporter.out.Write(data)
+	exporter.frames++
+	return exporter.out.Flush()
+}
+
+func (exporter *jsonExporter) Close() error {
+	exporter.out.WriteString("\n]}\n")
+	return closeWriter(exporter.out, exporter.file)
+}
+
+// vtkExporter writes each tree as PolyData with one quad per cell, indexed
+// by a .pvd collection.
+type vtkExporter struct {
+	collection *vtk.Collection
+	conversion utils.Conversion
+}
+
+func (exporter *vtkExporter) WriteTree(frame int, time float64, root *utils.QuadNode) error {
+	cells := Cells(root)
+	n := len(cells)
+	points := make([]float64, 0, 12*n)
+	connectivity := make([]float64, 0, 4*n)
+	offsets := make([]float64, 0, n)
+	depths := make([]float64, 0, n)
+	masses := make([]float64, 0, n)
+	centers := make([]float64, 0, 3*n)
+	bodies := make([]float64, 0, n)
+	leaves := make([]float64, 0, n)
+	for i, cell := range cells {
+		cell = convert(cell, exporter.conversion)
+		low, high := cell.Region[0], cell.Region[1]
+		points = append(points, low.X, low.Y, 0, high.X, low.Y, 0, high.X, high.Y, 0, low.X, high.Y, 0)
+		connectivity = append(connectivity, float64(4*i), float64(4*i+1), float64(4*i+2), float64(4*i+3))
+		offsets = append(offsets, float64(4*i+4))
+		depths = append(depths, float64(cell.Depth))
+		masses = append(masses, cell.TotalMass)
+		centers = append(centers, cell.Center.X, cell.Center.Y, 0)
+		bodies = append(bodies, float64(cell.Bodies))
+		leaf := 0.0
+		if cell.Leaf {
+			leaf = 1
+		}
+		leaves = append(leaves, leaf)
+	}
+
+	path := exporter.collection.Path(frame)
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(file)
+	fmt.Fprintf(out, "<?xml version=\"1.0\"?>\n")
+	fmt.Fprintf(out, "<VTKFile type=\"PolyData\" version=\"1.0\" byte_order=\"LittleEndian\" header_type=\"UInt64\">\n")
+	fmt.Fprintf(out, "  <PolyData>\n")
+	fmt.Fprintf(out, "    <Piece NumberOfPoints=\"%d\" NumberOfVerts=\"0\" NumberOfLines=\"0\" NumberOfStrips=\"0\" NumberOfPolys=\"%d\">\n", 4*n, n)
+	fmt.Fprintf(out, "      <CellData Scalars=\"Depth\">\n")
+	vtk.WriteArray(out, "Int64", "Depth", 1, depths)
+	vtk.WriteArray(out, "Float64", "TotalMass", 1, masses)
+	vtk.WriteArray(out, "Float64", "Center", 3, centers)
+	vtk.WriteArray(out, "Int64", "Bodies", 1, bodies)
+	vtk.WriteArray(out, "Int64", "Leaf", 1, leaves)
+	fmt.Fprintf(out, "      </CellData>\n")
+	fmt.Fprintf(out, "      <Points>\n")
+	vtk.WriteArray(out, "Float64", "Points", 3, points)
+	fmt.Fprintf(out, "      </Points>\n")
+	fmt.Fprintf(out, "      <Polys>\n")
+	vtk.WriteArray(out, "Int64", "connectivity", 1, connectivity)
+	vtk.WriteArray(out, "Int64", "offsets", 1, offsets)
+	fmt.Fprintf(out, "      </Polys>\n")
+	fmt.Fprintf(out, "    </Piece>\n")
+	fmt.Fprintf(out, "  </PolyData>\n")
+	fmt.Fprintf(out, "</VTKFile>\n")
+	if err := closeWriter(out, file); err != nil {
+		return err
+	}
+
+	// Frame f holds the tree after f+1 steps
+	return exporter.collection.Add(time*exporter.conversion.Time, path)
+}
+
+func (exporter *vtkExporter) Close() error {
+	return exporter.collection.Close()
+}
@@ -50,6 +50,8 @@ func childRegion(index int, parentRegion [2]utils.Vector2) [2]utils.Vector2 {
 
 func insertBody(node *utils.QuadNode, body *utils.Body, root *utils.QuadNode) {
 	node.TotalMass += body.Mass
+	node.TotalCharge += body.Charge
+	node.ChargeSum = node.ChargeSum.Add(body.Positions.Multiply(body.Charge))
 	newWeightedX := body.Positions.X * body.Mass
 	newWeightedY := body.Positions.Y * body.Mass
 
@@ -57,6 +59,7 @@ func insertBody(node *utils.QuadNode, body *utils.Body, root *utils.QuadNode) {
 	if node.TotalMass > 0 {
 		node.Center.X = (node.Center.X*(node.TotalMass-body.Mass) + newWeightedX) / node.TotalMass
 		node.Center.Y = (node.Center.Y*(node.TotalMass-body.Mass) + newWeightedY) / node.TotalMass
+		node.Velocity = node.Velocity.Multiply(node.TotalMass - body.Mass).Add(body.Velocities.Multiply(body.Mass)).Multiply(1 / node.TotalMass)
 	}
 
 	if node.IsLeaf() {
@@ -0,0 +1,168 @@
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"proj3-redesigned/snapshot"
+)
+
+// PNGFrames writes each drawn frame of results to directory as
+// frame_000100.png, named by frame number, and returns how many it wrote.
+func PNGFrames(results string, directory string, options Options) (int, error) {
+	s, err := newScene(results, options)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return 0, err
+	}
+	written := 0
+	err = s.scan(results, func(frame snapshot.Frame) error {
+		if !s.advance(frame) {
+			return nil
+		}
+		written++
+		return writePNG(filepath.Join(directory, fmt.Sprintf("frame_%06d.png", frame.Number)), s.draw(frame))
+	})
+	return written, err
+}
+
+// GIF writes the drawn frames of results as an animated GIF that loops
+// forever, and returns how many frames it holds. Frames are encoded as they
+// are drawn, so memory use does not grow with the run.
+func GIF(results string, filename string, options Options) (int, error) {
+	s, err := newScene(results, options)
+	if err != nil {
+		return 0, err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return 0, err
+	}
+	animation := newGIFWriter(file, options.Width, options.Height)
+	written := 0
+	err = s.scan(results, func(frame snapshot.Frame) error {
+		if !s.advance(frame) {
+			return nil
+		}
+		written++
+		return animation.frame(s.draw(frame), options.Delay)
+	})
+	if closeErr := animation.close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return written, err
+}
+
+// Trails draws the whole trajectory of every body, with the bodies at their
+// final positions on top, as one PNG.
+func Trails(results string, filename string, options Options) error {
+	options.Trail = -1
+	s, err := newScene(results, options)
+	if err != nil {
+		return err
+	}
+	s.trail = bright
+	var last snapshot.Frame
+	err = s.scan(results, func(frame snapshot.Frame) error {
+		s.advance(frame)
+		last = frame
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return writePNG(filename, s.draw(last))
+}
+
+func writePNG(filename string, picture image.Image) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(file, picture)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// gifWriter streams an animated GIF. image/gif only encodes whole animations
+// held in memory, so each frame is encoded on its own and its image block,
+// which refers to the shared global palette, is copied out.
+type gifWriter struct {
+	out     *bufio.Writer
+	started bool
+	width   int
+	height  int
+	buffer  bytes.Buffer
+}
+
+func newGIFWriter(out io.Writer, width int, height int) *gifWriter {
+	return &gifWriter{out: bufio.NewWriter(out), width: width, height: height}
+}
+
+// frame appends one image, shown for delay hundredths of a second.
+func (writer *gifWriter) frame(picture *image.Paletted, delay int) error {
+	writer.buffer.Reset()
+	if err := gif.Encode(&writer.buffer, picture, nil); err != nil {
+		return err
+	}
+	data := writer.buffer.Bytes()
+
+	// Header and logical screen descriptor, then the global color table
+	const screen = 6 + 7
+	if len(data) < screen+1 {
+		return errors.New("gif: short frame")
+	}
+	start := screen
+	if flags := data[10]; flags&0x80 != 0 {
+		start += 3 << ((flags & 7) + 1)
+	}
+	if !writer.started {
+		writer.out.Write(data[:6])
+		binary.Write(writer.out, binary.LittleEndian, [2]uint16{uint16(writer.width), uint16(writer.height)})
+		writer.out.Write(data[10:start])
+		// Loop forever
+		writer.out.Write([]byte{0x21, 0xFF, 0x0B})
+		writer.out.WriteString("NETSCAPE2.0")
+		writer.out.Write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+		writer.started = true
+	}
+
+	// Graphic control extension with the delay, then the image block without
+	// the trailer
+	writer.out.Write([]byte{0x21, 0xF9, 0x04, 0x00, byte(delay), byte(delay >> 8), 0x00, 0x00})
+	for start < len(data) && data[start] == 0x21 {
+		// Skip any extension the encoder wrote, block by block
+		start += 2
+		for start < len(data) && data[start] != 0 {
+			start += int(data[start]) + 1
+		}
+		start++
+	}
+	if start >= len(data) || data[start] != 0x2C {
+		return errors.New("gif: unexpected frame layout")
+	}
+	_, err := writer.out.Write(data[start : len(data)-1])
+	return err
+}
+
+func (writer *gifWriter) close() error {
+	if writer.started {
+		writer.out.WriteByte(0x3B)
+	}
+	return writer.out.Flush()
+}
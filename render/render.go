@@ -0,0 +1,467 @@
+// This package draws the results of a run as images, using only the standard
+// library: a PNG per frame, an animated GIF, or one PNG of every body's whole
+// trajectory. It reads any results file the engines write, through
+// snapshot.Scan. Bodies are discs coloured per body, by mass or by speed, and
+// may leave fading trails behind them.
+
+package render
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"proj3-redesigned/snapshot"
+	"proj3-redesigned/utils"
+	"strconv"
+	"strings"
+)
+
+// Options control how frames are drawn.
+type Options struct {
+	Width  int     // Image size in pixels
+	Height int     //
+	Bounds *Bounds // Region shown before zoom and pan; nil fits every position of the run
+	Zoom   float64 // Magnification about the centre of the view, 1 for none
+	Pan    utils.Vector2
+	Color  string             // body, mass or speed
+	Masses map[string]float64 // Mass of each body by name, for colouring by mass
+	Trail  int                // Frames of trail behind each body, -1 for the whole run
+	Radius int                // Radius of a body in pixels
+	Every  int                // Draw every k-th frame of the file
+	Delay  int                // Time between GIF frames, in hundredths of a second
+	First  int                // First frame number drawn
+	Last   int                // Last frame number drawn, -1 for the end of the run
+	Tree   int                // Frame whose quadtree an SVG overlays, -1 for none
+}
+
+// DefaultOptions returns 640x640 images of discs of radius 2, coloured per
+// body, with 50-frame trails and no zoom.
+func DefaultOptions() Options {
+	return Options{Width: 640, Height: 640, Zoom: 1, Color: "body", Trail: 50, Radius: 2, Every: 1, Delay: 4, Last: -1, Tree: -1}
+}
+
+// Bounds is a rectangle of the simulation plane.
+type Bounds struct {
+	Min utils.Vector2
+	Max utils.Vector2
+}
+
+// ParseBounds reads bounds written as minX,minY,maxX,maxY.
+func ParseBounds(text string) (*Bounds, error) {
+	fields := strings.Split(text, ",")
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("bounds %q: want minX,minY,maxX,maxY", text)
+	}
+	values := make([]float64, 4)
+	for i, field := range fields {
+		value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bounds %q: %q is not a number", text, field)
+		}
+		values[i] = value
+	}
+	bounds := &Bounds{Min: utils.Vector2{X: values[0], Y: values[1]}, Max: utils.Vector2{X: values[2], Y: values[3]}}
+	if bounds.Max.X <= bounds.Min.X || bounds.Max.Y <= bounds.Min.Y {
+		return nil, fmt.Errorf("bounds %q: the maximum must exceed the minimum", text)
+	}
+	return bounds, nil
+}
+
+// ParsePoint reads a point written as x,y.
+func ParsePoint(text string) (utils.Vector2, error) {
+	fields := strings.Split(text, ",")
+	if len(fields) != 2 {
+		return utils.Vector2{}, fmt.Errorf("point %q: want x,y", text)
+	}
+	x, errX := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64)
+	y, errY := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+	if errX != nil || errY != nil {
+		return utils.Vector2{}, fmt.Errorf("point %q: want two numbers", text)
+	}
+	return utils.Vector2{X: x, Y: y}, nil
+}
+
+func (options Options) validate() error {
+	switch {
+	case options.Width <= 0 || options.Height <= 0:
+		return errors.New("the image size must be positive")
+	case options.Zoom <= 0:
+		return errors.New("zoom must be positive")
+	case options.Radius < 0:
+		return errors.New("radius cannot be negative")
+	case options.Every < 1:
+		return errors.New("every must be at least 1")
+	case options.Trail < -1:
+		return errors.New("trail must be a number of frames, or -1 for the whole run")
+	case options.Delay < 0:
+		return errors.New("delay cannot be negative")
+	case options.First < 0:
+		return errors.New("the first frame cannot be negative")
+	case options.Last >= 0 && options.Last < options.First:
+		return errors.New("the last frame comes before the first")
+	}
+	switch options.Color {
+	case "body", "speed":
+	case "mass":
+		if len(options.Masses) == 0 {
+			return errors.New("colouring by mass needs the masses of the bodies")
+		}
+	default:
+		return fmt.Errorf("unknown colouring %q (want body, mass or speed)", options.Color)
+	}
+	return nil
+}
+
+// The palette holds a background, a gradient at full brightness for bodies,
+// the same gradient dimmed for trails, and grey for bodies without a colour.
+const (
+	background = 0
+	steps      = 127
+	bright     = 1
+	dim        = bright + steps
+	grey       = dim + steps
+)
+
+var gradient = []color.RGBA{
+	{60, 80, 230, 255},
+	{40, 190, 230, 255},
+	{80, 220, 90, 255},
+	{240, 220, 50, 255},
+	{240, 130, 40, 255},
+	{220, 40, 60, 255},
+}
+
+var palette = newPalette()
+
+func newPalette() color.Palette {
+	base := color.RGBA{10, 10, 20, 255}
+	colors := make(color.Palette, grey+1)
+	colors[background] = base
+	for i := 0; i < steps; i++ {
+		position := float64(i) / (steps - 1) * float64(len(gradient)-1)
+		low := int(position)
+		if low >= len(gradient)-1 {
+			low = len(gradient) - 2
+		}
+		t := position - float64(low)
+		mix := func(a, b uint8, t float64) uint8 { return uint8(float64(a) + (float64(b)-float64(a))*t + 0.5) }
+		c := gradient[low]
+		next := gradient[low+1]
+		full := color.RGBA{mix(c.R, next.R, t), mix(c.G, next.G, t), mix(c.B, next.B, t), 255}
+		colors[bright+i] = full
+		colors[dim+i] = color.RGBA{mix(base.R, full.R, 0.45), mix(base.G, full.G, 0.45), mix(base.B, full.B, 0.45), 255}
+	}
+	colors[grey] = color.RGBA{150, 150, 150, 255}
+	return colors
+}
+
+// scene draws the frames of one results file.
+type scene struct {
+	options  Options
+	center   utils.Vector2
+	scale    float64 // Pixels per unit of length
+	position []int   // Columns of PosX and PosY
+	velocity []int   // Columns of VelX and VelY, -1 if absent
+	speeds   [2]float64
+	masses   [2]float64 // Range of log10 mass
+	ids      map[string]int
+
+	frames  int                        // Frames seen so far
+	history map[string][]utils.Vector2 // Recent positions of each body, for finite trails
+	last    map[string]utils.Vector2   // Previous position of each body, for whole-run trails
+	trails  *image.Paletted            // Whole-run trails drawn so far
+	trail   int                        // Palette base of trails: dim, or bright for a trajectory plot
+	image   *image.Paletted
+}
+
+// newScene reads the results once to fit the view and the colour scale.
+func newScene(results string, options Options) (*scene, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	s := &scene{
+		options: options,
+		ids:     map[string]int{},
+		history: map[string][]utils.Vector2{},
+		last:    map[string]utils.Vector2{},
+		speeds:  [2]float64{math.Inf(1), math.Inf(-1)},
+		trail:   dim,
+	}
+	bounds := Bounds{
+		Min: utils.Vector2{X: math.Inf(1), Y: math.Inf(1)},
+		Max: utils.Vector2{X: math.Inf(-1), Y: math.Inf(-1)},
+	}
+	err := snapshot.Scan(results, func(header snapshot.Header, frame snapshot.Frame) error {
+		if s.position == nil {
+			s.position = snapshot.Columns(header, "PosX", "PosY")
+			s.velocity = snapshot.Columns(header, "VelX", "VelY")
+			if s.position[0] < 0 || s.position[1] < 0 {
+				return errors.New("the results have no PosX and PosY columns")
+			}
+			if options.Color == "speed" && (s.velocity[0] < 0 || s.velocity[1] < 0) {
+				return errors.New("colouring by speed needs the VelX and VelY columns")
+			}
+			if options.Bounds != nil && options.Color != "speed" {
+				return snapshot.ErrStop // Nothing more to learn from the file
+			}
+		}
+		if frame.Number < options.First {
+			return nil
+		}
+		if options.Last >= 0 && frame.Number > options.Last {
+			return snapshot.ErrStop
+		}
+		for _, record := range frame.Records {
+			position := s.point(record, s.position)
+			if finite(position) {
+				bounds.Min = utils.Vector2{X: math.Min(bounds.Min.X, position.X), Y: math.Min(bounds.Min.Y, position.Y)}
+				bounds.Max = utils.Vector2{X: math.Max(bounds.Max.X, position.X), Y: math.Max(bounds.Max.Y, position.Y)}
+			}
+			if options.Color == "speed" {
+				if speed := s.point(record, s.velocity).Magnitude(); !math.IsNaN(speed) && !math.IsInf(speed, 0) {
+					s.speeds = [2]float64{math.Min(s.speeds[0], speed), math.Max(s.speeds[1], speed)}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s.position == nil {
+		return nil, fmt.Errorf("%s: no frames", results)
+	}
+	if bounds.Max.X < bounds.Min.X && options.Bounds == nil && options.First > 0 {
+		return nil, fmt.Errorf("%s: no frames from %d on", results, options.First)
+	}
+
+	if options.Bounds != nil {
+		bounds = *options.Bounds
+	} else if bounds.Max.X < bounds.Min.X {
+		bounds = Bounds{Max: utils.Vector2{X: 1, Y: 1}} // No finite positions at all
+	}
+	// Equal scales on both axes, with a margin around fitted bounds
+	width := bounds.Max.X - bounds.Min.X
+	height := bounds.Max.Y - bounds.Min.Y
+	if options.Bounds == nil {
+		width, height = width*1.1, height*1.1
+	}
+	span := math.Max(width/float64(options.Width), height/float64(options.Height))
+	if span == 0 {
+		span = 1 / float64(options.Width) // A single point: show a unit square around it
+	}
+	s.scale = options.Zoom / span
+	s.center = bounds.Min.Add(bounds.Max).Multiply(0.5).Add(options.Pan)
+
+	s.masses = [2]float64{math.Inf(1), math.Inf(-1)}
+	for _, mass := range options.Masses {
+		if mass > 0 {
+			s.masses = [2]float64{math.Min(s.masses[0], math.Log10(mass)), math.Max(s.masses[1], math.Log10(mass))}
+		}
+	}
+
+	rectangle := image.Rect(0, 0, options.Width, options.Height)
+	s.image = image.NewPaletted(rectangle, palette)
+	if options.Trail < 0 {
+		s.trails = image.NewPaletted(rectangle, palette)
+	}
+	return s, nil
+}
+
+func finite(point utils.Vector2) bool {
+	return !math.IsNaN(point.X) && !math.IsNaN(point.Y) && !math.IsInf(point.X, 0) && !math.IsInf(point.Y, 0)
+}
+
+func (s *scene) point(record snapshot.Record, columns []int) utils.Vector2 {
+	if columns[0] < 0 || columns[1] < 0 {
+		return utils.Vector2{X: math.NaN(), Y: math.NaN()}
+	}
+	return utils.Vector2{X: record.Values[columns[0]], Y: record.Values[columns[1]]}
+}
+
+// scan calls visit with the frames of results in the frame range.
+func (s *scene) scan(results string, visit func(frame snapshot.Frame) error) error {
+	return snapshot.Scan(results, func(header snapshot.Header, frame snapshot.Frame) error {
+		if frame.Number < s.options.First {
+			return nil
+		}
+		if s.options.Last >= 0 && frame.Number > s.options.Last {
+			return snapshot.ErrStop // Frames are in order
+		}
+		return visit(frame)
+	})
+}
+
+// project returns where a position falls on the image, in pixels.
+func (s *scene) project(position utils.Vector2) (float64, float64) {
+	x := float64(s.options.Width)/2 + (position.X-s.center.X)*s.scale
+	y := float64(s.options.Height)/2 - (position.Y-s.center.Y)*s.scale
+	return x, y
+}
+
+// pixel returns the pixel a position is drawn at.
+func (s *scene) pixel(position utils.Vector2) (int, int) {
+	x, y := s.project(position)
+	return int(math.Floor(x)), int(math.Floor(y))
+}
+
+// shade returns the gradient step of a body, -1 for grey.
+func (s *scene) shade(record snapshot.Record) int {
+	scale := func(value, low, high float64) int {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return -1
+		}
+		if high <= low {
+			return steps / 2
+		}
+		t := math.Max(0, math.Min(1, (value-low)/(high-low)))
+		return int(t * (steps - 1))
+	}
+	switch s.options.Color {
+	case "mass":
+		mass, ok := s.options.Masses[record.Name]
+		if !ok || mass <= 0 {
+			return -1
+		}
+		return scale(math.Log10(mass), s.masses[0], s.masses[1])
+	case "speed":
+		return scale(s.point(record, s.velocity).Magnitude(), s.speeds[0], s.speeds[1])
+	}
+	id, ok := s.ids[record.Name]
+	if !ok {
+		id = len(s.ids)
+		s.ids[record.Name] = id
+	}
+	// Golden-ratio steps spread neighbouring bodies over the gradient
+	return int(math.Mod(float64(id)*0.6180339887, 1) * (steps - 1))
+}
+
+func index(base int, shade int) uint8 {
+	if shade < 0 {
+		return grey
+	}
+	return uint8(base + shade)
+}
+
+// advance takes in the next frame of the file, reporting whether it is one
+// to draw. Trails follow every frame, drawn or not.
+func (s *scene) advance(frame snapshot.Frame) bool {
+	present := map[string]bool{}
+	for _, record := range frame.Records {
+		position := s.point(record, s.position)
+		if !finite(position) {
+			continue
+		}
+		present[record.Name] = true
+		if s.trails != nil {
+			if previous, ok := s.last[record.Name]; ok {
+				s.line(s.trails, previous, position, index(s.trail, s.shade(record)))
+			}
+			s.last[record.Name] = position
+		} else if s.options.Trail > 0 {
+			history := append(s.history[record.Name], position)
+			if len(history) > s.options.Trail+1 {
+				history = history[len(history)-s.options.Trail-1:]
+			}
+			s.history[record.Name] = history
+		}
+	}
+	// Bodies that are gone, such as escapers, leave no trail behind
+	for name := range s.history {
+		if !present[name] {
+			delete(s.history, name)
+		}
+	}
+	s.frames++
+	return (s.frames-1)%s.options.Every == 0
+}
+
+// draw renders the bodies of frame over their trails.
+func (s *scene) draw(frame snapshot.Frame) *image.Paletted {
+	if s.trails != nil {
+		copy(s.image.Pix, s.trails.Pix)
+	} else {
+		for i := range s.image.Pix {
+			s.image.Pix[i] = background
+		}
+	}
+
+	shades := make(map[string]int, len(frame.Records))
+	for _, record := range frame.Records {
+		shades[record.Name] = s.shade(record)
+	}
+	for name, history := range s.history {
+		for i := 1; i < len(history); i++ {
+			s.line(s.image, history[i-1], history[i], index(s.trail, shades[name]))
+		}
+	}
+	for _, record := range frame.Records {
+		if position := s.point(record, s.position); finite(position) {
+			s.disc(position, index(bright, shades[record.Name]))
+		}
+	}
+	return s.image
+}
+
+func (s *scene) disc(position utils.Vector2, color uint8) {
+	cx, cy := s.pixel(position)
+	r := s.options.Radius
+	for dy := -r; dy <= r; dy++ {
+		for dx := -r; dx <= r; dx++ {
+			if dx*dx+dy*dy <= r*r+r {
+				s.set(s.image, cx+dx, cy+dy, color)
+			}
+		}
+	}
+}
+
+// line draws a segment between two positions. Segments longer than half the
+// image are jumps, such as a body wrapping around a periodic box, and are
+// left out.
+func (s *scene) line(target *image.Paletted, from utils.Vector2, to utils.Vector2, color uint8) {
+	x0, y0 := s.pixel(from)
+	x1, y1 := s.pixel(to)
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	if dx > s.options.Width/2 || -dy > s.options.Height/2 {
+		return
+	}
+	stepX, stepY := 1, 1
+	if x0 > x1 {
+		stepX = -1
+	}
+	if y0 > y1 {
+		stepY = -1
+	}
+	// Bresenham's algorithm
+	err := dx + dy
+	for {
+		s.set(target, x0, y0, color)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		double := 2 * err
+		if double >= dy {
+			err += dy
+			x0 += stepX
+		}
+		if double <= dx {
+			err += dx
+			y0 += stepY
+		}
+	}
+}
+
+func (s *scene) set(target *image.Paletted, x int, y int, color uint8) {
+	if x >= 0 && y >= 0 && x < s.options.Width && y < s.options.Height {
+		target.Pix[y*target.Stride+x] = color
+	}
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
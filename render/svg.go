@@ -0,0 +1,206 @@
+package render
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image/color"
+	"math"
+	"os"
+	"proj3-redesigned/quadtree"
+	"proj3-redesigned/snapshot"
+	"proj3-redesigned/utils"
+	"strconv"
+)
+
+// SVG draws the trajectory of every body over the frame range as vector
+// paths, with a hollow circle where each body starts and a disc where it
+// ends. With options.Tree set, the cells of a quadtree rebuilt from the
+// positions of that frame are drawn underneath, an approximation of the
+// engines' tree.
+func SVG(results string, filename string, options Options) error {
+	options.Trail = 0 // The paths are the trails
+	s, err := newScene(results, options)
+	if err != nil {
+		return err
+	}
+
+	// Paths are kept in order of first appearance, so the output is stable
+	var names []string
+	paths := map[string][]utils.Vector2{}
+	shades := map[string]int{}
+	add := func(frame snapshot.Frame) {
+		for _, record := range frame.Records {
+			if _, ok := paths[record.Name]; !ok {
+				names = append(names, record.Name)
+			}
+			paths[record.Name] = append(paths[record.Name], s.point(record, s.position))
+			shades[record.Name] = s.shade(record)
+		}
+	}
+	var tree []*utils.Body
+	var last snapshot.Frame
+	drawn := false
+	err = s.scan(results, func(frame snapshot.Frame) error {
+		if frame.Number == options.Tree {
+			tree = treeBodies(s, frame)
+		}
+		if drawn = s.advance(frame); drawn {
+			add(frame)
+		}
+		last = frame
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !drawn {
+		add(last) // Paths always end at the last frame of the range
+	}
+	if options.Tree >= 0 && tree == nil {
+		return fmt.Errorf("%s: no frame %d in the frame range to build the quadtree from", results, options.Tree)
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(file)
+	fmt.Fprintf(out, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n",
+		options.Width, options.Height, options.Width, options.Height)
+	fmt.Fprintf(out, "  <rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", hex(palette[background]))
+
+	if tree != nil {
+		s.writeTree(out, tree)
+	}
+
+	fmt.Fprintf(out, "  <g fill=\"none\" stroke-width=\"1\" stroke-linejoin=\"round\">\n")
+	for _, name := range names {
+		s.writePath(out, name, paths[name], hex(s.color(bright, shades[name])))
+	}
+	fmt.Fprintf(out, "  </g>\n")
+
+	// Markers go on top of every path
+	fmt.Fprintf(out, "  <g stroke-width=\"1\">\n")
+	radius := math.Max(float64(options.Radius), 1)
+	for _, name := range names {
+		path := paths[name]
+		stroke := hex(s.color(bright, shades[name]))
+		if first, ok := firstFinite(path, 1); ok {
+			x, y := s.project(first)
+			fmt.Fprintf(out, "    <circle cx=\"%s\" cy=\"%s\" r=\"%s\" fill=\"none\" stroke=\"%s\"/>\n", coordinate(x), coordinate(y), coordinate(radius), stroke)
+		}
+		if last, ok := firstFinite(path, -1); ok {
+			x, y := s.project(last)
+			fmt.Fprintf(out, "    <circle cx=\"%s\" cy=\"%s\" r=\"%s\" fill=\"%s\" stroke=\"none\"><title>%s</title></circle>\n",
+				coordinate(x), coordinate(y), coordinate(radius), stroke, html.EscapeString(name))
+		}
+	}
+	fmt.Fprintf(out, "  </g>\n")
+	fmt.Fprintf(out, "</svg>\n")
+
+	err = out.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// treeBodies returns the bodies of a frame to build a quadtree from.
+func treeBodies(s *scene, frame snapshot.Frame) []*utils.Body {
+	bodies := []*utils.Body{}
+	for _, record := range frame.Records {
+		if position := s.point(record, s.position); finite(position) {
+			bodies = append(bodies, &utils.Body{Name: record.Name, Positions: position, Mass: 1})
+		}
+	}
+	return bodies
+}
+
+// writeTree draws the cells of a quadtree over bodies. The root is the
+// bounds of the bodies padded by 1, like the engines' open-domain tree, but
+// the written positions may be rounded, filtered by -bodies or converted to
+// other units, and a periodic box is not known here, so the cells only
+// approximate those the engines built. -tree exports the exact ones.
+func (s *scene) writeTree(out *bufio.Writer, bodies []*utils.Body) {
+	if len(bodies) == 0 {
+		return
+	}
+	low, high := bodies[0].Positions, bodies[0].Positions
+	for _, body := range bodies {
+		low = utils.Vector2{X: math.Min(low.X, body.Positions.X), Y: math.Min(low.Y, body.Positions.Y)}
+		high = utils.Vector2{X: math.Max(high.X, body.Positions.X), Y: math.Max(high.Y, body.Positions.Y)}
+	}
+	padding := utils.Vector2{X: 1, Y: 1}
+	root := quadtree.BuildQuadTree(bodies, [2]utils.Vector2{low.Subtract(padding), high.Add(padding)})
+
+	fmt.Fprintf(out, "  <g fill=\"none\" stroke=\"%s\" stroke-width=\"0.5\" stroke-opacity=\"0.6\">\n", hex(palette[grey]))
+	for _, cell := range quadtree.Cells(root) {
+		x0, y0 := s.project(cell.Region[0])
+		x1, y1 := s.project(cell.Region[1])
+		fmt.Fprintf(out, "    <rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\"/>\n",
+			coordinate(x0), coordinate(y1), coordinate(x1-x0), coordinate(y0-y1))
+	}
+	fmt.Fprintf(out, "  </g>\n")
+}
+
+// writePath draws a trajectory as polylines, broken where a position is not
+// finite or where the body jumps by more than half the image.
+func (s *scene) writePath(out *bufio.Writer, name string, path []utils.Vector2, stroke string) {
+	var points []byte
+	count := 0
+	flush := func() {
+		if count > 1 {
+			fmt.Fprintf(out, "    <polyline stroke=\"%s\" points=\"%s\"><title>%s</title></polyline>\n", stroke, points, html.EscapeString(name))
+		}
+		points, count = points[:0], 0
+	}
+	var previousX, previousY float64
+	for _, position := range path {
+		if !finite(position) {
+			flush()
+			continue
+		}
+		x, y := s.project(position)
+		if count > 0 && (math.Abs(x-previousX) > float64(s.options.Width)/2 || math.Abs(y-previousY) > float64(s.options.Height)/2) {
+			flush()
+		}
+		if count > 0 {
+			points = append(points, ' ')
+		}
+		points = strconv.AppendFloat(points, x, 'f', 1, 64)
+		points = append(points, ',')
+		points = strconv.AppendFloat(points, y, 'f', 1, 64)
+		previousX, previousY = x, y
+		count++
+	}
+	flush()
+}
+
+// color returns the palette colour of a shade.
+func (s *scene) color(base int, shade int) color.Color {
+	return palette[index(base, shade)]
+}
+
+// firstFinite returns the first finite point of path, or the last when
+// direction is -1.
+func firstFinite(path []utils.Vector2, direction int) (utils.Vector2, bool) {
+	for i := range path {
+		if direction < 0 {
+			i = len(path) - 1 - i
+		}
+		if finite(path[i]) {
+			return path[i], true
+		}
+	}
+	return utils.Vector2{}, false
+}
+
+func coordinate(value float64) string {
+	return strconv.FormatFloat(value, 'f', 1, 64)
+}
+
+func hex(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
@@ -0,0 +1,234 @@
+// This package reads scenario files, which describe a whole run in JSON or
+// YAML: where the bodies come from (a dataset, an inline list or a
+// generator), the physics, the engine and the output. Files are checked
+// against a schema before use, and every problem is reported with the path
+// of the offending value.
+
+package scenario
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Scenario is a validated scenario file. Exactly one of Input, Bodies and
+// Generator is set.
+type Scenario struct {
+	Input     string     `json:"input"`
+	Bodies    []Body     `json:"bodies"`
+	Generator *Generator `json:"generator"`
+	Frames    int        `json:"frames"` // 0 to keep the dataset's
+	Units     string     `json:"units"`
+	Physics   Physics    `json:"physics"`
+	Engine    Engine     `json:"engine"`
+	Output    Output     `json:"output"`
+
+	// Set holds the keys of the physics section present in the file, so that
+	// they can take precedence over a dataset's header.
+	Set map[string]bool `json:"-"`
+}
+
+type Body struct {
+	Name     string     `json:"name"`
+	Position [2]float64 `json:"position"`
+	Velocity [2]float64 `json:"velocity"`
+	Mass     float64    `json:"mass"`
+	Charge   float64    `json:"charge"`
+}
+
+type Generator struct {
+	Model       string  `json:"model"`
+	N           int     `json:"n"`
+	Mass        float64 `json:"mass"`
+	Radius      float64 `json:"radius"`
+	CentralMass float64 `json:"central_mass"`
+	Seed        int64   `json:"seed"`
+}
+
+type Physics struct {
+	Dt           float64 `json:"dt"`
+	Theta        float64 `json:"theta"`
+	Force        string  `json:"force"`
+	Softening    float64 `json:"softening"`
+	Screening    float64 `json:"screening"`
+	CoulombK     float64 `json:"coulomb_k"`
+	A0           float64 `json:"a0"`
+	Power        float64 `json:"power"`
+	Integrator   string  `json:"integrator"`
+	Box          float64 `json:"box"`
+	Ewald        bool    `json:"ewald"`
+	Boundary     string  `json:"boundary"`
+	Radius       float64 `json:"radius"`
+	BinaryRadius float64 `json:"binary_radius"`
+	PN           *PN     `json:"pn"`
+}
+
+type PN struct {
+	C         float64 `json:"c"`
+	Radius    float64 `json:"radius"`
+	Radiation bool    `json:"radiation"`
+}
+
+type Engine struct {
+	Mode    string `json:"mode"`    // sequential, parallel or workqueue
+	Workers int    `json:"workers"` // 0 for one per CPU
+}
+
+type Output struct {
+	File   string   `json:"file"`
+	Files  []string `json:"files"`  // More results files, all written at once
+	Format string   `json:"format"` // Format of the default results file when no file is given
+	Units  string   `json:"units"`
+
+	Every    int      `json:"every"`
+	Interval float64  `json:"interval"`
+	Columns  []string `json:"columns"`
+	Bodies   []string `json:"bodies"` // Shell patterns of body names
+	Flush    int      `json:"flush"`
+	Buffer   int      `json:"buffer"` // Frames queued for the writer goroutine
+	Tree     string   `json:"tree"`   // File the quadtree of each written frame is exported to
+}
+
+// defaults returns a scenario with the same defaults as the command-line flags.
+func defaults() Scenario {
+	return Scenario{
+		Physics: Physics{
+			Dt:         0.01,
+			Theta:      0.5,
+			Force:      "newton",
+			CoulombK:   8.9875517923e9,
+			A0:         1.2e-10,
+			Power:      2,
+			Integrator: "leapfrog",
+			Ewald:      true,
+		},
+		Engine: Engine{Mode: "sequential"},
+		Output: Output{Every: 1, Flush: 1, Buffer: 8},
+	}
+}
+
+// Load reads a scenario file, choosing JSON or YAML by its extension.
+func Load(filename string) (*Scenario, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var format string
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		format = "json"
+	case ".yaml", ".yml":
+		format = "yaml"
+	default:
+		return nil, fmt.Errorf("%s: scenario files must end in .json, .yaml or .yml", filename)
+	}
+	scenario, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return scenario, nil
+}
+
+// Parse reads and validates a scenario in the given format, json or yaml.
+func Parse(data []byte, format string) (*Scenario, error) {
+	var document any
+	switch format {
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		if err := decoder.Decode(&document); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	case "yaml":
+		var err error
+		if document, err = parseYAML(data); err != nil {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown scenario format %q", format)
+	}
+
+	var problems []string
+	scenarioSchema.validate("", document, &problems)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	// The document now has the right shape, so it decodes cleanly
+	scenario := defaults()
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(encoded, &scenario); err != nil {
+		return nil, err
+	}
+	scenario.Set = map[string]bool{}
+	if physics, ok := document.(map[string]any)["physics"].(map[string]any); ok {
+		for key := range physics {
+			scenario.Set[key] = true
+		}
+	}
+
+	if problems := scenario.check(); len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return &scenario, nil
+}
+
+// check reports the problems the schema cannot express, which involve more
+// than one value.
+func (scenario *Scenario) check() []string {
+	var problems []string
+
+	sources := 0
+	for _, set := range []bool{scenario.Input != "", scenario.Bodies != nil, scenario.Generator != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		problems = append(problems, "scenario: exactly one of \"input\", \"bodies\" and \"generator\" must be given")
+	}
+	if scenario.Input == "" && scenario.Frames == 0 {
+		problems = append(problems, "frames: required unless the bodies come from a dataset")
+	}
+	if scenario.Bodies != nil && len(scenario.Bodies) == 0 {
+		problems = append(problems, "bodies: at least one body is needed")
+	}
+
+	physics := scenario.Physics
+	if physics.Force == "softened" && !scenario.Set["softening"] {
+		problems = append(problems, "physics.softening: required by the softened force law")
+	}
+	if physics.Force == "yukawa" && !scenario.Set["screening"] {
+		problems = append(problems, "physics.screening: required by the yukawa force law")
+	}
+	if physics.Boundary != "" && physics.Boundary != "unbound" && !scenario.Set["radius"] {
+		problems = append(problems, fmt.Sprintf("physics.radius: required by the %s boundary policy", physics.Boundary))
+	}
+	if physics.Box > 0 && physics.Boundary != "" {
+		problems = append(problems, "physics.boundary: cannot be combined with a periodic box")
+	}
+	if scenario.Engine.Mode == "sequential" && scenario.Engine.Workers > 0 {
+		problems = append(problems, "engine.workers: the sequential engine has no workers")
+	}
+	if scenario.Output.Every > 1 && scenario.Output.Interval > 0 {
+		problems = append(problems, "output.interval: cannot be combined with output.every")
+	}
+	if scenario.Units == "henon" && scenario.Output.Units != "" && scenario.Output.Units != "henon" {
+		problems = append(problems, "output.units: henon input has no physical scale and can only be written in henon units")
+	}
+	return problems
+}
+
+// Schema returns the scenario schema as a JSON Schema document.
+func Schema() map[string]any {
+	document := scenarioSchema.JSONSchema()
+	document["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	document["title"] = "n-body scenario"
+	return document
+}
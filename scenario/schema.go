@@ -0,0 +1,284 @@
+package scenario
+
+import (
+	"fmt"
+	"math"
+	"proj3-redesigned/generate"
+	"sort"
+	"strings"
+)
+
+// schema describes the allowed shape of one value of a scenario, in the
+// spirit of JSON Schema. It is kept small: objects with known properties,
+// fixed-length arrays, and typed scalars with an optional enum or lower bound.
+type schema struct {
+	kind        string // object, array, string, number, integer or boolean
+	description string
+	properties  map[string]*schema
+	required    []string
+	items       *schema
+	length      int      // Exact array length, 0 for any
+	enum        []string // Allowed strings, nil for any
+	positive    bool     // Numbers must be > 0
+	nonNegative bool     // Numbers must be >= 0
+}
+
+func object(description string, properties map[string]*schema, required ...string) *schema {
+	return &schema{kind: "object", description: description, properties: properties, required: required}
+}
+
+func arrayOf(description string, items *schema) *schema {
+	return &schema{kind: "array", description: description, items: items}
+}
+
+func vector(description string) *schema {
+	return &schema{kind: "array", description: description, items: number(""), length: 2}
+}
+
+func str(description string, enum ...string) *schema {
+	return &schema{kind: "string", description: description, enum: enum}
+}
+
+func number(description string) *schema {
+	return &schema{kind: "number", description: description}
+}
+
+func positive(description string) *schema {
+	return &schema{kind: "number", description: description, positive: true}
+}
+
+func nonNegative(description string) *schema {
+	return &schema{kind: "number", description: description, nonNegative: true}
+}
+
+func integer(description string) *schema {
+	return &schema{kind: "integer", description: description, positive: true}
+}
+
+func boolean(description string) *schema {
+	return &schema{kind: "boolean", description: description}
+}
+
+// scenarioSchema is the schema every scenario file is checked against.
+var scenarioSchema = object("An n-body run", map[string]*schema{
+	"input": str("name of a dataset in simulation/data, without .csv"),
+	"bodies": arrayOf("bodies given inline", object("a body", map[string]*schema{
+		"name":     str("body name"),
+		"position": vector("[x, y]"),
+		"velocity": vector("[vx, vy]"),
+		"mass":     positive("mass"),
+		"charge":   number("charge"),
+	}, "name", "position", "velocity", "mass")),
+	"generator": object("a generated model", map[string]*schema{
+		"model":        str("model name", generate.Models...),
+		"n":            integer("number of bodies"),
+		"mass":         positive("total mass"),
+		"radius":       positive("scale radius"),
+		"central_mass": positive("mass of the central body of the kepler model"),
+		"seed":         {kind: "integer", description: "random seed"},
+	}, "model"),
+	"frames": integer("number of frames; overrides the dataset's"),
+	"units":  str("unit system of the bodies", "si", "au", "kpc", "henon"),
+	"physics": object("force law, integrator and domain", map[string]*schema{
+		"dt":            positive("time step size"),
+		"theta":         nonNegative("Barnes-Hut opening angle"),
+		"force":         str("pairwise force law", "newton", "softened", "yukawa", "coulomb", "electrogravity", "mond", "power"),
+		"softening":     positive("softening length of the softened force law"),
+		"screening":     positive("screening length of the yukawa force law"),
+		"coulomb_k":     positive("Coulomb constant"),
+		"a0":            positive("acceleration scale of the mond force law"),
+		"power":         positive("exponent of the power force law"),
+		"integrator":    str("integrator", "leapfrog", "wh", "hermite"),
+		"box":           positive("side length of a periodic box centred on the origin"),
+		"ewald":         boolean("apply the Ewald correction in a periodic box"),
+		"boundary":      str("boundary policy of an open domain", "remove", "unbound", "reflect", "absorb"),
+		"radius":        positive("radius of the boundary policy"),
+		"binary_radius": positive("regularize bound pairs closer than this"),
+		"pn": object("post-Newtonian corrections", map[string]*schema{
+			"c":         positive("speed of light"),
+			"radius":    positive("pairs closer than this are corrected"),
+			"radiation": boolean("add the 2.5PN radiation-reaction term"),
+		}, "c", "radius"),
+	}),
+	"engine": object("how the run is executed", map[string]*schema{
+		"mode":    str("engine", "sequential", "parallel", "workqueue"),
+		"workers": integer("number of worker goroutines"),
+	}),
+	"output": object("where results go", map[string]*schema{
+		"file":     str("results file"),
+		"files":    arrayOf("more results files, all written at once", str("results file")),
+		"format":   str("results format; by default binary for .nbs files and csv otherwise", "csv", "binary", "jsonl", "vtk"),
+		"units":    str("unit system of the output columns", "si", "au", "kpc", "henon"),
+		"every":    integer("write every k-th frame"),
+		"interval": positive("write once per this much simulated time"),
+		"columns":  arrayOf("value columns to write", str("column", "PosX", "PosY", "VelX", "VelY", "ForceX", "ForceY")),
+		"bodies":   arrayOf("shell patterns of the body names to write", str("pattern")),
+		"flush":    {kind: "integer", description: "flush after this many written frames, 0 only at the end", nonNegative: true},
+		"buffer":   {kind: "integer", description: "frames queued for the output goroutine, 0 to write on the engine's goroutine", nonNegative: true},
+		"tree":     str("file the quadtree of each written frame is exported to: .csv, .json or .pvd"),
+	}),
+})
+
+// ValidationError lists every problem found in a scenario.
+type ValidationError struct {
+	Problems []string
+}
+
+func (err *ValidationError) Error() string {
+	return "invalid scenario:\n  " + strings.Join(err.Problems, "\n  ")
+}
+
+// validate checks value against s and appends a message per problem, each
+// prefixed with the path of the offending value.
+func (s *schema) validate(path string, value any, problems *[]string) {
+	report := func(format string, args ...any) {
+		name := path
+		if name == "" {
+			name = "scenario"
+		}
+		*problems = append(*problems, fmt.Sprintf("%s: %s", name, fmt.Sprintf(format, args...)))
+	}
+
+	switch s.kind {
+	case "object":
+		entries, ok := value.(map[string]any)
+		if !ok {
+			report("expected an object, found %s", describe(value))
+			return
+		}
+		for _, key := range sortedKeys(entries) {
+			property, known := s.properties[key]
+			if !known {
+				report("unknown key %q (expected one of %s)", key, strings.Join(sortedKeys(s.properties), ", "))
+				continue
+			}
+			property.validate(join(path, key), entries[key], problems)
+		}
+		for _, key := range s.required {
+			if _, ok := entries[key]; !ok {
+				report("missing required key %q", key)
+			}
+		}
+
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			report("expected an array, found %s", describe(value))
+			return
+		}
+		if s.length > 0 && len(items) != s.length {
+			report("expected %d elements, found %d", s.length, len(items))
+			return
+		}
+		for i, item := range items {
+			s.items.validate(fmt.Sprintf("%s[%d]", path, i), item, problems)
+		}
+
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			report("expected a string, found %s", describe(value))
+			return
+		}
+		if s.enum != nil && !contains(s.enum, text) {
+			report("%q is not one of %s", text, strings.Join(s.enum, ", "))
+		}
+
+	case "number", "integer":
+		number, ok := value.(float64)
+		if !ok {
+			report("expected a number, found %s", describe(value))
+			return
+		}
+		switch {
+		case s.kind == "integer" && number != math.Trunc(number):
+			report("expected a whole number, found %v", number)
+		case s.positive && number <= 0:
+			report("must be greater than 0, found %v", number)
+		case s.nonNegative && number < 0:
+			report("must not be negative, found %v", number)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			report("expected true or false, found %s", describe(value))
+		}
+	}
+}
+
+// JSONSchema returns the schema as a JSON Schema document.
+func (s *schema) JSONSchema() map[string]any {
+	document := map[string]any{"type": s.kind}
+	if s.description != "" {
+		document["description"] = s.description
+	}
+	switch s.kind {
+	case "object":
+		properties := map[string]any{}
+		for key, property := range s.properties {
+			properties[key] = property.JSONSchema()
+		}
+		document["properties"] = properties
+		document["additionalProperties"] = false
+		if len(s.required) > 0 {
+			document["required"] = s.required
+		}
+	case "array":
+		document["items"] = s.items.JSONSchema()
+		if s.length > 0 {
+			document["minItems"], document["maxItems"] = s.length, s.length
+		}
+	case "string":
+		if s.enum != nil {
+			document["enum"] = s.enum
+		}
+	case "number", "integer":
+		if s.positive {
+			document["exclusiveMinimum"] = 0
+		} else if s.nonNegative {
+			document["minimum"] = 0
+		}
+	}
+	return document
+}
+
+func describe(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "an array"
+	case string:
+		return fmt.Sprintf("the string %q", value)
+	case bool:
+		return fmt.Sprintf("%v", value)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func join(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func sortedKeys[V any](entries map[string]V) []string {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,436 @@
+package scenario
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML reads the subset of YAML that scenario files need: block
+// mappings and sequences nested by indentation, flow sequences and mappings
+// such as [1, 2] and {x: 1}, plain, single- and double-quoted scalars, and
+// comments. The result uses the same types as encoding/json: map[string]any,
+// []any, string, float64, bool and nil.
+func parseYAML(data []byte) (any, error) {
+	lines, err := yamlLines(string(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("empty document")
+	}
+
+	parser := &yamlParser{lines: lines}
+	value, err := parser.block(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if parser.next < len(lines) {
+		return nil, parser.errorf(lines[parser.next], "unexpected indentation")
+	}
+	return value, nil
+}
+
+type yamlLine struct {
+	number int // 1-based, for error messages
+	indent int
+	text   string
+}
+
+// yamlLines drops blank lines, comments and document markers and measures
+// the indentation of the rest.
+func yamlLines(document string) ([]yamlLine, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(document, "\n") {
+		raw = strings.TrimRight(raw, " \r")
+		text := strings.TrimLeft(raw, " ")
+		indent := len(raw) - len(text)
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs cannot be used for indentation", i+1)
+		}
+		text = strings.TrimSpace(stripComment(text))
+		if text == "" || text == "---" {
+			continue
+		}
+		if text == "..." {
+			break
+		}
+		lines = append(lines, yamlLine{number: i + 1, indent: indent, text: text})
+	}
+	return lines, nil
+}
+
+// stripComment removes a # comment that starts the text or follows a space,
+// outside of quotes.
+func stripComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' '):
+			return text[:i]
+		}
+	}
+	return text
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	next  int
+}
+
+func (parser *yamlParser) errorf(line yamlLine, format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", line.number, fmt.Sprintf(format, args...))
+}
+
+// block parses the mapping or sequence whose entries start at indent.
+func (parser *yamlParser) block(indent int) (any, error) {
+	line := parser.lines[parser.next]
+	if isSequenceItem(line.text) {
+		return parser.sequence(indent)
+	}
+	if _, _, ok := splitKey(line.text); ok {
+		return parser.mapping(indent)
+	}
+	// A lone scalar document
+	parser.next++
+	return parseFlow(line.text, line)
+}
+
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (parser *yamlParser) sequence(indent int) (any, error) {
+	items := []any{}
+	for parser.next < len(parser.lines) {
+		line := parser.lines[parser.next]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, parser.errorf(line, "unexpected indentation")
+		}
+		if !isSequenceItem(line.text) {
+			break
+		}
+
+		rest := strings.TrimPrefix(line.text, "-")
+		content := strings.TrimLeft(rest, " ")
+		if content == "" {
+			// The item is the block on the following, deeper lines
+			parser.next++
+			item, err := parser.nested(indent, line)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+
+		_, _, isKey := splitKey(content)
+		if isKey && !strings.HasPrefix(content, "{") || isSequenceItem(content) {
+			// "- key: value" opens a mapping indented to the key, and
+			// "- - item" a sequence indented to the inner dash
+			parser.lines[parser.next] = yamlLine{
+				number: line.number,
+				indent: indent + 1 + len(rest) - len(content),
+				text:   content,
+			}
+			item, err := parser.block(parser.lines[parser.next].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+
+		parser.next++
+		item, err := parseFlow(content, line)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (parser *yamlParser) mapping(indent int) (any, error) {
+	entries := map[string]any{}
+	for parser.next < len(parser.lines) {
+		line := parser.lines[parser.next]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, parser.errorf(line, "unexpected indentation")
+		}
+		key, value, ok := splitKey(line.text)
+		if !ok {
+			if isSequenceItem(line.text) {
+				break
+			}
+			return nil, parser.errorf(line, "expected \"key: value\", found %q", line.text)
+		}
+		if _, duplicate := entries[key]; duplicate {
+			return nil, parser.errorf(line, "duplicate key %q", key)
+		}
+		parser.next++
+
+		if value != "" {
+			parsed, err := parseFlow(value, line)
+			if err != nil {
+				return nil, err
+			}
+			entries[key] = parsed
+			continue
+		}
+
+		// A sequence may sit at the same indentation as its key
+		if parser.next < len(parser.lines) {
+			following := parser.lines[parser.next]
+			if following.indent == indent && isSequenceItem(following.text) {
+				sequence, err := parser.sequence(indent)
+				if err != nil {
+					return nil, err
+				}
+				entries[key] = sequence
+				continue
+			}
+		}
+		nested, err := parser.nested(indent, line)
+		if err != nil {
+			return nil, err
+		}
+		entries[key] = nested
+	}
+	return entries, nil
+}
+
+// nested parses the block below line, or returns nil if there is none.
+func (parser *yamlParser) nested(indent int, line yamlLine) (any, error) {
+	if parser.next >= len(parser.lines) || parser.lines[parser.next].indent <= indent {
+		return nil, nil
+	}
+	return parser.block(parser.lines[parser.next].indent)
+}
+
+// splitKey splits "key: value" or "key:" at the first colon outside quotes
+// that ends the text or is followed by a space.
+func splitKey(text string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			if i == 0 {
+				return "", "", false
+			}
+		case c == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			key := strings.TrimSpace(text[:i])
+			if unquoted, err := unquote(key); err == nil {
+				key = unquoted
+			}
+			return key, strings.TrimSpace(text[i+1:]), key != ""
+		}
+	}
+	return "", "", false
+}
+
+// parseFlow parses a scalar or a flow collection that fills text.
+func parseFlow(text string, line yamlLine) (any, error) {
+	flow := &flowParser{text: text}
+	value, err := flow.value()
+	if err == nil {
+		flow.skipSpace()
+		if flow.pos < len(flow.text) {
+			err = fmt.Errorf("unexpected %q", flow.text[flow.pos:])
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", line.number, err)
+	}
+	return value, nil
+}
+
+type flowParser struct {
+	text string
+	pos  int
+}
+
+func (flow *flowParser) skipSpace() {
+	for flow.pos < len(flow.text) && flow.text[flow.pos] == ' ' {
+		flow.pos++
+	}
+}
+
+func (flow *flowParser) value() (any, error) {
+	flow.skipSpace()
+	if flow.pos >= len(flow.text) {
+		return nil, nil
+	}
+	switch flow.text[flow.pos] {
+	case '[':
+		return flow.sequence()
+	case '{':
+		return flow.mapping()
+	case '"', '\'':
+		return flow.quoted()
+	}
+
+	// A plain scalar runs to the next separator of the enclosing collection
+	start := flow.pos
+	for flow.pos < len(flow.text) && !strings.ContainsRune(",]}", rune(flow.text[flow.pos])) {
+		flow.pos++
+	}
+	return plainScalar(strings.TrimSpace(flow.text[start:flow.pos])), nil
+}
+
+func (flow *flowParser) quoted() (string, error) {
+	quote := flow.text[flow.pos]
+	for end := flow.pos + 1; end < len(flow.text); end++ {
+		switch flow.text[end] {
+		case '\\':
+			if quote == '"' {
+				end++
+			}
+		case quote:
+			if quote == '\'' && end+1 < len(flow.text) && flow.text[end+1] == '\'' {
+				end++ // '' is an escaped quote
+				continue
+			}
+			value, err := unquote(flow.text[flow.pos : end+1])
+			flow.pos = end + 1
+			return value, err
+		}
+	}
+	return "", fmt.Errorf("unterminated string %s", flow.text[flow.pos:])
+}
+
+func (flow *flowParser) sequence() (any, error) {
+	flow.pos++ // [
+	items := []any{}
+	for {
+		flow.skipSpace()
+		if flow.pos < len(flow.text) && flow.text[flow.pos] == ']' {
+			flow.pos++
+			return items, nil
+		}
+		item, err := flow.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if err := flow.separator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (flow *flowParser) mapping() (any, error) {
+	flow.pos++ // {
+	entries := map[string]any{}
+	for {
+		flow.skipSpace()
+		if flow.pos < len(flow.text) && flow.text[flow.pos] == '}' {
+			flow.pos++
+			return entries, nil
+		}
+
+		var key string
+		if flow.pos < len(flow.text) && (flow.text[flow.pos] == '"' || flow.text[flow.pos] == '\'') {
+			quoted, err := flow.quoted()
+			if err != nil {
+				return nil, err
+			}
+			key = quoted
+			flow.skipSpace()
+		} else {
+			start := flow.pos
+			for flow.pos < len(flow.text) && flow.text[flow.pos] != ':' && flow.text[flow.pos] != '}' {
+				flow.pos++
+			}
+			key = strings.TrimSpace(flow.text[start:flow.pos])
+		}
+		if flow.pos >= len(flow.text) || flow.text[flow.pos] != ':' {
+			return nil, fmt.Errorf("expected \":\" after key %q", key)
+		}
+		flow.pos++
+		if _, duplicate := entries[key]; duplicate {
+			return nil, fmt.Errorf("duplicate key %q", key)
+		}
+
+		value, err := flow.value()
+		if err != nil {
+			return nil, err
+		}
+		entries[key] = value
+		if err := flow.separator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// separator consumes the comma between entries, leaving the closing bracket.
+func (flow *flowParser) separator(closing byte) error {
+	flow.skipSpace()
+	if flow.pos >= len(flow.text) {
+		return fmt.Errorf("missing %q", closing)
+	}
+	switch flow.text[flow.pos] {
+	case ',':
+		flow.pos++
+		return nil
+	case closing:
+		return nil
+	}
+	return fmt.Errorf("expected \",\" or %q, found %q", closing, flow.text[flow.pos:])
+}
+
+func unquote(text string) (string, error) {
+	if len(text) >= 2 && text[0] == '\'' && text[len(text)-1] == '\'' {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+	if len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"' {
+		return strconv.Unquote(text)
+	}
+	return "", fmt.Errorf("not quoted")
+}
+
+// plainScalar converts an unquoted scalar to null, a boolean, a number or a
+// string, following the YAML 1.2 core schema.
+func plainScalar(text string) any {
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if looksNumeric(text) {
+		if number, err := strconv.ParseFloat(text, 64); err == nil {
+			return number
+		}
+	}
+	return text
+}
+
+// looksNumeric rejects the words ParseFloat accepts, such as "inf" and "nan".
+func looksNumeric(text string) bool {
+	text = strings.TrimLeft(text, "+-")
+	return text != "" && (text[0] >= '0' && text[0] <= '9' || text[0] == '.' && len(text) > 1 && text[1] >= '0' && text[1] <= '9')
+}
@@ -0,0 +1,190 @@
+package scenario
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     any
+	}{
+		{
+			name:     "scalars",
+			document: "a: 1\nb: -2.5\nc: 1e-9\nd: .5\ne: true\nf: False\ng: ~\nh: null\ni:\nj: text with spaces\n",
+			want: map[string]any{
+				"a": 1.0, "b": -2.5, "c": 1e-9, "d": 0.5, "e": true, "f": false,
+				"g": nil, "h": nil, "i": nil, "j": "text with spaces",
+			},
+		},
+		{
+			name:     "words that are not numbers",
+			document: "a: inf\nb: nan\nc: 1.2.3\nd: -\ne: 12abc\n",
+			want:     map[string]any{"a": "inf", "b": "nan", "c": "1.2.3", "d": "-", "e": "12abc"},
+		},
+		{
+			name:     "quoting",
+			document: "a: \"1\"\nb: 'true'\nc: \"tab\\there\"\nd: 'it''s'\ne: \"# not a comment\"\n'f g': \"colon: inside\"\n",
+			want: map[string]any{
+				"a": "1", "b": "true", "c": "tab\there", "d": "it's", "e": "# not a comment", "f g": "colon: inside",
+			},
+		},
+		{
+			name:     "comments",
+			document: "# leading\n---\na: 1 # trailing\nb: x#y\n\n  # indented\nc: [1, 2] # after a flow\n...\nignored: 3\n",
+			want:     map[string]any{"a": 1.0, "b": "x#y", "c": []any{1.0, 2.0}},
+		},
+		{
+			name:     "flow sequences",
+			document: "a: []\nb: [1, two, \"three, four\"]\nc: [[1, 2], [3]]\nd: [ 1 ,2 ]\n",
+			want: map[string]any{
+				"a": []any{},
+				"b": []any{1.0, "two", "three, four"},
+				"c": []any{[]any{1.0, 2.0}, []any{3.0}},
+				"d": []any{1.0, 2.0},
+			},
+		},
+		{
+			name:     "flow mappings",
+			document: "a: {}\nb: {x: 1, y: [2, 3]}\nc: {'quoted key': {z: null}}\n",
+			want: map[string]any{
+				"a": map[string]any{},
+				"b": map[string]any{"x": 1.0, "y": []any{2.0, 3.0}},
+				"c": map[string]any{"quoted key": map[string]any{"z": nil}},
+			},
+		},
+		{
+			name: "nested blocks",
+			document: strings.Join([]string{
+				"physics:",
+				"  dt: 0.01",
+				"  pn:",
+				"    c: 1000",
+				"bodies:",
+				"  - name: Sun",
+				"    mass: 1",
+				"    position: [0, 0]",
+				"  -",
+				"    name: Earth",
+				"  - {name: Moon}",
+				"columns:",
+				"- PosX",
+				"- PosY",
+			}, "\n"),
+			want: map[string]any{
+				"physics": map[string]any{"dt": 0.01, "pn": map[string]any{"c": 1000.0}},
+				"bodies": []any{
+					map[string]any{"name": "Sun", "mass": 1.0, "position": []any{0.0, 0.0}},
+					map[string]any{"name": "Earth"},
+					map[string]any{"name": "Moon"},
+				},
+				"columns": []any{"PosX", "PosY"},
+			},
+		},
+		{
+			name:     "top-level sequence",
+			document: "- 1\n- - 2\n  - 3\n",
+			want:     []any{1.0, []any{2.0, 3.0}},
+		},
+		{
+			name:     "lone scalar",
+			document: "42\n",
+			want:     42.0,
+		},
+		{
+			name:     "windows line endings",
+			document: "a: 1\r\nb:\r\n  c: 2\r\n",
+			want:     map[string]any{"a": 1.0, "b": map[string]any{"c": 2.0}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(test.document))
+			if err != nil {
+				t.Fatalf("parseYAML: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseYAML = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     string // Part of the error
+	}{
+		{"empty", "# only a comment\n", "empty document"},
+		{"tab indentation", "a:\n\tb: 1\n", "line 2: tabs"},
+		{"deeper sibling", "a: 1\n  b: 2\n", "line 2: unexpected indentation"},
+		{"deeper sequence item", "- 1\n  - 2\n", "line 2: unexpected indentation"},
+		{"shallower trailing line", "  a: 1\nb: 2\n", "line 2: unexpected indentation"},
+		{"missing colon", "a: 1\nb\n", "line 2: expected \"key: value\""},
+		{"duplicate key", "a: 1\na: 2\n", "line 2: duplicate key \"a\""},
+		{"duplicate flow key", "a: {x: 1, x: 2}\n", "duplicate key \"x\""},
+		{"unclosed flow sequence", "a: [1, 2\n", "missing ']'"},
+		{"unclosed flow mapping", "a: {x: 1\n", "missing '}'"},
+		{"flow key without colon", "a: {x}\n", "expected \":\" after key \"x\""},
+		{"unterminated string", "a: \"abc\n", "unterminated string"},
+		{"text after flow", "a: [1] 2\n", "unexpected \"2\""},
+		{"bad escape", "a: \"\\q\"\n", "line 1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(test.document))
+			if err == nil {
+				t.Fatalf("parseYAML = %#v, want an error containing %q", got, test.want)
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("parseYAML error %q, want it to contain %q", err, test.want)
+			}
+		})
+	}
+}
+
+// TestParseYAMLMatchesJSON checks that a scenario reads the same from YAML
+// as from the equivalent JSON.
+func TestParseYAMLMatchesJSON(t *testing.T) {
+	yaml := `
+frames: 10
+units: au
+physics:
+  dt: 1e-3
+  force: softened
+  softening: 0.01
+bodies:
+  - {name: Sun, mass: 1, position: [0, 0], velocity: [0, 0]}
+  - name: "Earth"
+    mass: 3.0e-6
+    position: [1, 0]
+    velocity: [0, 6.28]
+output:
+  every: 2
+  columns: [PosX, PosY]
+`
+	json := `{
+		"frames": 10, "units": "au",
+		"physics": {"dt": 1e-3, "force": "softened", "softening": 0.01},
+		"bodies": [
+			{"name": "Sun", "mass": 1, "position": [0, 0], "velocity": [0, 0]},
+			{"name": "Earth", "mass": 3.0e-6, "position": [1, 0], "velocity": [0, 6.28]}
+		],
+		"output": {"every": 2, "columns": ["PosX", "PosY"]}
+	}`
+	fromYAML, err := Parse([]byte(yaml), "yaml")
+	if err != nil {
+		t.Fatalf("Parse YAML: %v", err)
+	}
+	fromJSON, err := Parse([]byte(json), "json")
+	if err != nil {
+		t.Fatalf("Parse JSON: %v", err)
+	}
+	if !reflect.DeepEqual(fromYAML, fromJSON) {
+		t.Errorf("YAML scenario %+v, want %+v", fromYAML, fromJSON)
+	}
+}
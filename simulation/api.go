@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"proj3-redesigned/scenario"
+	"proj3-redesigned/sink"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxScenario is the largest scenario document the API accepts.
+const maxScenario = 64 << 20
+
+// API serves a JSON API on a local address for driving runs from other
+// programs: runs are created from scenarios, started, paused, stepped and
+// stopped, their bodies are listed, added and removed while they go, and
+// their current state can be downloaded as a results file.
+func API(args []string) {
+
+	flags := flag.NewFlagSet("api", flag.ExitOnError)
+	address := flags.String("addr", "localhost:8080", "address to listen on")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run simulate.go api {optional: flags}")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	listener, err := net.Listen("tcp", *address)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	registry := &runRegistry{runs: map[string]*apiRun{}}
+	server := &http.Server{Handler: localOnly(apiHandler(registry))}
+	fmt.Printf("Serving the API on http://%s/runs (control-C to stop)\n", listener.Addr())
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	select {
+	case <-interrupt:
+	case err := <-served:
+		fmt.Println("Error:", err)
+	}
+
+	// Stopped runs close their results files and end their event streams
+	registry.stopAll()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+}
+
+// apiRun is a session created through the API.
+type apiRun struct {
+	id      string
+	session *Session
+	running chan struct{} // Closed once Run has returned and the outputs are closed
+}
+
+// stop stops the run and waits for its outputs to be closed.
+func (run *apiRun) stop() {
+	run.session.Stop()
+	<-run.running
+}
+
+// runInfo is how the API describes a run.
+type runInfo struct {
+	ID string `json:"id"`
+	State
+}
+
+func (run *apiRun) info() runInfo {
+	return runInfo{ID: run.id, State: run.session.State()}
+}
+
+// runRegistry holds the runs of the API server by id, in order of creation.
+type runRegistry struct {
+	mutex sync.Mutex
+	next  int
+	runs  map[string]*apiRun
+	order []string
+}
+
+func (registry *runRegistry) add(session *Session) *apiRun {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.next++
+	run := &apiRun{id: strconv.Itoa(registry.next), session: session, running: make(chan struct{})}
+	registry.runs[run.id] = run
+	registry.order = append(registry.order, run.id)
+	go func() {
+		session.Run()
+		close(run.running)
+	}()
+	return run
+}
+
+func (registry *runRegistry) get(id string) (*apiRun, bool) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	run, ok := registry.runs[id]
+	return run, ok
+}
+
+func (registry *runRegistry) list() []*apiRun {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	runs := make([]*apiRun, len(registry.order))
+	for i, id := range registry.order {
+		runs[i] = registry.runs[id]
+	}
+	return runs
+}
+
+func (registry *runRegistry) remove(id string) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	delete(registry.runs, id)
+	for i, candidate := range registry.order {
+		if candidate == id {
+			registry.order = append(registry.order[:i], registry.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (registry *runRegistry) stopAll() {
+	for _, run := range registry.list() {
+		run.stop()
+	}
+}
+
+// apiHandler serves the runs of registry:
+//
+//	GET    /runs                      every run
+//	POST   /runs                      create a run from a scenario, as application/json or application/yaml
+//	GET    /runs/{id}                 the run
+//	DELETE /runs/{id}                 stop the run and forget it
+//	POST   /runs/{id}/start, /pause, /step, /stop
+//	POST   /runs/{id}/settings        {"dt": ..., "theta": ..., "rate": ...}, any may be left out
+//	GET    /runs/{id}/bodies          every body
+//	POST   /runs/{id}/bodies          add a body, or an array of them
+//	GET    /runs/{id}/bodies/{name}   one body
+//	DELETE /runs/{id}/bodies/{name}   remove a body
+//	GET    /runs/{id}/snapshot        the bodies now, as ?format=binary (default), csv or jsonl
+//	GET    /runs/{id}/events          server-sent events, as for the serve command
+//
+// Runs and controls answer with the run's id and State, errors with
+// {"error": message}.
+func apiHandler(registry *runRegistry) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/runs", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			runs := []runInfo{}
+			for _, run := range registry.list() {
+				runs = append(runs, run.info())
+			}
+			writeJSON(w, http.StatusOK, runs)
+		case http.MethodPost:
+			createRun(w, r, registry)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("/runs needs GET or POST"))
+		}
+	})
+	mux.HandleFunc("/runs/", func(w http.ResponseWriter, r *http.Request) {
+		// Segments are unescaped one by one, so body names may hold slashes
+		var segments []string
+		for _, segment := range strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/runs/"), "/") {
+			unescaped, err := url.PathUnescape(segment)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			segments = append(segments, unescaped)
+		}
+		run, ok := registry.get(segments[0])
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no run %q", segments[0]))
+			return
+		}
+		serveRun(w, r, registry, run, segments[1:])
+	})
+	return mux
+}
+
+// createRun builds a session from the scenario in the request body. The
+// run starts paused unless ?start=true; ?frames=n and ?rate=r override the
+// scenario's frame count and let the run go at most r frames per second.
+func createRun(w http.ResponseWriter, r *http.Request, registry *runRegistry) {
+	query := r.URL.Query()
+	frames, rate, start := 0, 0.0, false
+	var err error
+	if value := query.Get("frames"); value != "" {
+		if frames, err = strconv.Atoi(value); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("bad frames %q", value))
+			return
+		}
+	}
+	if value := query.Get("rate"); value != "" {
+		if rate, err = strconv.ParseFloat(value, 64); err != nil || !(rate >= 0) {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("bad rate %q", value))
+			return
+		}
+	}
+	if value := query.Get("start"); value != "" {
+		if start, err = strconv.ParseBool(value); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("bad start %q", value))
+			return
+		}
+	}
+
+	var format string
+	switch mediaType(r) {
+	case "application/json":
+		format = "json"
+	case "application/yaml", "application/x-yaml":
+		format = "yaml"
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("/runs needs Content-Type: application/json or application/yaml"))
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxScenario))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	run, err := scenario.Parse(data, format)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := checkAPIScenario(run); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	params, err := scenarioParams(run)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	input, err := scenarioInput(run)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	mode, workers := scenarioEngine(run)
+	session, err := NewSession(input, params, mode, workers, frames, rate)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !start {
+		session.Pause()
+	}
+
+	created := registry.add(session)
+	w.Header().Set("Location", "/runs/"+created.id)
+	writeJSON(w, http.StatusCreated, created.info())
+}
+
+// checkAPIScenario refuses scenarios that would reach files on the server.
+// Results are only handed back through /snapshot, so a scenario may not name
+// results or tree files, and its input may only name a dataset in
+// simulation/data.
+func checkAPIScenario(run *scenario.Scenario) error {
+	if run.Output.File != "" || len(run.Output.Files) > 0 || run.Output.Tree != "" {
+		return errors.New("API runs write no files: leave out output.file, output.files and output.tree and download /runs/{id}/snapshot instead")
+	}
+	if run.Input != "" && (strings.ContainsAny(run.Input, `/\`) || strings.HasPrefix(run.Input, ".")) {
+		return fmt.Errorf("input %q is not the name of a dataset in simulation/data", run.Input)
+	}
+	return nil
+}
+
+// scenarioEngine returns the stepFrame mode and the worker count of a
+// scenario's engine.
+func scenarioEngine(run *scenario.Scenario) (string, int) {
+	workers := run.Engine.Workers
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+	switch run.Engine.Mode {
+	case "parallel":
+		return "p", workers
+	case "workqueue":
+		return "q", workers
+	}
+	return "", 1
+}
+
+// serveRun answers the requests under /runs/{id}.
+func serveRun(w http.ResponseWriter, r *http.Request, registry *runRegistry, run *apiRun, segments []string) {
+	session := run.session
+	if len(segments) == 0 || segments[0] == "" {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, run.info())
+		case http.MethodDelete:
+			run.stop()
+			registry.remove(run.id)
+			writeJSON(w, http.StatusOK, run.info())
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s needs GET or DELETE", r.URL.Path))
+		}
+		return
+	}
+
+	switch resource := segments[0]; {
+	case len(segments) == 1 && (resource == "start" || resource == "pause" || resource == "step" || resource == "stop"):
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		switch resource {
+		case "start":
+			session.Resume()
+		case "pause":
+			session.Pause()
+		case "step":
+			session.Step()
+		case "stop":
+			run.stop()
+		}
+		writeJSON(w, http.StatusOK, run.info())
+
+	case len(segments) == 1 && resource == "settings":
+		if !allowMethod(w, r, http.MethodPost) || !requireJSON(w, r) {
+			return
+		}
+		var settings Settings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("bad settings: %w", err))
+			return
+		}
+		if err := session.Set(settings); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, run.info())
+
+	case len(segments) == 1 && resource == "bodies":
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, session.Bodies())
+		case http.MethodPost:
+			if !requireJSON(w, r) {
+				return
+			}
+			bodies, err := decodeBodies(r.Body)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			if err := session.Add(bodies); err != nil {
+				writeError(w, sessionStatus(err), err)
+				return
+			}
+			writeJSON(w, http.StatusCreated, run.info())
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s needs GET or POST", r.URL.Path))
+		}
+
+	case len(segments) == 2 && resource == "bodies":
+		switch r.Method {
+		case http.MethodGet:
+			body, err := session.Body(segments[1])
+			if err != nil {
+				writeError(w, sessionStatus(err), err)
+				return
+			}
+			writeJSON(w, http.StatusOK, body)
+		case http.MethodDelete:
+			if err := session.Remove(segments[1]); err != nil {
+				writeError(w, sessionStatus(err), err)
+				return
+			}
+			writeJSON(w, http.StatusOK, run.info())
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s needs GET or DELETE", r.URL.Path))
+		}
+
+	case len(segments) == 1 && resource == "snapshot":
+		if allowMethod(w, r, http.MethodGet) {
+			downloadSnapshot(w, r, run)
+		}
+
+	case len(segments) == 1 && resource == "events":
+		streamEvents(w, r, session)
+
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no resource %s", r.URL.Path))
+	}
+}
+
+// decodeBodies reads one body or an array of them.
+func decodeBodies(in io.Reader) ([]BodyInfo, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	var bodies []BodyInfo
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &bodies)
+	} else {
+		bodies = make([]BodyInfo, 1)
+		err = json.Unmarshal(trimmed, &bodies[0])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad bodies: %w", err)
+	}
+	return bodies, nil
+}
+
+// sessionStatus is the HTTP status of an error from a session.
+func sessionStatus(err error) int {
+	switch {
+	case errors.Is(err, errNoBody):
+		return http.StatusNotFound
+	case errors.Is(err, errFinished):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// downloadSnapshot sends the bodies of a run as they are now, as a results
+// file of one frame in the run's output units.
+func downloadSnapshot(w http.ResponseWriter, r *http.Request, run *apiRun) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "binary"
+	}
+	extension, err := sink.Extension(format)
+	if err != nil || format == "vtk" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown snapshot format %q (want binary, csv or jsonl)", format))
+		return
+	}
+
+	// The sinks write to files, so the snapshot goes through a temporary one
+	file, err := os.CreateTemp("", "snapshot-*"+extension)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	filename := file.Name()
+	file.Close()
+	defer os.Remove(filename)
+
+	frame, err := run.session.WriteSnapshot(filename)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	snapshot, err := os.Open(filename)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer snapshot.Close()
+
+	contentTypes := map[string]string{"binary": "application/octet-stream", "csv": "text/csv", "jsonl": "application/x-ndjson"}
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"run_%s_frame_%d%s\"", run.id, frame, extension))
+	io.Copy(w, snapshot)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"proj3-redesigned/compression"
+	"proj3-redesigned/utils"
+	"strconv"
+)
+
+// applyBoundary enforces the boundary policy on the freshly rebuilt tree and
+// returns the tree to use for the next frame, rebuilt again if bodies were removed.
+func applyBoundary(root *utils.QuadNode, bodies *utils.Bodies, params *utils.Params, frame int, escapers *[]utils.Escaper) *utils.QuadNode {
+	if params.Boundary == nil {
+		return root
+	}
+
+	removed := params.Boundary.Apply(bodies, root, params, frame)
+	if len(removed) == 0 && params.Boundary.Policy != utils.BoundaryReflect {
+		return root
+	}
+	*escapers = append(*escapers, removed...)
+
+	// Reflected bodies have moved, removed bodies are still in the tree
+	return RebuildQuadTree(bodies, params)
+}
+
+// writeEscapers records the bodies removed by the boundary during a run, in
+// the requested output units.
+func writeEscapers(fileName string, escapers []utils.Escaper, params *utils.Params) {
+	if len(escapers) == 0 {
+		return
+	}
+
+	file, err := compression.Create(fileName)
+	if err != nil {
+		fmt.Println("Error creating CSV file:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	headers := []string{"Frame", "Body Name", "PosX", "PosY", "VelX", "VelY", "Speed"}
+	writer.Write(headers)
+
+	for _, escaper := range escapers {
+		position := escaper.Position.Multiply(params.Output.Length)
+		velocity := escaper.Velocity.Multiply(params.Output.Velocity)
+		record := []string{
+			strconv.Itoa(escaper.Frame),
+			escaper.Name,
+			fmt.Sprintf("%f", position.X),
+			fmt.Sprintf("%f", position.Y),
+			fmt.Sprintf("%f", velocity.X),
+			fmt.Sprintf("%f", velocity.Y),
+			fmt.Sprintf("%f", velocity.Magnitude()),
+		}
+		if err := writer.Write(record); err != nil {
+			fmt.Println("Error writing to CSV:", err)
+		}
+	}
+}
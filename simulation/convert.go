@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"proj3-redesigned/compression"
+	"proj3-redesigned/snapshot"
+)
+
+// Convert writes a binary snapshot back out as CSV, to a file or to stdout.
+func Convert(args []string) {
+
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	full := flags.Bool("full", false, "write every digit instead of the engines' %f formatting")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run simulate.go convert {optional: flags} {snapshot.nbs} {optional: output.csv, .csv.gz or .csv.zst}")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return
+	}
+
+	reader, err := snapshot.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer reader.Close()
+
+	var out io.Writer = os.Stdout
+	if flags.NArg() > 1 {
+		file, err := compression.Create(flags.Arg(1))
+		if err != nil {
+			fmt.Println("Error creating CSV file:", err)
+			return
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if err := snapshot.WriteCSV(reader, out, *full); err != nil {
+		fmt.Println("Error:", err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"proj3-redesigned/generate"
+	"strings"
+)
+
+// Generate writes a generated model to simulation/data/{name}.csv, where it
+// can be run like the bundled datasets.
+func Generate(args []string) {
+
+	defaults := generate.DefaultConfig()
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	n := flags.Int("n", defaults.N, "number of bodies")
+	mass := flags.Float64("mass", defaults.Mass, "total mass of the bodies")
+	radius := flags.Float64("radius", defaults.Radius, "scale radius of the model")
+	centralMass := flags.Float64("central-mass", defaults.CentralMass, "mass of the central body of the kepler model")
+	G := flags.Float64("g", defaults.G, "gravitational constant used for the velocities and written to the header")
+	seed := flags.Int64("seed", defaults.Seed, "random seed")
+	frames := flags.Int("frames", 5000, "number of frames written to the header")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run simulate.go generate {optional: flags} {model} {name}")
+		fmt.Println("Models:", strings.Join(generate.Models, ", "))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return
+	}
+	model, name := flags.Arg(0), flags.Arg(1)
+
+	config := generate.Config{
+		N:           *n,
+		Mass:        *mass,
+		Radius:      *radius,
+		CentralMass: *centralMass,
+		G:           *G,
+		Seed:        *seed,
+	}
+	bodies, err := generate.Generate(model, config)
+	if err != nil {
+		fmt.Println("Error generating bodies:", err)
+		return
+	}
+
+	cwd, _ := os.Getwd()
+	fileName := filepath.Join(cwd, fmt.Sprintf("simulation/data/%s.csv", name))
+	if err := generate.Write(fileName, bodies, *frames, *G); err != nil {
+		fmt.Println("Error writing bodies:", err)
+		return
+	}
+	fmt.Printf("Wrote %d bodies to %s\n", len(bodies), fileName)
+}
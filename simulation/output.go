@@ -0,0 +1,115 @@
+package main
+
+import (
+	"path/filepath"
+	"proj3-redesigned/compression"
+	"proj3-redesigned/quadtree"
+	"proj3-redesigned/sink"
+	"proj3-redesigned/utils"
+	"strings"
+)
+
+// outputFiles returns the results files and the escapers file of an engine:
+// the engine's default in params.OutputFormat, or params.Outputs with an
+// escapers file beside the first of them, compressed like it.
+func outputFiles(engine string, params *utils.Params) ([]string, string) {
+	if len(params.Outputs) == 0 {
+		extension, _ := sink.Extension(params.OutputFormat)
+		return []string{engine + "_simulation_results" + extension}, engine + "_escapers.csv"
+	}
+	first := params.Outputs[0]
+	uncompressed := compression.Strip(first)
+	base := strings.TrimSuffix(uncompressed, filepath.Ext(uncompressed))
+	return params.Outputs, base + "_escapers.csv" + compression.Extension(first)
+}
+
+// checkOutput reports output settings that cannot be used, before the run starts.
+func checkOutput(params *utils.Params) error {
+	if _, err := sink.Extension(params.OutputFormat); err != nil {
+		return err
+	}
+	if err := sink.CheckColumns(params.Select.Columns); err != nil {
+		return err
+	}
+	for _, output := range params.Outputs {
+		if _, err := sink.FormatOf(output); err != nil {
+			return err
+		}
+	}
+	if params.TreeOutput != "" {
+		if _, err := quadtree.ExportFormat(params.TreeOutput); err != nil {
+			return err
+		}
+	}
+	return sink.CheckPatterns(params.Select.Bodies)
+}
+
+// createResults opens the results files of a run along with its attached
+// sinks. The returned sink skips the frames and bodies the selection leaves
+// out, and with an output buffer writes on its own goroutine.
+func createResults(files []string, params *utils.Params) (sink.OutputSink, error) {
+	options := sinkOptions(params)
+	options.Columns = params.Select.Columns
+
+	var sinks sink.Multi
+	for _, file := range files {
+		output, err := sink.Create(file, options)
+		if err != nil {
+			sinks.Close()
+			return nil, err
+		}
+		sinks = append(sinks, output)
+	}
+	sinks = append(sinks, params.Sinks...)
+
+	var results sink.OutputSink = sinks
+	if params.OutputBuffer > 0 {
+		results = sink.NewAsync(results, params.OutputBuffer)
+	}
+	return sink.NewSelected(results, params), nil
+}
+
+// sinkOptions returns the units and time step that file sinks record.
+func sinkOptions(params *utils.Params) sink.Options {
+	options := sink.Options{Conversion: params.Output, Units: params.Units.Name, Dt: params.Dt}
+	if params.OutputUnits != "" {
+		options.Units = params.OutputUnits
+	}
+	return options
+}
+
+// treeOutput exports the quadtree of the frames the output selection keeps.
+// Without a tree file it does nothing.
+type treeOutput struct {
+	exporter quadtree.Exporter
+	params   *utils.Params
+}
+
+// createTrees opens params.TreeOutput, if one is set.
+func createTrees(params *utils.Params) (*treeOutput, error) {
+	trees := &treeOutput{params: params}
+	if params.TreeOutput == "" {
+		return trees, nil
+	}
+	exporter, err := quadtree.CreateExporter(params.TreeOutput, params.Output)
+	if err != nil {
+		return nil, err
+	}
+	trees.exporter = exporter
+	return trees, nil
+}
+
+// WriteTree exports the tree of a frame that ends at the given simulated time.
+func (trees *treeOutput) WriteTree(frame int, time float64, root *utils.QuadNode) error {
+	if trees.exporter == nil || !trees.params.Select.Due(frame, time, trees.params.Dt) {
+		return nil
+	}
+	return trees.exporter.WriteTree(frame, time, root)
+}
+
+func (trees *treeOutput) Close() error {
+	if trees.exporter == nil {
+		return nil
+	}
+	return trees.exporter.Close()
+}
@@ -1,32 +1,29 @@
 package main
 
 import (
-	"encoding/csv"
 	"fmt"
-	"os"
 	"proj3-redesigned/utils"
-	"strconv"
 	"sync"
 	"time"
 )
 
-func workerCalculateForce(nodeQueue chan *utils.QuadNode, root *utils.QuadNode, theta float64, dt float64, wg *sync.WaitGroup) {
+func workerCalculateForce(nodeQueue chan *utils.QuadNode, root *utils.QuadNode, params *utils.Params, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for node := range nodeQueue {
 		if node.BodiesPtr != nil && node.BodiesPtr.NodeBodies != nil {
-			node.CalculateForce(root, theta, dt)
+			node.CalculateForce(root, params)
 		}
 	}
 }
 
-func workerUpdateBodies(bodyQueue chan *utils.Body, dt float64, wg *sync.WaitGroup) {
+func workerUpdateBodies(bodyQueue chan *utils.Body, params *utils.Params, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for body := range bodyQueue {
-		body.Update(dt)
+		params.Integrator.Step(body, params)
 	}
 }
 
-func simulateParallel(root *utils.QuadNode, allBodies *utils.Bodies, dt float64, theta float64, numWorkers int) {
+func simulateParallel(root *utils.QuadNode, allBodies *utils.Bodies, params *utils.Params, numWorkers int) {
 	if root == nil {
 		return
 	}
@@ -38,7 +35,7 @@ func simulateParallel(root *utils.QuadNode, allBodies *utils.Bodies, dt float64,
 	// Start workers for force calculation
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
-		go workerCalculateForce(nodeQueue, root, theta, dt, &wg)
+		go workerCalculateForce(nodeQueue, root, params, &wg)
 	}
 
 	// Enqueue nodes
@@ -60,77 +57,94 @@ func simulateParallel(root *utils.QuadNode, allBodies *utils.Bodies, dt float64,
 	close(nodeQueue) // Close the node queue after all nodes are enqueued
 	wg.Wait()        // Wait for all force calculations to complete
 
+	params.Integrator.Begin(allBodies, params)
+
 	// Start workers for updating bodies
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
-		go workerUpdateBodies(bodyQueue, dt, &wg)
+		go workerUpdateBodies(bodyQueue, params, &wg)
 	}
 
 	// Enqueue bodies
-	for _, body := range allBodies.NodeBodies {
+	for _, body := range params.TreeBodies(allBodies) {
 		bodyQueue <- body
 	}
 
 	close(bodyQueue) // Close the body queue after all bodies are enqueued
 
 	wg.Wait() // Wait for all updates to complete
+
+	params.Integrator.End(allBodies, params)
+
+	if params.Regularizer != nil {
+		params.Regularizer.Advance(root, params)
+	}
 }
 
-func Parallel(inputLink string, numWorkers int) {
+func Parallel(input Input, numWorkers int, params *utils.Params) {
 
 	startTime := time.Now() // Start timing
 	parallelTime := 0
 
-	root, bodies, simulationFrames, _ := BuildQuadTree(inputLink)
+	root, bodies, simulationFrames, _, err := BuildQuadTree(input, params)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
 
-	dt := 0.01 // Time step size
+	resultsFiles, escapersFile := outputFiles("parallel", params)
 
-	// Create and open a CSV file
-	file, err := os.Create("parallel_simulation_results.csv")
+	// Create the results files and write their headers
+	results, err := createResults(resultsFiles, params)
 	if err != nil {
-		fmt.Println("Error creating CSV file:", err)
+		fmt.Println("Error creating results file:", err)
 		return
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	trees, err := createTrees(params)
+	if err != nil {
+		fmt.Println("Error creating tree file:", err)
+		results.Close()
+		return
+	}
 
-	// Write headers
-	headers := []string{"Frame", "Body Name", "PosX", "PosY", "VelX", "VelY", "ForceX", "ForceY"}
-	writer.Write(headers)
+	var escapers []utils.Escaper
+	elapsed := 0.0 // Simulated time, summed a step at a time as a session does
 
 	for frame := 0; frame < int(simulationFrames); frame++ {
 
 		parallelStart := time.Now()
 
-		simulateParallel(root, bodies, dt, 0.5, numWorkers)
+		simulateParallel(root, bodies, params, numWorkers)
 
 		parallelEnd := time.Now()
 		parallelTimeDelta := parallelEnd.Sub(parallelStart)
 		parallelTime += int(parallelTimeDelta.Microseconds())
 
-		root = RebuildQuadTree(bodies)
-
-		// Write positions and velocities for each body to the CSV
-		for _, body := range bodies.NodeBodies {
-			record := []string{
-				strconv.Itoa(frame),
-				body.Name,
-				fmt.Sprintf("%f", body.Positions.X),
-				fmt.Sprintf("%f", body.Positions.Y),
-				fmt.Sprintf("%f", body.Velocities.X),
-				fmt.Sprintf("%f", body.Velocities.Y),
-				fmt.Sprintf("%f", body.Force.X),
-				fmt.Sprintf("%f", body.Force.Y),
-			}
-			if err := writer.Write(record); err != nil {
-				fmt.Println("Error writing to CSV:", err)
-			}
+		root = RebuildQuadTree(bodies, params)
+		root = applyBoundary(root, bodies, params, frame, &escapers)
+		root = applyRegularization(root, bodies, params)
+
+		// Write positions and velocities for the selected frames and bodies
+		elapsed += params.Dt
+		if err := results.WriteFrame(frame, elapsed, bodies.NodeBodies); err != nil {
+			fmt.Println("Error writing results:", err)
 		}
-		writer.Flush() // Flush after each frame to ensure data is written
+		if err := trees.WriteTree(frame, elapsed, root); err != nil {
+			fmt.Println("Error writing tree:", err)
+		}
+
+	}
 
+	// Finish writing before the clock stops, so that frames still queued for
+	// the writer count towards the run's time
+	if err := results.Close(); err != nil {
+		fmt.Println("Error writing results:", err)
+	}
+	if err := trees.Close(); err != nil {
+		fmt.Println("Error writing tree:", err)
 	}
+	writeEscapers(escapersFile, escapers, params)
 
 	endTime := time.Now()
 	totalTime := endTime.Sub(startTime)
@@ -1,12 +1,9 @@
 package main
 
 import (
-	"encoding/csv"
 	"fmt"
-	"os"
 	"proj3-redesigned/utils"
 	"proj3-redesigned/workstealing"
-	"strconv"
 	"sync"
 	"time"
 )
@@ -49,7 +46,7 @@ func worker(queue *workstealing.Dequeue, queues []*workstealing.Dequeue, wg *syn
 	}
 }
 
-func simulateWQParallel(root *utils.QuadNode, allBodies *utils.Bodies, dt float64, theta float64, numWorkers int) {
+func simulateWQParallel(root *utils.QuadNode, allBodies *utils.Bodies, params *utils.Params, numWorkers int) {
 	if root == nil {
 		return
 	}
@@ -74,7 +71,7 @@ func simulateWQParallel(root *utils.QuadNode, allBodies *utils.Bodies, dt float6
 			}
 			if node.BodiesPtr != nil && node.BodiesPtr.NodeBodies != nil {
 				queueIndex := nodeIndex % numWorkers
-				queues[queueIndex].Push(&workstealing.NodeTask{Node: node, Root: root, Theta: theta, Dt: dt})
+				queues[queueIndex].Push(&workstealing.NodeTask{Node: node, Root: root, Params: params})
 				nodeIndex++
 			}
 		}
@@ -103,11 +100,13 @@ func simulateWQParallel(root *utils.QuadNode, allBodies *utils.Bodies, dt float6
 		bodyQueues[i] = workstealing.NewWorkStealingDequeue()
 	}
 
+	params.Integrator.Begin(allBodies, params)
+
 	// Enqueue body tasks
 	bodyIndex := 0
-	for _, body := range allBodies.NodeBodies {
+	for _, body := range params.TreeBodies(allBodies) {
 		queueIndex := bodyIndex % numWorkers
-		bodyQueues[queueIndex].Push(&workstealing.BodyTask{Body: body, Dt: dt})
+		bodyQueues[queueIndex].Push(&workstealing.BodyTask{Body: body, Params: params})
 		bodyIndex++
 	}
 
@@ -123,62 +122,77 @@ func simulateWQParallel(root *utils.QuadNode, allBodies *utils.Bodies, dt float6
 	}
 
 	bodyWg.Wait() // Wait for all workers to finish processing bodies
+
+	params.Integrator.End(allBodies, params)
+
+	if params.Regularizer != nil {
+		params.Regularizer.Advance(root, params)
+	}
 }
 
-func WQParallel(inputLink string, numWorkers int) {
+func WQParallel(input Input, numWorkers int, params *utils.Params) {
 
 	startTime := time.Now() // Start timing
 	parallelTime := 0
 
-	root, bodies, simulationFrames, _ := BuildQuadTree(inputLink)
+	root, bodies, simulationFrames, _, err := BuildQuadTree(input, params)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
 
-	dt := 0.01 // Time step size
+	resultsFiles, escapersFile := outputFiles("wq_parallel", params)
 
-	// Create and open a CSV file
-	file, err := os.Create("wq_parallel_simulation_results.csv")
+	// Create the results files and write their headers
+	results, err := createResults(resultsFiles, params)
 	if err != nil {
-		fmt.Println("Error creating CSV file:", err)
+		fmt.Println("Error creating results file:", err)
 		return
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	trees, err := createTrees(params)
+	if err != nil {
+		fmt.Println("Error creating tree file:", err)
+		results.Close()
+		return
+	}
 
-	// Write headers
-	headers := []string{"Frame", "Body Name", "PosX", "PosY", "VelX", "VelY", "ForceX", "ForceY"}
-	writer.Write(headers)
+	var escapers []utils.Escaper
+	elapsed := 0.0 // Simulated time, summed a step at a time as a session does
 
 	for frame := 0; frame < int(simulationFrames); frame++ {
 
 		parallelStart := time.Now()
-		simulateWQParallel(root, bodies, dt, 0.5, numWorkers)
+		simulateWQParallel(root, bodies, params, numWorkers)
 		parallelEnd := time.Now()
 
 		parallelTimeDelta := parallelEnd.Sub(parallelStart)
 		parallelTime += int(parallelTimeDelta.Microseconds())
 
-		root = RebuildQuadTree(bodies)
-
-		// Write positions and velocities for each body to the CSV
-		for _, body := range bodies.NodeBodies {
-			record := []string{
-				strconv.Itoa(frame),
-				body.Name,
-				fmt.Sprintf("%f", body.Positions.X),
-				fmt.Sprintf("%f", body.Positions.Y),
-				fmt.Sprintf("%f", body.Velocities.X),
-				fmt.Sprintf("%f", body.Velocities.Y),
-				fmt.Sprintf("%f", body.Force.X),
-				fmt.Sprintf("%f", body.Force.Y),
-			}
-			if err := writer.Write(record); err != nil {
-				fmt.Println("Error writing to CSV:", err)
-			}
+		root = RebuildQuadTree(bodies, params)
+		root = applyBoundary(root, bodies, params, frame, &escapers)
+		root = applyRegularization(root, bodies, params)
+
+		// Write positions and velocities for the selected frames and bodies
+		elapsed += params.Dt
+		if err := results.WriteFrame(frame, elapsed, bodies.NodeBodies); err != nil {
+			fmt.Println("Error writing results:", err)
 		}
-		writer.Flush() // Flush after each frame to ensure data is written
+		if err := trees.WriteTree(frame, elapsed, root); err != nil {
+			fmt.Println("Error writing tree:", err)
+		}
+
+	}
 
+	// Finish writing before the clock stops, so that frames still queued for
+	// the writer count towards the run's time
+	if err := results.Close(); err != nil {
+		fmt.Println("Error writing results:", err)
+	}
+	if err := trees.Close(); err != nil {
+		fmt.Println("Error writing tree:", err)
 	}
+	writeEscapers(escapersFile, escapers, params)
 
 	endTime := time.Now()
 	totalTime := endTime.Sub(startTime)
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math"
+	"proj3-redesigned/quadtree"
+	"proj3-redesigned/utils"
+	"testing"
+)
+
+// TestPerihelionPrecession integrates an eccentric binary with the 1PN
+// correction through the tree engine and compares the periapsis advance per
+// orbit with the analytic 6 pi G M / (c^2 a (1 - e^2)).
+func TestPerihelionPrecession(t *testing.T) {
+
+	const (
+		semiMajor    = 1.0
+		eccentricity = 0.5
+		orbits       = 10
+		tolerance    = 0.02 // Relative
+	)
+
+	// Units with G = M = 1, and c chosen so that GM / (c^2 a) = 1e-3
+	params := utils.NewParams()
+	params.G = 1
+	params.Force = utils.Newtonian{G: 1}
+	params.Dt = 1e-4
+	params.PN = &utils.PostNewtonian{C: math.Sqrt(1000), Radius: 10 * semiMajor}
+
+	// Equal masses starting at periapsis, centre of mass at rest at the origin
+	periapsis := semiMajor * (1 - eccentricity)
+	speed := math.Sqrt((1 + eccentricity) / periapsis)
+	bodies := &utils.Bodies{NodeBodies: []*utils.Body{
+		{Name: "Primary", Positions: utils.Vector2{X: periapsis / 2}, Velocities: utils.Vector2{Y: speed / 2}, Mass: 0.5},
+		{Name: "Secondary", Positions: utils.Vector2{X: -periapsis / 2}, Velocities: utils.Vector2{Y: -speed / 2}, Mass: 0.5},
+	}}
+	primary, secondary := bodies.NodeBodies[0], bodies.NodeBodies[1]
+
+	root := quadtree.BuildQuadTree(bodies.NodeBodies, rootRegion(bodies, params))
+
+	// Record the angle of each periapsis passage, found as a local minimum of the separation
+	var angles []float64
+	angle := 0.0 // Unwrapped angle of the separation
+	previousAngle := 0.0
+	separations := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	period := 2 * math.Pi * math.Sqrt(semiMajor*semiMajor*semiMajor)
+
+	for step := 0; step < int(orbits*period/params.Dt)+int(period/params.Dt/2); step++ {
+		simulate(root, bodies, params)
+		root = RebuildQuadTree(bodies, params)
+
+		r := primary.Positions.Subtract(secondary.Positions)
+		current := math.Atan2(r.Y, r.X)
+		delta := math.Remainder(current-previousAngle, 2*math.Pi)
+		previousAngle = current
+
+		separations[0], separations[1], separations[2] = separations[1], separations[2], r.Magnitude()
+		if separations[1] < separations[0] && separations[1] < separations[2] {
+			angles = append(angles, angle)
+		}
+		angle += delta
+	}
+
+	if len(angles) < 2 {
+		t.Fatalf("found %d periapsis passages, want at least 2", len(angles))
+	}
+
+	// Each orbit sweeps 2 pi plus the advance
+	measured := (angles[len(angles)-1]-angles[0])/float64(len(angles)-1) - 2*math.Pi
+	expected := 6 * math.Pi * params.G / (params.PN.C * params.PN.C * semiMajor * (1 - eccentricity*eccentricity))
+	relativeError := math.Abs(measured-expected) / expected
+
+	t.Logf("precession per orbit: measured %.6e, analytic %.6e, relative error %.3f", measured, expected, relativeError)
+	if relativeError > tolerance {
+		t.Errorf("precession per orbit %.6e, want %.6e within %.0f%%", measured, expected, 100*tolerance)
+	}
+}
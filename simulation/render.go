@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"proj3-redesigned/render"
+	"proj3-redesigned/utils"
+)
+
+// Render draws a results file as PNG frames, an animated GIF, or a PNG or
+// SVG plot of every trajectory.
+func Render(args []string) {
+
+	defaults := render.DefaultOptions()
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	pngDir := flags.String("png", "", "write one PNG per drawn frame to this directory")
+	gifFile := flags.String("gif", "", "write an animated GIF to this file")
+	trailsFile := flags.String("trails", "", "write every body's whole trajectory to this PNG")
+	svgFile := flags.String("svg", "", "write every body's trajectory to this SVG")
+	treeFrame := flags.Int("tree-frame", defaults.Tree, "overlay the SVG with an approximate quadtree rebuilt from the positions of this frame (-1 for none); -tree exports the engines' own")
+	first := flags.Int("from", defaults.First, "first frame number to draw")
+	last := flags.Int("to", defaults.Last, "last frame number to draw (-1 for the end of the run)")
+	width := flags.Int("width", defaults.Width, "image width in pixels")
+	height := flags.Int("height", defaults.Height, "image height in pixels")
+	bounds := flags.String("bounds", "", "region to show as minX,minY,maxX,maxY (default fits every position of the run)")
+	zoom := flags.Float64("zoom", defaults.Zoom, "magnification about the centre of the view")
+	pan := flags.String("pan", "", "shift of the centre of the view as x,y, in the units of the results")
+	colorBy := flags.String("color", defaults.Color, "colour of the bodies: body, mass or speed")
+	masses := flags.String("masses", "", "dataset name or input file giving the masses, for -color mass")
+	trail := flags.Int("trail", defaults.Trail, "frames of trail behind each body (0 for none, -1 for the whole run)")
+	radius := flags.Int("radius", defaults.Radius, "radius of a body in pixels")
+	every := flags.Int("every", defaults.Every, "draw every k-th frame of the file")
+	delay := flags.Int("delay", defaults.Delay, "time between GIF frames in hundredths of a second")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run simulate.go render {flags: at least one of -png, -gif, -trails and -svg} {results file}")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || (*pngDir == "" && *gifFile == "" && *trailsFile == "" && *svgFile == "") {
+		flags.Usage()
+		return
+	}
+	results := flags.Arg(0)
+
+	options := render.Options{
+		Width:  *width,
+		Height: *height,
+		Zoom:   *zoom,
+		Color:  *colorBy,
+		Trail:  *trail,
+		Radius: *radius,
+		Every:  *every,
+		Delay:  *delay,
+		First:  *first,
+		Last:   *last,
+		Tree:   *treeFrame,
+	}
+	var err error
+	if *bounds != "" {
+		if options.Bounds, err = render.ParseBounds(*bounds); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+	}
+	if *pan != "" {
+		if options.Pan, err = render.ParsePoint(*pan); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+	}
+	if *masses != "" {
+		options.Masses = readMasses(*masses)
+	}
+
+	if *pngDir != "" {
+		frames, err := render.PNGFrames(results, *pngDir, options)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Printf("Wrote %d frames to %s\n", frames, *pngDir)
+	}
+	if *gifFile != "" {
+		frames, err := render.GIF(results, *gifFile, options)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Printf("Wrote %d frames to %s\n", frames, *gifFile)
+	}
+	if *trailsFile != "" {
+		if err := render.Trails(results, *trailsFile, options); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println("Wrote trajectories to", *trailsFile)
+	}
+	if *svgFile != "" {
+		if err := render.SVG(results, *svgFile, options); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println("Wrote trajectories to", *svgFile)
+	}
+}
+
+// readMasses returns the mass of each body of an input file, or of a dataset
+// in simulation/data when no such file exists.
+func readMasses(source string) map[string]float64 {
+	var bodies utils.Bodies
+	if _, err := os.Stat(source); err == nil {
+		bodies, _ = utils.ReadInput(source)
+	} else {
+		bodies, _ = DataInput(source)()
+	}
+	masses := make(map[string]float64, len(bodies.NodeBodies))
+	for _, body := range bodies.NodeBodies {
+		masses[body.Name] = body.Mass
+	}
+	return masses
+}
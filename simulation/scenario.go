@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"proj3-redesigned/generate"
+	"proj3-redesigned/scenario"
+	"proj3-redesigned/utils"
+	"runtime"
+	"strings"
+)
+
+// RunScenario executes a JSON or YAML scenario file, which replaces both the
+// command-line flags and the positional arguments.
+func RunScenario(args []string) {
+
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	printSchema := flags.Bool("schema", false, "print the JSON Schema of scenario files and exit")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run simulate.go run {optional: flags} {scenario.json or scenario.yaml}")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *printSchema {
+		document, _ := json.MarshalIndent(scenario.Schema(), "", "  ")
+		fmt.Println(string(document))
+		return
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return
+	}
+
+	run, err := scenario.Load(flags.Arg(0))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	params, err := scenarioParams(run)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	input, err := scenarioInput(run)
+	if err != nil {
+		fmt.Printf("Error: %s: %v\n", flags.Arg(0), err)
+		return
+	}
+
+	workers := run.Engine.Workers
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+	switch run.Engine.Mode {
+	case "sequential":
+		Sequential(input, params)
+	case "parallel":
+		Parallel(input, workers, params)
+	case "workqueue":
+		WQParallel(input, workers, params)
+	}
+}
+
+// scenarioParams builds the run settings of a scenario, as main does from flags.
+func scenarioParams(run *scenario.Scenario) (*utils.Params, error) {
+	physics := run.Physics
+
+	params := utils.NewParams()
+	params.Dt = physics.Dt
+	params.Theta = physics.Theta
+	params.OutputUnits = run.Output.Units
+	params.Outputs = run.Output.Files
+	if run.Output.File != "" {
+		params.Outputs = append([]string{run.Output.File}, params.Outputs...)
+	}
+	if run.Output.Format != "" {
+		params.OutputFormat = run.Output.Format
+	}
+	params.Select = utils.Selection{
+		Every:    run.Output.Every,
+		Interval: run.Output.Interval,
+		Columns:  run.Output.Columns,
+		Bodies:   run.Output.Bodies,
+		Flush:    run.Output.Flush,
+	}
+	params.OutputBuffer = run.Output.Buffer
+	params.TreeOutput = run.Output.Tree
+	if err := checkOutput(params); err != nil {
+		return nil, err
+	}
+
+	// Settings in the scenario win over the dataset's header
+	params.Overrides = map[string]bool{}
+	for key := range run.Set {
+		params.Overrides[strings.ReplaceAll(key, "_", "-")] = true
+	}
+
+	if run.Units != "" {
+		units, err := utils.LookupUnits(run.Units)
+		if err != nil {
+			return nil, err
+		}
+		params.Units = units
+		params.Overrides["units"] = true
+	}
+	if physics.Box > 0 {
+		half := physics.Box / 2
+		params.Box = utils.NewPeriodicBox(utils.Vector2{X: -half, Y: -half}, utils.Vector2{X: half, Y: half}, physics.Ewald)
+	}
+
+	law, err := newForceLaw(physics.Force, params.G, physics.Softening, physics.Screening, physics.CoulombK, physics.A0, physics.Power)
+	if err != nil {
+		return nil, err
+	}
+	params.Force = law
+
+	if params.Integrator, err = utils.NewIntegrator(physics.Integrator); err != nil {
+		return nil, err
+	}
+
+	if physics.Boundary != "" {
+		policy, err := utils.ParseBoundaryPolicy(physics.Boundary)
+		if err != nil {
+			return nil, err
+		}
+		params.Boundary = &utils.Boundary{Policy: policy, Radius: physics.Radius}
+	}
+	if physics.BinaryRadius > 0 {
+		params.Regularizer = utils.NewRegularizer(physics.BinaryRadius)
+	}
+	if physics.PN != nil {
+		params.PN = &utils.PostNewtonian{C: physics.PN.C, Radius: physics.PN.Radius, Radiation: physics.PN.Radiation}
+	}
+
+	return params, params.Validate()
+}
+
+// scenarioInput returns where the bodies of a scenario come from: a dataset,
+// the inline list or a generated model.
+func scenarioInput(run *scenario.Scenario) (Input, error) {
+	if run.Input != "" {
+		if _, err := dataPath(run.Input); err != nil {
+			return nil, err
+		}
+		dataset := DataInput(run.Input)
+		return func() (utils.Bodies, utils.Header) {
+			bodies, header := dataset()
+			if run.Frames > 0 {
+				header.Frames = float64(run.Frames)
+			}
+			return bodies, header
+		}, nil
+	}
+
+	var bodies utils.Bodies
+	if run.Generator != nil {
+		generated, err := generateBodies(run)
+		if err != nil {
+			return nil, err
+		}
+		bodies.NodeBodies = generated
+	}
+	for _, body := range run.Bodies {
+		bodies.NodeBodies = append(bodies.NodeBodies, &utils.Body{
+			Name:       body.Name,
+			Positions:  utils.Vector2{X: body.Position[0], Y: body.Position[1]},
+			Velocities: utils.Vector2{X: body.Velocity[0], Y: body.Velocity[1]},
+			Mass:       body.Mass,
+			Charge:     body.Charge,
+		})
+	}
+
+	header := utils.Header{
+		Version:   utils.FormatVersion,
+		Units:     run.Units,
+		Frames:    float64(run.Frames),
+		Dimension: 2,
+		Columns:   utils.DefaultColumns,
+		Keys:      map[string]bool{},
+	}
+	return func() (utils.Bodies, utils.Header) {
+		return bodies, header
+	}, nil
+}
+
+// generateBodies runs the scenario's generator, with the generate command's
+// defaults for anything left out and G taken from the scenario's units.
+func generateBodies(run *scenario.Scenario) ([]*utils.Body, error) {
+	config := generate.DefaultConfig()
+	generator := run.Generator
+	if generator.N > 0 {
+		config.N = generator.N
+	}
+	if generator.Mass > 0 {
+		config.Mass = generator.Mass
+	}
+	if generator.Radius > 0 {
+		config.Radius = generator.Radius
+	}
+	if generator.CentralMass > 0 {
+		config.CentralMass = generator.CentralMass
+	}
+	if generator.Seed != 0 {
+		config.Seed = generator.Seed
+	}
+	if run.Units != "" {
+		units, err := utils.LookupUnits(run.Units)
+		if err != nil {
+			return nil, err
+		}
+		config.G = units.G()
+	}
+	return generate.Generate(generator.Model, config)
+}
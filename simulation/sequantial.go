@@ -1,15 +1,12 @@
 package main
 
 import (
-	"encoding/csv"
 	"fmt"
-	"os"
 	"proj3-redesigned/utils"
-	"strconv"
 	"time"
 )
 
-func simulate(root *utils.QuadNode, allBodies *utils.Bodies, dt float64, theta float64) {
+func simulate(root *utils.QuadNode, allBodies *utils.Bodies, params *utils.Params) {
 	if root == nil {
 		return
 	}
@@ -29,65 +26,80 @@ func simulate(root *utils.QuadNode, allBodies *utils.Bodies, dt float64, theta f
 			}
 
 			if curNode.BodiesPtr != nil && curNode.BodiesPtr.NodeBodies != nil {
-				curNode.CalculateForce(root, theta, dt)
+				curNode.CalculateForce(root, params)
 			}
 		}
 
 		nodeList = nextNodes
 	}
 
-	for _, body := range allBodies.NodeBodies {
-		body.Update(dt)
+	params.Integrator.Begin(allBodies, params)
+	for _, body := range params.TreeBodies(allBodies) {
+		params.Integrator.Step(body, params)
+	}
+	params.Integrator.End(allBodies, params)
+
+	if params.Regularizer != nil {
+		params.Regularizer.Advance(root, params)
 	}
 
 }
 
-func Sequential(inputLink string) {
+func Sequential(input Input, params *utils.Params) {
 
 	sequentialStart := time.Now()
 
-	root, bodies, simulationFrames, _ := BuildQuadTree(inputLink)
+	root, bodies, simulationFrames, _, err := BuildQuadTree(input, params)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
 
-	dt := 0.01 // Time step size
+	resultsFiles, escapersFile := outputFiles("sequential", params)
 
-	// Create and open a CSV file
-	file, err := os.Create("sequential_simulation_results.csv")
+	// Create the results files and write their headers
+	results, err := createResults(resultsFiles, params)
 	if err != nil {
-		fmt.Println("Error creating CSV file:", err)
+		fmt.Println("Error creating results file:", err)
 		return
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	trees, err := createTrees(params)
+	if err != nil {
+		fmt.Println("Error creating tree file:", err)
+		results.Close()
+		return
+	}
 
-	// Write headers
-	headers := []string{"Frame", "Body Name", "PosX", "PosY", "VelX", "VelY", "ForceX", "ForceY"}
-	writer.Write(headers)
+	var escapers []utils.Escaper
+	elapsed := 0.0 // Simulated time, summed a step at a time as a session does
 
 	for frame := 0; frame < int(simulationFrames); frame++ {
-		simulate(root, bodies, dt, 0.5)
-		root = RebuildQuadTree(bodies)
-
-		// Write positions and velocities for each body to the CSV
-		for _, body := range bodies.NodeBodies {
-			record := []string{
-				strconv.Itoa(frame),
-				body.Name,
-				fmt.Sprintf("%f", body.Positions.X),
-				fmt.Sprintf("%f", body.Positions.Y),
-				fmt.Sprintf("%f", body.Velocities.X),
-				fmt.Sprintf("%f", body.Velocities.Y),
-				fmt.Sprintf("%f", body.Force.X),
-				fmt.Sprintf("%f", body.Force.Y),
-			}
-			if err := writer.Write(record); err != nil {
-				fmt.Println("Error writing to CSV:", err)
-			}
+		simulate(root, bodies, params)
+		root = RebuildQuadTree(bodies, params)
+		root = applyBoundary(root, bodies, params, frame, &escapers)
+		root = applyRegularization(root, bodies, params)
+
+		// Write positions and velocities for the selected frames and bodies
+		elapsed += params.Dt
+		if err := results.WriteFrame(frame, elapsed, bodies.NodeBodies); err != nil {
+			fmt.Println("Error writing results:", err)
+		}
+		if err := trees.WriteTree(frame, elapsed, root); err != nil {
+			fmt.Println("Error writing tree:", err)
 		}
-		writer.Flush() // Flush after each frame to ensure data is written
 	}
 
+	// Finish writing before the clock stops, so that frames still queued for
+	// the writer count towards the run's time
+	if err := results.Close(); err != nil {
+		fmt.Println("Error writing results:", err)
+	}
+	if err := trees.Close(); err != nil {
+		fmt.Println("Error writing tree:", err)
+	}
+	writeEscapers(escapersFile, escapers, params)
+
 	sequentialEnd := time.Now()
 	sequentialTime := int(sequentialEnd.Sub(sequentialStart).Microseconds())
 
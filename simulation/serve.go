@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"proj3-redesigned/utils"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// page is the viewer served at /. It draws on a canvas with plain
+// JavaScript and loads nothing else, so it works without a network.
+//
+//go:embed serve.html
+var page []byte
+
+// Serve runs a dataset behind a local web page that draws the bodies as the
+// run goes and has controls to pause, resume and step it and to change dt and
+// theta. Its arguments are {flags} {size} {threads} {p or q}, with the engine
+// picked as for a normal run.
+func Serve(args []string, params *utils.Params) {
+
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	address := flags.String("addr", "localhost:8080", "address to listen on")
+	rate := flags.Float64("rate", 60, "frames simulated per second while running (0 for as fast as possible)")
+	frames := flags.Int("frames", 0, "frames to run (0 for the input's Frames, -1 until the server stops)")
+	paused := flags.Bool("paused", false, "start paused")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run simulate.go {optional: flags} serve {optional: serve flags} {size} {optional: threads} {optional: p or q}")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return
+	}
+	if *rate < 0 {
+		fmt.Println("Error: -rate cannot be negative")
+		return
+	}
+
+	numThreads, mode := 1, ""
+	if flags.NArg() > 1 {
+		var err error
+		if numThreads, err = strconv.Atoi(flags.Arg(1)); err != nil || numThreads < 1 {
+			fmt.Println("Error converting number of threads:", flags.Arg(1))
+			return
+		}
+	}
+	if flags.NArg() > 2 {
+		mode = flags.Arg(2)
+	}
+
+	session, err := NewSession(DataInput(flags.Arg(0)), params, mode, numThreads, *frames, *rate)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if *paused {
+		session.Pause()
+	}
+	running := make(chan struct{})
+	go func() {
+		session.Run()
+		close(running)
+	}()
+
+	listener, err := net.Listen("tcp", *address)
+	if err != nil {
+		fmt.Println("Error:", err)
+		session.Stop()
+		<-running
+		return
+	}
+	server := &http.Server{Handler: localOnly(sessionHandler(session))}
+	fmt.Printf("Serving %s on http://%s/ (control-C to stop)\n", flags.Arg(0), listener.Addr())
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	select {
+	case <-interrupt:
+	case err := <-served:
+		fmt.Println("Error:", err)
+	}
+
+	// Stopping the session ends the event streams, so the server can finish
+	session.Stop()
+	<-running
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+}
+
+// sessionHandler serves the page, the event stream and the controls of a
+// session:
+//
+//	GET  /          the viewer
+//	GET  /events    server-sent events, one JSON frame each, as Subscribe sends them
+//	GET  /state     the State
+//	GET  /bodies    every body, in the order of the positions of the frames
+//	POST /pause, /resume, /step
+//	POST /settings  {"dt": ..., "theta": ..., "rate": ...}, any may be left out
+//
+// The controls answer with the new State.
+func sessionHandler(session *Session) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		streamEvents(w, r, session)
+	})
+	mux.HandleFunc("/state", func(w http.ResponseWriter, r *http.Request) {
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, session.State())
+		}
+	})
+	mux.HandleFunc("/bodies", func(w http.ResponseWriter, r *http.Request) {
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, session.Bodies())
+		}
+	})
+	for path, control := range map[string]func(){
+		"/pause":  session.Pause,
+		"/resume": session.Resume,
+		"/step":   session.Step,
+	} {
+		control := control
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if allowMethod(w, r, http.MethodPost) {
+				control()
+				writeJSON(w, http.StatusOK, session.State())
+			}
+		})
+	}
+	mux.HandleFunc("/settings", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) || !requireJSON(w, r) {
+			return
+		}
+		var settings Settings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("bad settings: %w", err))
+			return
+		}
+		if err := session.Set(settings); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, session.State())
+	})
+	return mux
+}
+
+// streamEvents sends the frames of a session as server-sent events until
+// the client goes away or the session stops.
+func streamEvents(w http.ResponseWriter, r *http.Request, session *Session) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	frames := session.Subscribe()
+	defer session.Unsubscribe(frames)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case message, ok := <-frames:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", message); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// localOnly refuses requests that do not come from this machine. The Host
+// must be a loopback name, so a site that rebinds its DNS to 127.0.0.1 gets
+// nothing, and an Origin, which browsers send with requests from other
+// pages, must be a loopback one too, so no other site can drive the run.
+func localOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !loopback(r.Host) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("host %q is not local", r.Host))
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			parsed, err := url.Parse(origin)
+			if err != nil || !loopback(parsed.Host) {
+				writeError(w, http.StatusForbidden, fmt.Errorf("origin %q is not local", origin))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// loopback reports whether host, with or without a port, is localhost or
+// a loopback address.
+func loopback(host string) bool {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// requireJSON answers 415 to requests whose body is not application/json.
+// Browsers only send other pages' JSON after asking first, so this keeps
+// plain cross-site forms out.
+func requireJSON(w http.ResponseWriter, r *http.Request) bool {
+	if mediaType(r) == "application/json" {
+		return true
+	}
+	writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("%s needs Content-Type: application/json", r.URL.Path))
+	return false
+}
+
+// mediaType returns the media type of a request's Content-Type, without
+// parameters, or "" if there is none.
+func mediaType(r *http.Request) string {
+	media, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return media
+}
+
+// allowMethod answers 405 to requests with any other method.
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s needs %s", r.URL.Path, method))
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError answers with {"error": message}.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,631 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"proj3-redesigned/sink"
+	"proj3-redesigned/utils"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// publishEvery is the shortest time between the frames a running session
+// sends to its subscribers; frames in between are only simulated.
+const publishEvery = time.Second / 60
+
+// stepFrame advances a run by one frame with the engine of mode: p for the
+// parallel engine, q for the work-queue engine and anything else for the
+// sequential one. It returns the tree to use for the next frame.
+func stepFrame(root *utils.QuadNode, bodies *utils.Bodies, params *utils.Params, mode string, numWorkers int, frame int, escapers *[]utils.Escaper) *utils.QuadNode {
+	switch mode {
+	case "p":
+		simulateParallel(root, bodies, params, numWorkers)
+	case "q":
+		simulateWQParallel(root, bodies, params, numWorkers)
+	default:
+		simulate(root, bodies, params)
+	}
+	root = RebuildQuadTree(bodies, params)
+	root = applyBoundary(root, bodies, params, frame, escapers)
+	return applyRegularization(root, bodies, params)
+}
+
+// Session is a run that is stepped under outside control: it can be paused,
+// resumed and stepped a frame at a time, its time step and opening angle can
+// be changed between frames, and every frame can be sent to subscribers.
+type Session struct {
+	mutex    sync.Mutex
+	params   *utils.Params
+	mode     string
+	workers  int
+	root     *utils.QuadNode
+	bodies   *utils.Bodies
+	view     []utils.Body // The bodies as of the last frame, for readers while the next is computed
+	busy     bool         // A frame is being computed outside the mutex
+	waiting  int          // Changes waiting for the frame to end, which go before the next
+	frame    int          // Frames done so far
+	time     float64      // Simulated time, which is frame*dt only while dt is unchanged
+	frames   int          // Frames to run, negative for no limit
+	paused   bool
+	steps    int // Frames to step while paused
+	stopped  bool
+	closed   bool    // The outputs are closed and no more frames will come
+	rate     float64 // Frames per second while running, 0 for as fast as possible
+	wake     chan struct{}
+	stepped  *sync.Cond // Signalled after each frame and when the run stops
+	results  sink.OutputSink
+	trees    *treeOutput
+	escapers []utils.Escaper
+	escaped  string // Escapers file, "" when no results are written
+
+	members     []*utils.Body // Bodies when version was last changed
+	version     int
+	published   time.Time
+	subscribers map[chan []byte]bool
+}
+
+// NewSession reads the input and builds the first tree. Results are written
+// only when params.Outputs names files. frames < 0 runs until Stop, and 0
+// runs for the Frames of the input; rate is the pace while running, in frames
+// per second, 0 for as fast as possible.
+func NewSession(input Input, params *utils.Params, mode string, workers int, frames int, rate float64) (session *Session, err error) {
+	// The input readers panic on files they cannot use, which must not take
+	// down a server
+	defer func() {
+		if problem := recover(); problem != nil {
+			session, err = nil, fmt.Errorf("%v", problem)
+		}
+	}()
+
+	root, bodies, inputFrames, _, err := BuildQuadTree(input, params)
+	if err != nil {
+		return nil, err
+	}
+	if frames == 0 {
+		frames = int(inputFrames)
+	}
+	session = &Session{
+		params:      params,
+		mode:        mode,
+		workers:     workers,
+		root:        root,
+		bodies:      bodies,
+		frames:      frames,
+		rate:        rate,
+		wake:        make(chan struct{}, 1),
+		subscribers: map[chan []byte]bool{},
+	}
+	session.stepped = sync.NewCond(&session.mutex)
+	session.members = append([]*utils.Body(nil), bodies.NodeBodies...)
+	session.view = viewOf(bodies)
+
+	if len(params.Outputs) > 0 {
+		var files []string
+		files, session.escaped = outputFiles("serve", params)
+		results, err := createResults(files, params)
+		if err != nil {
+			return nil, err
+		}
+		session.results = results
+	}
+	trees, err := createTrees(params)
+	if err != nil {
+		if session.results != nil {
+			session.results.Close()
+		}
+		return nil, err
+	}
+	session.trees = trees
+	return session, nil
+}
+
+// Run steps the session until it is stopped, and then closes its outputs.
+func (session *Session) Run() {
+	next := time.Now()
+	for {
+		session.mutex.Lock()
+		if session.stopped {
+			session.mutex.Unlock()
+			break
+		}
+		if session.waiting > 0 {
+			// Changes that waited for the last frame go first
+			session.stepped.Wait()
+			session.mutex.Unlock()
+			continue
+		}
+		stepping := session.paused && session.steps > 0
+		if session.finished() || (session.paused && !stepping) {
+			session.publish(true)
+			session.mutex.Unlock()
+			<-session.wake
+			next = time.Now()
+			continue
+		}
+		if !stepping && session.rate > 0 {
+			if wait := time.Until(next); wait > 0 {
+				session.mutex.Unlock()
+				select {
+				case <-session.wake:
+				case <-time.After(wait):
+				}
+				continue
+			}
+			next = next.Add(time.Duration(float64(time.Second) / session.rate))
+			if behind := time.Now(); next.Before(behind) {
+				next = behind // Do not race to catch up after a slow frame
+			}
+		}
+		if stepping {
+			session.steps--
+		}
+		session.advance()
+		session.publish(stepping)
+		session.stepped.Broadcast()
+		session.mutex.Unlock()
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.close()
+	session.stepped.Broadcast()
+}
+
+// advance runs one frame and writes it to the outputs. The mutex must be
+// held; it is released while the frame is computed, when nothing else may
+// change the run, and the new state is swapped in once it is taken again.
+func (session *Session) advance() {
+	session.busy = true
+	session.mutex.Unlock()
+
+	frame := session.frame
+	elapsed := session.time + session.params.Dt
+	root := stepFrame(session.root, session.bodies, session.params, session.mode, session.workers, frame, &session.escapers)
+	if session.results != nil {
+		if err := session.results.WriteFrame(frame, elapsed, session.bodies.NodeBodies); err != nil {
+			fmt.Println("Error writing results:", err)
+		}
+	}
+	if err := session.trees.WriteTree(frame, elapsed, root); err != nil {
+		fmt.Println("Error writing tree:", err)
+	}
+	view := viewOf(session.bodies)
+
+	session.mutex.Lock()
+	session.root, session.view = root, view
+	session.frame++
+	session.time = elapsed
+	session.busy = false
+	session.track()
+}
+
+// viewOf copies bodies for readers of the session.
+func viewOf(bodies *utils.Bodies) []utils.Body {
+	view := make([]utils.Body, len(bodies.NodeBodies))
+	for i, body := range bodies.NodeBodies {
+		view[i] = *body
+	}
+	return view
+}
+
+// idle waits until no frame is being computed, so that the run can be
+// changed, and holds the next frame back until then. The mutex must be held.
+func (session *Session) idle() {
+	session.waiting++
+	for session.busy {
+		session.stepped.Wait()
+	}
+	session.waiting--
+	session.stepped.Broadcast()
+}
+
+// track bumps the version when bodies have been removed, so subscribers know
+// to fetch the body list again. The mutex must be held.
+func (session *Session) track() {
+	bodies := session.bodies.NodeBodies
+	changed := len(bodies) != len(session.members)
+	for i := 0; !changed && i < len(bodies); i++ {
+		changed = bodies[i] != session.members[i]
+	}
+	if changed {
+		session.members = append(session.members[:0], bodies...)
+		session.version++
+	}
+}
+
+// close flushes the outputs once the run has stopped. The mutex must be held.
+func (session *Session) close() {
+	session.closed = true
+	if session.results != nil {
+		session.results.Close()
+		writeEscapers(session.escaped, session.escapers, session.params)
+		session.results = nil
+	}
+	session.trees.Close()
+	for subscriber := range session.subscribers {
+		close(subscriber)
+		delete(session.subscribers, subscriber)
+	}
+}
+
+// notify wakes the run loop after a change of state.
+func (session *Session) notify() {
+	select {
+	case session.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Pause stops the run after the current frame.
+func (session *Session) Pause() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.paused = true
+	session.notify()
+}
+
+// Resume continues a paused run.
+func (session *Session) Resume() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.paused, session.steps = false, 0
+	session.notify()
+	session.stepped.Broadcast()
+}
+
+// Step pauses the run and advances it by one frame, returning once the
+// frame is done, or at once if the run has finished.
+func (session *Session) Step() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.paused = true
+	session.steps++
+	session.notify()
+	for session.steps > 0 && session.paused && !session.closed && !session.finished() {
+		session.stepped.Wait()
+	}
+}
+
+// finished reports whether the run has done all its frames. The mutex must
+// be held.
+func (session *Session) finished() bool {
+	return session.frames >= 0 && session.frame >= session.frames
+}
+
+// Stop ends the run; Run returns once the current frame is done.
+func (session *Session) Stop() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.stopped = true
+	session.notify()
+}
+
+// Settings are the parts of a run that can be changed while it goes, in
+// the units of the run. Settings left nil are kept.
+type Settings struct {
+	Dt    *float64 `json:"dt"`
+	Theta *float64 `json:"theta"`
+	Rate  *float64 `json:"rate"` // Frames per second while running, 0 for as fast as possible
+}
+
+// Set changes the time step and the opening angle from the next frame on,
+// and the pace of the run at once.
+func (session *Session) Set(settings Settings) error {
+	if settings.Dt != nil && !(*settings.Dt > 0) {
+		return errors.New("dt must be positive")
+	}
+	if settings.Theta != nil && !(*settings.Theta >= 0) {
+		return errors.New("theta cannot be negative")
+	}
+	if settings.Rate != nil && !(*settings.Rate >= 0) {
+		return errors.New("rate cannot be negative")
+	}
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.idle()
+	if settings.Dt != nil {
+		session.params.Dt = *settings.Dt
+	}
+	if settings.Theta != nil {
+		session.params.Theta = *settings.Theta
+	}
+	if settings.Rate != nil {
+		session.rate = *settings.Rate
+		session.notify()
+	}
+	session.publish(true)
+	return nil
+}
+
+// State is the progress and settings of a session.
+type State struct {
+	State   string  `json:"state"` // running, paused, finished or stopped
+	Frame   int     `json:"frame"`
+	Frames  int     `json:"frames"` // -1 for no limit
+	Time    float64 `json:"time"`
+	Dt      float64 `json:"dt"`
+	Theta   float64 `json:"theta"`
+	Rate    float64 `json:"rate"`
+	Bodies  int     `json:"bodies"`
+	Version int     `json:"version"` // Changes whenever bodies are added or removed
+}
+
+// State returns the progress and settings of the session.
+func (session *Session) State() State {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	return session.state()
+}
+
+func (session *Session) state() State {
+	state := State{
+		State:   "running",
+		Frame:   session.frame,
+		Frames:  session.frames,
+		Time:    session.time,
+		Dt:      session.params.Dt,
+		Theta:   session.params.Theta,
+		Rate:    session.rate,
+		Bodies:  len(session.view),
+		Version: session.version,
+	}
+	if state.Frames < 0 {
+		state.Frames = -1
+	}
+	switch {
+	case session.stopped:
+		state.State = "stopped"
+	case session.finished():
+		state.State = "finished"
+	case session.paused:
+		state.State = "paused"
+	}
+	return state
+}
+
+// BodyInfo describes a body of a session.
+type BodyInfo struct {
+	Name     string     `json:"name"`
+	Mass     float64    `json:"mass"`
+	Charge   float64    `json:"charge"`
+	Position [2]float64 `json:"position"`
+	Velocity [2]float64 `json:"velocity"`
+}
+
+// Bodies returns the bodies of the session in the units of the run, in the
+// order of the positions of its frames.
+func (session *Session) Bodies() []BodyInfo {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	bodies := make([]BodyInfo, len(session.view))
+	for i, body := range session.view {
+		bodies[i] = BodyInfo{
+			Name:     body.Name,
+			Mass:     body.Mass,
+			Charge:   body.Charge,
+			Position: [2]float64{body.Positions.X, body.Positions.Y},
+			Velocity: [2]float64{body.Velocities.X, body.Velocities.Y},
+		}
+	}
+	return bodies
+}
+
+// Subscribe returns a channel that receives each published frame as a JSON
+// object holding the State and the flattened positions, x0, y0, x1, ...
+// A subscriber that falls behind only misses frames: it always gets the
+// latest. The channel is closed when the session stops.
+func (session *Session) Subscribe() chan []byte {
+	subscriber := make(chan []byte, 1)
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	if session.closed {
+		close(subscriber)
+		return subscriber
+	}
+	session.subscribers[subscriber] = true
+	subscriber <- session.message()
+	return subscriber
+}
+
+// Unsubscribe stops sending frames to subscriber.
+func (session *Session) Unsubscribe(subscriber chan []byte) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	if session.subscribers[subscriber] {
+		delete(session.subscribers, subscriber)
+		close(subscriber)
+	}
+}
+
+// publish sends the current frame to every subscriber, at most every
+// publishEvery unless forced. The mutex must be held.
+func (session *Session) publish(force bool) {
+	if len(session.subscribers) == 0 || (!force && time.Since(session.published) < publishEvery) {
+		return
+	}
+	session.published = time.Now()
+	message := session.message()
+	for subscriber := range session.subscribers {
+		select {
+		case <-subscriber: // Drop the frame it has not read yet
+		default:
+		}
+		subscriber <- message
+	}
+}
+
+// message encodes the current frame. The positions are written with seven
+// significant digits, which is plenty for drawing and keeps large runs
+// small on the wire. The mutex must be held.
+func (session *Session) message() []byte {
+	state := session.state()
+	message := []byte(`{"state":`)
+	message = strconv.AppendQuote(message, state.State)
+	message = append(message, `,"frame":`...)
+	message = strconv.AppendInt(message, int64(state.Frame), 10)
+	message = append(message, `,"frames":`...)
+	message = strconv.AppendInt(message, int64(state.Frames), 10)
+	message = append(message, `,"time":`...)
+	message = appendNumber(message, state.Time, -1)
+	message = append(message, `,"dt":`...)
+	message = appendNumber(message, state.Dt, -1)
+	message = append(message, `,"theta":`...)
+	message = appendNumber(message, state.Theta, -1)
+	message = append(message, `,"rate":`...)
+	message = appendNumber(message, state.Rate, -1)
+	message = append(message, `,"bodies":`...)
+	message = strconv.AppendInt(message, int64(state.Bodies), 10)
+	message = append(message, `,"version":`...)
+	message = strconv.AppendInt(message, int64(state.Version), 10)
+	message = append(message, `,"positions":[`...)
+	for i, body := range session.view {
+		if i > 0 {
+			message = append(message, ',')
+		}
+		message = appendNumber(message, body.Positions.X, 7)
+		message = append(message, ',')
+		message = appendNumber(message, body.Positions.Y, 7)
+	}
+	return append(message, "]}"...)
+}
+
+// appendNumber writes value as a JSON number, or null when it is not finite.
+func appendNumber(out []byte, value float64, digits int) []byte {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return append(out, "null"...)
+	}
+	return strconv.AppendFloat(out, value, 'g', digits, 64)
+}
+
+var (
+	errFinished = errors.New("the run has stopped")
+	errNoBody   = errors.New("no such body")
+)
+
+// Body returns the body with the given name.
+func (session *Session) Body(name string) (BodyInfo, error) {
+	for _, body := range session.Bodies() {
+		if body.Name == name {
+			return body, nil
+		}
+	}
+	return BodyInfo{}, fmt.Errorf("%w %q", errNoBody, name)
+}
+
+// Add puts new bodies into the run before its next frame. Names must be
+// new, since bodies are removed by name, and masses positive.
+func (session *Session) Add(bodies []BodyInfo) error {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.idle()
+	if session.stopped {
+		return errFinished
+	}
+
+	names := map[string]bool{}
+	for _, body := range session.bodies.NodeBodies {
+		names[body.Name] = true
+	}
+	for _, body := range bodies {
+		switch {
+		case body.Name == "":
+			return errors.New("every body needs a name")
+		case names[body.Name]:
+			return fmt.Errorf("there is already a body named %q", body.Name)
+		case !(body.Mass > 0):
+			return fmt.Errorf("body %q needs a positive mass", body.Name)
+		}
+		for _, value := range []float64{body.Charge, body.Position[0], body.Position[1], body.Velocity[0], body.Velocity[1]} {
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				return fmt.Errorf("body %q has a value that is not finite", body.Name)
+			}
+		}
+		names[body.Name] = true
+	}
+
+	for _, body := range bodies {
+		added := &utils.Body{
+			Name:       body.Name,
+			Positions:  utils.Vector2{X: body.Position[0], Y: body.Position[1]},
+			Velocities: utils.Vector2{X: body.Velocity[0], Y: body.Velocity[1]},
+			Mass:       body.Mass,
+			Charge:     body.Charge,
+		}
+		if session.params.Box != nil {
+			added.Positions = session.params.Box.Wrap(added.Positions)
+		}
+		session.bodies.NodeBodies = append(session.bodies.NodeBodies, added)
+	}
+	session.changed()
+	return nil
+}
+
+// Remove takes the named body out of the run before its next frame. The
+// central body of the Wisdom-Holman integrator and the members of a
+// regularized binary cannot be removed.
+func (session *Session) Remove(name string) error {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.idle()
+	if session.stopped {
+		return errFinished
+	}
+
+	index := -1
+	for i, body := range session.bodies.NodeBodies {
+		if body.Name == name {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("%w %q", errNoBody, name)
+	}
+	body := session.bodies.NodeBodies[index]
+	if wh, ok := session.params.Integrator.(*utils.WisdomHolman); ok && wh.Central == body {
+		return fmt.Errorf("%q is the central body of the Wisdom-Holman integrator", name)
+	}
+	if session.params.Regularizer != nil && session.params.Regularizer.InBinary(body) {
+		return fmt.Errorf("%q is part of a regularized binary", name)
+	}
+
+	bodies := session.bodies.NodeBodies
+	session.bodies.NodeBodies = append(bodies[:index:index], bodies[index+1:]...)
+	session.changed()
+	return nil
+}
+
+// changed rebuilds the tree after bodies were added or removed and tells
+// the subscribers. The mutex must be held, with no frame being computed.
+func (session *Session) changed() {
+	session.root = RebuildQuadTree(session.bodies, session.params)
+	session.view = viewOf(session.bodies)
+	session.track()
+	session.publish(true)
+}
+
+// WriteSnapshot writes the bodies as they are now to a results file in the
+// format of its extension, as one frame numbered like those of the results:
+// frame n holds the state after n+1 frames, so a run that has not started
+// gives frame -1. It returns the frame number.
+func (session *Session) WriteSnapshot(filename string) (int, error) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	output, err := sink.Create(filename, sinkOptions(session.params))
+	if err != nil {
+		return 0, err
+	}
+	bodies := make([]*utils.Body, len(session.view))
+	for i := range session.view {
+		bodies[i] = &session.view[i]
+	}
+	frame := session.frame - 1
+	err = output.WriteFrame(frame, session.time, bodies)
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	return frame, err
+}
@@ -1,35 +1,254 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"os"
+	"proj3-redesigned/utils"
 	"strconv"
+	"strings"
 )
 
+const usage = "Usage: go run simulate.go {optional: flags} {size} {optional: threads} {optional: p or q}\n" +
+	"       go run simulate.go {optional: flags} verify {size} {optional: frames} {optional: threads} {optional: p or q}\n" +
+	"       go run simulate.go generate {optional: flags} {model} {name}\n" +
+	"       go run simulate.go run {optional: flags} {scenario.json or scenario.yaml}\n" +
+	"       go run simulate.go convert {optional: flags} {snapshot.nbs} {optional: output.csv}\n" +
+	"       go run simulate.go render {flags} {results file}\n" +
+	"       go run simulate.go watch {optional: flags} {optional: results files}\n" +
+	"       go run simulate.go {optional: flags} serve {optional: serve flags} {size} {optional: threads} {optional: p or q}\n" +
+	"       go run simulate.go api {optional: flags}"
+
 func main() {
 
-	if len(os.Args) == 1 {
-		fmt.Println("Usage: go run simulate.go {size} {optional: threads} {optional: p or q}")
+	boxSize := flag.Float64("box", 0, "side length of a periodic box centred on the origin (0 for an open domain)")
+	ewald := flag.Bool("ewald", true, "apply the Ewald correction for periodic images when -box is set")
+	boundary := flag.String("boundary", "", "boundary policy for an open domain: remove, unbound, reflect or absorb")
+	radius := flag.Float64("radius", 0, "radius used by the remove, reflect and absorb boundary policies")
+	forceLaw := flag.String("force", "newton", "pairwise force law: newton, softened, yukawa, coulomb, electrogravity, mond or power")
+	softening := flag.Float64("softening", 0, "softening length for the softened force law")
+	screening := flag.Float64("screening", 0, "screening length for the yukawa force law")
+	coulombK := flag.Float64("coulomb-k", 8.9875517923e9, "Coulomb constant for the coulomb and electrogravity force laws, in SI")
+	a0 := flag.Float64("a0", 1.2e-10, "acceleration scale for the mond force law, in m/s^2")
+	power := flag.Float64("power", 2, "exponent n of the r^-n power force law")
+	pnC := flag.Float64("pn-c", 0, "speed of light for post-Newtonian corrections, in m/s (0 disables them)")
+	pnRadius := flag.Float64("pn-radius", 0, "pairs closer than this, in the units of the input, get post-Newtonian corrections")
+	pnRadiation := flag.Bool("pn-radiation", false, "add the 2.5PN radiation-reaction term")
+	integrator := flag.String("integrator", "leapfrog", "integrator: leapfrog, wh (Wisdom-Holman around the heaviest body) or hermite")
+	dt := flag.Float64("dt", 0.01, "time step size")
+	theta := flag.Float64("theta", 0.5, "Barnes-Hut opening angle (0 for direct summation)")
+	binaryRadius := flag.Float64("binary-radius", 0, "regularize bound pairs closer than this (0 disables regularization)")
+	units := flag.String("units", "", "unit system of the input (si, au, kpc or henon), overriding the file's Units header")
+	outputUnits := flag.String("output-units", "", "unit system of the output columns (si, au, kpc or henon)")
+	format := flag.String("format", "csv", "format of the default results file: csv, binary for a snapshot that keeps every digit, jsonl, or vtk for ParaView")
+	outputs := flag.String("output", "", "comma-separated results files, each in the format of its extension: .csv, .nbs, .jsonl or .pvd, with .gz or .zst added to compress with gzip or Zstandard")
+	every := flag.Int("every", 1, "write every k-th frame")
+	interval := flag.Float64("interval", 0, "write once per this much simulated time instead of by frame count")
+	columns := flag.String("columns", "", "comma-separated value columns to write, such as PosX,PosY (default all)")
+	bodyPatterns := flag.String("bodies", "", "comma-separated shell patterns of the body names to write, such as 'Planet 1*' (default all)")
+	flush := flag.Int("flush", 1, "flush the results after this many written frames (0 only at the end)")
+	buffer := flag.Int("buffer", 8, "frames queued for the output goroutine (0 writes on the engine's goroutine)")
+	tree := flag.String("tree", "", "export the quadtree of each written frame to this .csv, .json or .pvd file")
+	flag.Usage = func() {
+		fmt.Println(usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+
+	if len(args) == 0 {
+		flag.Usage()
+		return
+	}
+
+	if args[0] == "generate" {
+		Generate(args[1:])
+		return
+	}
+
+	if args[0] == "run" {
+		RunScenario(args[1:])
+		return
+	}
+
+	if args[0] == "convert" {
+		Convert(args[1:])
+		return
 	}
 
-	if len(os.Args) < 3 {
-		inputLink := os.Args[1]
-		Sequential(inputLink)
+	if args[0] == "watch" {
+		Watch(args[1:])
+		return
+	}
+
+	if args[0] == "render" {
+		Render(args[1:])
+		return
+	}
+
+	if args[0] == "api" {
+		API(args[1:])
+		return
+	}
+
+	params := utils.NewParams()
+	params.Dt = *dt
+	params.Theta = *theta
+	// Flags given explicitly win over the input file's header
+	params.Overrides = map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { params.Overrides[f.Name] = true })
+	if *outputUnits != "" {
+		if _, err := utils.LookupUnits(*outputUnits); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+	}
+	params.OutputUnits = *outputUnits
+	params.OutputFormat = *format
+	if *outputs != "" {
+		params.Outputs = strings.Split(*outputs, ",")
+	}
+	params.Select = utils.Selection{Every: *every, Interval: *interval, Flush: *flush}
+	params.OutputBuffer = *buffer
+	params.TreeOutput = *tree
+	if *columns != "" {
+		params.Select.Columns = strings.Split(*columns, ",")
+	}
+	if *bodyPatterns != "" {
+		params.Select.Bodies = strings.Split(*bodyPatterns, ",")
+	}
+	if err := checkOutput(params); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if *units != "" {
+		system, err := utils.LookupUnits(*units)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		params.Units = system
+	}
+	if *boxSize > 0 {
+		half := *boxSize / 2
+		params.Box = utils.NewPeriodicBox(utils.Vector2{X: -half, Y: -half}, utils.Vector2{X: half, Y: half}, *ewald)
+	}
+
+	law, err := newForceLaw(*forceLaw, params.G, *softening, *screening, *coulombK, *a0, *power)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	params.Force = law
+
+	if params.Integrator, err = utils.NewIntegrator(*integrator); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	if *boundary != "" {
+		policy, err := utils.ParseBoundaryPolicy(*boundary)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		params.Boundary = &utils.Boundary{Policy: policy, Radius: *radius}
+	}
+
+	if *binaryRadius > 0 {
+		params.Regularizer = utils.NewRegularizer(*binaryRadius)
+	}
+
+	if *pnC > 0 {
+		params.PN = &utils.PostNewtonian{C: *pnC, Radius: *pnRadius, Radiation: *pnRadiation}
+	}
+
+	if err := params.Validate(); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	if args[0] == "verify" {
+		runVerify(args[1:], params)
+		return
+	}
+
+	if args[0] == "serve" {
+		Serve(args[1:], params)
+		return
+	}
+
+	if len(args) < 2 {
+		inputLink := args[0]
+		Sequential(DataInput(inputLink), params)
 	} else {
-		inputLink := os.Args[1]
-		numThreadsStr := os.Args[2]
+		inputLink := args[0]
+		numThreadsStr := args[1]
 		numThreads, err := strconv.Atoi(numThreadsStr)
 		if err != nil {
 			// Handle the error if the conversion fails
 			fmt.Println("Error converting number of threads:", err)
-			fmt.Println("Usage: go run simulate.go {size} {optional: threads} {optional: p or q}")
+			fmt.Println(usage)
 			return
 		}
 
-		if len(os.Args) > 3 && os.Args[3] == "p" {
-			Parallel(inputLink, numThreads)
-		} else if len(os.Args) > 3 && os.Args[3] == "q" {
-			WQParallel(inputLink, numThreads)
+		if len(args) > 2 && args[2] == "p" {
+			Parallel(DataInput(inputLink), numThreads, params)
+		} else if len(args) > 2 && args[2] == "q" {
+			WQParallel(DataInput(inputLink), numThreads, params)
+		}
+	}
+}
+
+func newForceLaw(name string, G float64, softening float64, screening float64, coulombK float64, a0 float64, power float64) (utils.ForceLaw, error) {
+	switch name {
+	case "newton":
+		return utils.Newtonian{G: G}, nil
+	case "softened":
+		if softening <= 0 {
+			return nil, fmt.Errorf("the softened force law needs a positive -softening")
+		}
+		return utils.Softened{G: G, Softening: softening}, nil
+	case "yukawa":
+		if screening <= 0 {
+			return nil, fmt.Errorf("the yukawa force law needs a positive -screening")
+		}
+		return utils.Yukawa{G: G, Length: screening}, nil
+	case "coulomb":
+		return utils.Coulomb{K: coulombK}, nil
+	case "electrogravity":
+		return utils.Electrogravity{G: G, K: coulombK}, nil
+	case "mond":
+		return utils.MOND{G: G, A0: a0}, nil
+	case "power":
+		return utils.PowerLaw{G: G, N: power}, nil
+	}
+	return nil, fmt.Errorf("unknown force law %q", name)
+}
+
+// runVerify parses the arguments of the verify command: {size} {frames} {threads} {p or q}.
+func runVerify(args []string, params *utils.Params) {
+	if len(args) == 0 {
+		fmt.Println(usage)
+		return
+	}
+
+	frames, numThreads, mode := 100, 1, ""
+	var err error
+	if len(args) > 1 {
+		if frames, err = strconv.Atoi(args[1]); err != nil {
+			fmt.Println("Error converting number of frames:", err)
+			return
+		}
+	}
+	if len(args) > 2 {
+		if numThreads, err = strconv.Atoi(args[2]); err != nil {
+			fmt.Println("Error converting number of threads:", err)
+			return
 		}
 	}
+	if len(args) > 3 {
+		mode = args[3]
+	}
+
+	Verify(DataInput(args[0]), frames, numThreads, mode, params)
 }
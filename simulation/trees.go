@@ -5,52 +5,101 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"proj3-redesigned/compression"
 	"proj3-redesigned/quadtree"
 	"proj3-redesigned/utils"
 )
 
-func BuildQuadTree(inputLink string) (*utils.QuadNode, *utils.Bodies, float64, float64) {
+// Input supplies the bodies and header a run starts from.
+type Input func() (utils.Bodies, utils.Header)
 
-	// Read Input
+// DataInput reads the dataset simulation/data/{inputLink}.csv, or its
+// compressed form {inputLink}.csv.gz or {inputLink}.csv.zst.
+func DataInput(inputLink string) Input {
+	return func() (utils.Bodies, utils.Header) {
+		dataDir, _ := dataPath(inputLink)
+		return utils.ReadInput(dataDir)
+	}
+}
+
+// dataPath returns the file DataInput reads for inputLink, or an error if
+// there is none. The path of the plain CSV is returned with the error.
+func dataPath(inputLink string) (string, error) {
 	cwd, _ := os.Getwd()
 	fileName := fmt.Sprintf("simulation/data/%s.csv", inputLink)
 	dataDir := filepath.Join(cwd, fileName)
-	bodies, SimulationFrames, GravitationalConstant := utils.ReadInput(dataDir)
+	if _, err := os.Stat(dataDir); err == nil {
+		return dataDir, nil
+	}
+	for _, extension := range []string{compression.Gzip, compression.Zstd} {
+		if _, err := os.Stat(dataDir + extension); err == nil {
+			return dataDir + extension, nil
+		}
+	}
+	return dataDir, fmt.Errorf("no dataset %q: %s does not exist, compressed or not", inputLink, fileName)
+}
 
-	var minimums, maximums utils.Vector2
+// BuildQuadTree reads the input, applies its header to params and builds the
+// first tree. It returns an error if the header or the bodies cannot be used
+// with params.
+func BuildQuadTree(input Input, params *utils.Params) (*utils.QuadNode, *utils.Bodies, float64, float64, error) {
 
-	minimums.X, minimums.Y = math.MaxFloat64, math.MaxFloat64
-	maximums.X, maximums.Y = -math.MaxFloat64, -math.MaxFloat64
+	// Read Input
+	bodies, header := input()
 
-	for _, body := range bodies.NodeBodies {
+	if err := params.ApplyHeader(header, &bodies); err != nil {
+		return nil, nil, 0, 0, err
+	}
 
-		minimums.X = math.Min(minimums.X, body.Positions.X)
-		maximums.X = math.Max(maximums.X, body.Positions.X)
+	// A periodic run starts with every body inside the box
+	if params.Box != nil {
+		for _, body := range bodies.NodeBodies {
+			body.Positions = params.Box.Wrap(body.Positions)
+		}
+	}
 
-		minimums.Y = math.Min(minimums.Y, body.Positions.Y)
-		maximums.Y = math.Max(maximums.Y, body.Positions.Y)
+	params.Integrator.Init(&bodies, params)
 
-	}
+	root := quadtree.BuildQuadTree(params.TreeBodies(&bodies), rootRegion(&bodies, params))
 
-	// Starting Region
-	startRegion := [2]utils.Vector2{{minimums.X - 1, minimums.Y - 1},
-		{maximums.X + 1, maximums.Y + 1},
-	} // Example bounds
-	root := quadtree.BuildQuadTree(bodies.NodeBodies, startRegion)
+	return root, &bodies, header.Frames, header.G, nil
 
-	return root, &bodies, SimulationFrames, GravitationalConstant
+}
+
+func RebuildQuadTree(bodies *utils.Bodies, params *utils.Params) *utils.QuadNode {
+
+	root := quadtree.BuildQuadTree(params.TreeBodies(bodies), rootRegion(bodies, params))
+	//fmt.Println("Successfully built Quadtree")
+
+	root.TotalMass = 1
+
+	return root
 
 }
 
-func RebuildQuadTree(bodies *utils.Bodies) *utils.QuadNode {
+// applyRegularization splits and forms regularized binaries on the freshly
+// rebuilt tree, rebuilding it again if the set of binaries changed.
+func applyRegularization(root *utils.QuadNode, bodies *utils.Bodies, params *utils.Params) *utils.QuadNode {
+	if params.Regularizer == nil || !params.Regularizer.Update(root, bodies, params) {
+		return root
+	}
+	return RebuildQuadTree(bodies, params)
+}
+
+// rootRegion returns the region covered by the root of the quadtree: the
+// periodic cell when there is one, otherwise the bounds of the bodies padded by 1.
+func rootRegion(bodies *utils.Bodies, params *utils.Params) [2]utils.Vector2 {
+
+	if params.Box != nil {
+		return params.Box.Region()
+	}
 
-	// Read Input
 	var minimums, maximums utils.Vector2
 
 	minimums.X, minimums.Y = math.MaxFloat64, math.MaxFloat64
 	maximums.X, maximums.Y = -math.MaxFloat64, -math.MaxFloat64
 
-	for _, body := range bodies.NodeBodies {
+	for _, body := range params.TreeBodies(bodies) {
 
 		minimums.X = math.Min(minimums.X, body.Positions.X)
 		maximums.X = math.Max(maximums.X, body.Positions.X)
@@ -61,14 +110,9 @@ func RebuildQuadTree(bodies *utils.Bodies) *utils.QuadNode {
 	}
 
 	// Starting Region
-	startRegion := [2]utils.Vector2{{minimums.X - 1, minimums.Y - 1},
-		{maximums.X + 1, maximums.Y + 1},
-	} // Example bounds
-	root := quadtree.BuildQuadTree(bodies.NodeBodies, startRegion)
-	//fmt.Println("Successfully built Quadtree")
-
-	root.TotalMass = 1
-
-	return root
+	return [2]utils.Vector2{
+		{X: minimums.X - 1, Y: minimums.Y - 1},
+		{X: maximums.X + 1, Y: maximums.Y + 1},
+	}
 
 }
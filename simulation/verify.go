@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"proj3-redesigned/utils"
+)
+
+// Verify runs a dataset forward for the given number of frames, negates
+// every velocity, runs the same number of frames back and reports how far
+// each body ends up from where it started, along with the energy drift. An
+// exactly time-reversible scheme returns every body to its initial state, so
+// regressions in the update, the force pass or the tree rebuild show up at once.
+func Verify(input Input, frames int, numWorkers int, mode string, params *utils.Params) {
+
+	root, bodies, _, _, err := BuildQuadTree(input, params)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	initial := make(map[*utils.Body]utils.Body, len(bodies.NodeBodies))
+	for _, body := range bodies.NodeBodies {
+		initial[body] = *body
+	}
+	initialEnergy := bodies.TotalEnergy(params)
+
+	var escapers []utils.Escaper
+	run := func() {
+		for frame := 0; frame < frames; frame++ {
+			root = stepFrame(root, bodies, params, mode, numWorkers, frame, &escapers)
+		}
+	}
+
+	run()
+	forwardEnergy := bodies.TotalEnergy(params)
+
+	params.Reverse(bodies)
+	root = RebuildQuadTree(bodies, params)
+	run()
+	params.Reverse(bodies)
+	backEnergy := bodies.TotalEnergy(params)
+
+	fmt.Printf("%-20s %15s %15s\n", "Body Name", "PosDeviation", "VelDeviation")
+	maxPosition, maxVelocity := 0.0, 0.0
+	sumPosition, sumVelocity := 0.0, 0.0
+	for _, body := range bodies.NodeBodies {
+		start := initial[body]
+		position := params.Separation(body.Positions, start.Positions).Magnitude()
+		velocity := body.Velocities.Subtract(start.Velocities).Magnitude()
+		fmt.Printf("%-20s %15.6e %15.6e\n", body.Name, position, velocity)
+
+		maxPosition, maxVelocity = math.Max(maxPosition, position), math.Max(maxVelocity, velocity)
+		sumPosition, sumVelocity = sumPosition+position, sumVelocity+velocity
+	}
+
+	count := float64(len(bodies.NodeBodies))
+	fmt.Printf("\nFrames %d forward and back, %d bodies", frames, len(bodies.NodeBodies))
+	if len(escapers) > 0 {
+		fmt.Printf(" (%d removed by the boundary)", len(escapers))
+	}
+	fmt.Println()
+	if count > 0 {
+		fmt.Printf("Position deviation: max %e, mean %e\n", maxPosition, sumPosition/count)
+		fmt.Printf("Velocity deviation: max %e, mean %e\n", maxVelocity, sumVelocity/count)
+	}
+	fmt.Printf("Energy: initial %e, after forward run %e, after return %e\n", initialEnergy, forwardEnergy, backEnergy)
+	if initialEnergy != 0 {
+		fmt.Printf("Energy drift: forward %e, round trip %e (relative)\n",
+			(forwardEnergy-initialEnergy)/math.Abs(initialEnergy), (backEnergy-initialEnergy)/math.Abs(initialEnergy))
+	}
+}
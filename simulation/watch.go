@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"proj3-redesigned/sink"
+	"proj3-redesigned/watch"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Watch shows results files in the terminal as they are written, by
+// default the results of every engine.
+func Watch(args []string) {
+
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	ascii := flags.Bool("ascii", false, "draw with plain ASCII instead of braille")
+	format := flags.String("format", "csv", "format of the engines' default results files to watch when none are given")
+	refresh := flags.Duration("refresh", 100*time.Millisecond, "time between redraws")
+	history := flags.Int("history", 10000, "frames kept per file for stepping back (0 for all)")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run simulate.go watch {optional: flags} {optional: results files}")
+		fmt.Println("Keys: " + watch.Help)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	files := flags.Args()
+	if len(files) == 0 {
+		extension, err := sink.Extension(*format)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		for _, engine := range []string{"sequential", "parallel", "wq_parallel"} {
+			files = append(files, engine+"_simulation_results"+extension)
+		}
+	}
+	if *refresh <= 0 {
+		fmt.Println("Error: -refresh must be positive")
+		return
+	}
+
+	sources := make([]*watch.Source, len(files))
+	for i, file := range files {
+		sources[i] = watch.Open(file, *history)
+		defer sources[i].Close()
+	}
+	viewer := watch.NewViewer(sources, *ascii)
+
+	// Keys are read one at a time without echo; without a terminal the view
+	// still updates, and control-C ends it
+	keys := make(chan string)
+	if restore, err := rawTerminal(); err == nil {
+		defer restore()
+		go watch.ReadKeys(os.Stdin, keys)
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	// Alternate screen, hidden cursor
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	ticker := time.NewTicker(*refresh)
+	defer ticker.Stop()
+	var columns, rows int
+	var measured time.Time
+	for {
+		// The size is checked once a second, so a resized terminal is picked up
+		if time.Since(measured) > time.Second {
+			columns, rows = terminalSize()
+			measured = time.Now()
+		}
+		lines := viewer.Render(columns, rows)
+		fmt.Print("\x1b[H" + strings.Join(lines, "\x1b[K\r\n") + "\x1b[K")
+
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				keys = nil // Input closed: keep watching
+			} else if !viewer.Key(key) {
+				return
+			}
+		case <-ticker.C:
+		case <-interrupt:
+			return
+		}
+	}
+}
+
+// rawTerminal turns off line buffering and echo on the terminal with stty,
+// returning a function that restores its settings.
+func rawTerminal() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		return nil, err
+	}
+	return func() { stty(strings.TrimSpace(saved)) }, nil
+}
+
+// terminalSize returns the columns and rows of the terminal, 80 by 24 if
+// they cannot be found.
+func terminalSize() (int, int) {
+	if size, err := stty("size"); err == nil {
+		fields := strings.Fields(size)
+		if len(fields) == 2 {
+			rows, errRows := strconv.Atoi(fields[0])
+			columns, errColumns := strconv.Atoi(fields[1])
+			if errRows == nil && errColumns == nil && rows > 0 && columns > 0 {
+				return columns, rows
+			}
+		}
+	}
+	columns, errColumns := strconv.Atoi(os.Getenv("COLUMNS"))
+	rows, errRows := strconv.Atoi(os.Getenv("LINES"))
+	if errColumns != nil || errRows != nil || columns <= 0 || rows <= 0 {
+		return 80, 24
+	}
+	return columns, rows
+}
+
+// stty runs stty on the terminal of stdin.
+func stty(args ...string) (string, error) {
+	command := exec.Command("stty", args...)
+	command.Stdin = os.Stdin
+	output, err := command.Output()
+	return string(output), err
+}
@@ -0,0 +1,90 @@
+package sink
+
+import (
+	"proj3-redesigned/utils"
+	"sync"
+)
+
+// Async hands frames to a writer goroutine through a bounded queue, so
+// formatting and I/O overlap with the next frame's force calculation
+// instead of adding to the engine's sequential time. When the queue is full,
+// WriteFrame blocks until the writer catches up.
+type Async struct {
+	sink  OutputSink
+	queue chan outputJob
+	done  sync.WaitGroup
+
+	mu  sync.Mutex
+	err error // First error of the writer goroutine
+}
+
+// outputJob is a frame to write, or a request to flush.
+type outputJob struct {
+	frame  int
+	time   float64
+	bodies []*utils.Body
+	flush  bool
+}
+
+// NewAsync starts a writer goroutine for sink with room for buffer queued
+// frames.
+func NewAsync(sink OutputSink, buffer int) *Async {
+	async := &Async{sink: sink, queue: make(chan outputJob, buffer)}
+	async.done.Add(1)
+	go async.run()
+	return async
+}
+
+func (async *Async) run() {
+	defer async.done.Done()
+	for job := range async.queue {
+		var err error
+		if job.flush {
+			err = async.sink.Flush()
+		} else {
+			err = async.sink.WriteFrame(job.frame, job.time, job.bodies)
+		}
+		if err != nil {
+			async.mu.Lock()
+			if async.err == nil {
+				async.err = err
+			}
+			async.mu.Unlock()
+		}
+	}
+}
+
+// WriteFrame queues a copy of the bodies, which the engine goes on to
+// change, and reports any error the writer has hit so far.
+func (async *Async) WriteFrame(frame int, time float64, bodies []*utils.Body) error {
+	copies := make([]utils.Body, len(bodies))
+	pointers := make([]*utils.Body, len(bodies))
+	for i, body := range bodies {
+		copies[i] = *body
+		pointers[i] = &copies[i]
+	}
+	async.queue <- outputJob{frame: frame, time: time, bodies: pointers}
+	return async.error()
+}
+
+// Flush queues a flush behind the frames already queued.
+func (async *Async) Flush() error {
+	async.queue <- outputJob{flush: true}
+	return async.error()
+}
+
+// Close waits for every queued frame to be written, then closes the sink.
+func (async *Async) Close() error {
+	close(async.queue)
+	async.done.Wait()
+	if err := async.sink.Close(); err != nil && async.err == nil {
+		async.err = err
+	}
+	return async.err
+}
+
+func (async *Async) error() error {
+	async.mu.Lock()
+	defer async.mu.Unlock()
+	return async.err
+}
@@ -0,0 +1,63 @@
+package sink
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"proj3-redesigned/compression"
+	"proj3-redesigned/utils"
+	"strconv"
+)
+
+// CSV writes one row per body per frame: Frame, Body Name and the value
+// columns, formatted with "%f".
+type CSV struct {
+	file       io.WriteCloser
+	writer     *csv.Writer
+	columns    []int
+	conversion utils.Conversion
+	record     []string
+}
+
+func createCSV(filename string, columns []int, options Options) (*CSV, error) {
+	file, err := compression.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	sink := &CSV{
+		file:       file,
+		writer:     csv.NewWriter(file),
+		columns:    columns,
+		conversion: options.Conversion,
+		record:     make([]string, 2+len(columns)),
+	}
+	sink.writer.Write(append([]string{"Frame", "Body Name"}, columnNames(columns)...))
+	return sink, nil
+}
+
+func (sink *CSV) WriteFrame(frame int, time float64, bodies []*utils.Body) error {
+	sink.record[0] = strconv.Itoa(frame)
+	for _, body := range bodies {
+		sink.record[1] = body.Name
+		for i, value := range selectValues(body, sink.columns, sink.conversion) {
+			sink.record[2+i] = fmt.Sprintf("%f", value)
+		}
+		if err := sink.writer.Write(sink.record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sink *CSV) Flush() error {
+	sink.writer.Flush()
+	return sink.writer.Error()
+}
+
+func (sink *CSV) Close() error {
+	err := sink.Flush()
+	if closeErr := sink.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"proj3-redesigned/compression"
+	"proj3-redesigned/utils"
+	"strconv"
+)
+
+// JSONL writes one JSON object per frame, one line each:
+//
+//	{"frame":0,"bodies":[{"name":"Planet 1","PosX":1.5,...},...]}
+//
+// Values keep every digit; values that JSON cannot hold, such as NaN, are null.
+type JSONL struct {
+	file       io.WriteCloser
+	writer     *bufio.Writer
+	columns    []int
+	keys       [][]byte // Pre-encoded ,"Column": prefixes
+	conversion utils.Conversion
+	line       []byte
+}
+
+func createJSONL(filename string, columns []int, options Options) (*JSONL, error) {
+	file, err := compression.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	sink := &JSONL{file: file, writer: bufio.NewWriter(file), columns: columns, conversion: options.Conversion}
+	for _, name := range columnNames(columns) {
+		key, _ := json.Marshal(name)
+		sink.keys = append(sink.keys, append(append([]byte(","), key...), ':'))
+	}
+	return sink, nil
+}
+
+func (sink *JSONL) WriteFrame(frame int, time float64, bodies []*utils.Body) error {
+	line := append(sink.line[:0], `{"frame":`...)
+	line = strconv.AppendInt(line, int64(frame), 10)
+	line = append(line, `,"bodies":[`...)
+	for i, body := range bodies {
+		if i > 0 {
+			line = append(line, ',')
+		}
+		name, _ := json.Marshal(body.Name)
+		line = append(append(line, `{"name":`...), name...)
+		for c, value := range selectValues(body, sink.columns, sink.conversion) {
+			line = append(line, sink.keys[c]...)
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				line = append(line, "null"...)
+			} else {
+				line = strconv.AppendFloat(line, value, 'g', -1, 64)
+			}
+		}
+		line = append(line, '}')
+	}
+	line = append(line, "]}\n"...)
+	sink.line = line
+	_, err := sink.writer.Write(line)
+	return err
+}
+
+func (sink *JSONL) Flush() error {
+	return sink.writer.Flush()
+}
+
+func (sink *JSONL) Close() error {
+	err := sink.Flush()
+	if closeErr := sink.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package sink
+
+import (
+	"proj3-redesigned/snapshot"
+	"proj3-redesigned/utils"
+	"sync"
+)
+
+// Memory keeps every frame it is given, for code that runs a simulation and
+// inspects the results in-process. It is safe to read while a run writes.
+type Memory struct {
+	// Limit is the number of most recent frames kept, 0 for all.
+	Limit int
+
+	mu      sync.Mutex
+	columns []int
+	params  *utils.Params
+	frames  []snapshot.Frame
+}
+
+// NewMemory returns a memory sink that keeps every value column in the
+// output units of params, which are only known once the input is read.
+func NewMemory(params *utils.Params) *Memory {
+	columns, _ := columnIndices(nil)
+	return &Memory{columns: columns, params: params}
+}
+
+// Columns returns the names of the values of each record.
+func (sink *Memory) Columns() []string {
+	return columnNames(sink.columns)
+}
+
+func (sink *Memory) WriteFrame(frame int, time float64, bodies []*utils.Body) error {
+	records := make([]snapshot.Record, len(bodies))
+	for i, body := range bodies {
+		records[i] = snapshot.Record{Name: body.Name, Values: selectValues(body, sink.columns, sink.params.Output)}
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.frames = append(sink.frames, snapshot.Frame{Number: frame, Time: time * sink.params.Output.Time, Records: records})
+	if sink.Limit > 0 && len(sink.frames) > sink.Limit {
+		sink.frames = append(sink.frames[:0], sink.frames[len(sink.frames)-sink.Limit:]...)
+	}
+	return nil
+}
+
+// Frames returns the frames written so far.
+func (sink *Memory) Frames() []snapshot.Frame {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	return append([]snapshot.Frame(nil), sink.frames...)
+}
+
+// Last returns the most recent frame, and false if there is none yet.
+func (sink *Memory) Last() (snapshot.Frame, bool) {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.frames) == 0 {
+		return snapshot.Frame{}, false
+	}
+	return sink.frames[len(sink.frames)-1], true
+}
+
+func (sink *Memory) Flush() error { return nil }
+func (sink *Memory) Close() error { return nil }
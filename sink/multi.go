@@ -0,0 +1,35 @@
+package sink
+
+import "proj3-redesigned/utils"
+
+// Multi writes every frame to each of its sinks in turn.
+type Multi []OutputSink
+
+func (sinks Multi) WriteFrame(frame int, time float64, bodies []*utils.Body) error {
+	for _, sink := range sinks {
+		if err := sink.WriteFrame(frame, time, bodies); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sinks Multi) Flush() error {
+	for _, sink := range sinks {
+		if err := sink.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every sink, returning the first error.
+func (sinks Multi) Close() error {
+	var first error
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
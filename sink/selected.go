@@ -0,0 +1,80 @@
+package sink
+
+import (
+	"fmt"
+	"path"
+	"proj3-redesigned/utils"
+)
+
+// Selected applies the output cadence, body subset and flush frequency of
+// params.Select to another sink. It reads params on every frame, so changes
+// made during a run take effect at once.
+type Selected struct {
+	sink    OutputSink
+	params  *utils.Params
+	written int
+	matches map[string]bool // Whether each body name matches a pattern
+}
+
+// NewSelected wraps sink with the selection of params.
+func NewSelected(sink OutputSink, params *utils.Params) *Selected {
+	return &Selected{sink: sink, params: params, matches: map[string]bool{}}
+}
+
+// CheckPatterns reports body name patterns that are malformed.
+func CheckPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad body pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+func (selected *Selected) WriteFrame(frame int, time float64, bodies []*utils.Body) error {
+	selection := selected.params.Select
+	if !selection.Due(frame, time, selected.params.Dt) {
+		return nil
+	}
+
+	if len(selection.Bodies) > 0 {
+		var subset []*utils.Body
+		for _, body := range bodies {
+			if selected.match(body.Name) {
+				subset = append(subset, body)
+			}
+		}
+		bodies = subset
+	}
+
+	if err := selected.sink.WriteFrame(frame, time, bodies); err != nil {
+		return err
+	}
+	selected.written++
+	if selection.Flush > 0 && selected.written%selection.Flush == 0 {
+		return selected.sink.Flush()
+	}
+	return nil
+}
+
+func (selected *Selected) match(name string) bool {
+	matched, ok := selected.matches[name]
+	if !ok {
+		for _, pattern := range selected.params.Select.Bodies {
+			if ok, _ := path.Match(pattern, name); ok {
+				matched = true
+				break
+			}
+		}
+		selected.matches[name] = matched
+	}
+	return matched
+}
+
+func (selected *Selected) Flush() error {
+	return selected.sink.Flush()
+}
+
+func (selected *Selected) Close() error {
+	return selected.sink.Close()
+}
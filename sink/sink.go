@@ -0,0 +1,135 @@
+// This package holds the output sinks a run writes its frames to: CSV,
+// binary snapshots, JSON Lines, VTK for ParaView and memory, plus sinks that fan frames out to
+// several others, pick which frames and bodies are written, and move the
+// writing onto its own goroutine.
+
+package sink
+
+import (
+	"fmt"
+	"path/filepath"
+	"proj3-redesigned/compression"
+	"proj3-redesigned/utils"
+	"strings"
+)
+
+// OutputSink is utils.OutputSink, which lives beside Params so that a run
+// can carry sinks of its own.
+type OutputSink = utils.OutputSink
+
+// Columns lists the value columns of a body, in the order of Values.
+var Columns = []string{"PosX", "PosY", "VelX", "VelY", "ForceX", "ForceY"}
+
+// Options describe what a file sink writes.
+type Options struct {
+	Columns    []string         // Value columns to write, nil for all
+	Conversion utils.Conversion // Factors to the output units
+	Units      string           // Name of the output units, recorded where the format allows
+	Dt         float64          // Time step the run starts with, recorded where the format allows
+}
+
+// Formats by file extension.
+var extensions = map[string]string{
+	".csv":   "csv",
+	".nbs":   "binary",
+	".jsonl": "jsonl",
+	".pvd":   "vtk",
+}
+
+// Extension returns the file extension of a format: csv, binary, jsonl or vtk.
+func Extension(format string) (string, error) {
+	for extension, candidate := range extensions {
+		if candidate == format {
+			return extension, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output format %q (want csv, binary, jsonl or vtk)", format)
+}
+
+// FormatOf returns the format of a file from its extension: .csv, .nbs for
+// a binary snapshot, or .jsonl for JSON Lines, each optionally followed by
+// .gz or .zst to compress the file with gzip or Zstandard as it is written,
+// or .pvd for a ParaView collection of VTK frames.
+func FormatOf(filename string) (string, error) {
+	format, ok := extensions[strings.ToLower(filepath.Ext(compression.Strip(filename)))]
+	if !ok {
+		return "", fmt.Errorf("%s: unknown output format (want a .csv, .nbs or .jsonl file, optionally .gz or .zst, or a .pvd file)", filename)
+	}
+	if format == "vtk" && compression.Extension(filename) != "" {
+		return "", fmt.Errorf("%s: VTK output cannot be compressed", filename)
+	}
+	return format, nil
+}
+
+// Create opens a file sink in the format of the file's extension.
+func Create(filename string, options Options) (OutputSink, error) {
+	format, err := FormatOf(filename)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := columnIndices(options.Columns)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case "binary":
+		return createSnapshot(filename, columns, options)
+	case "jsonl":
+		return createJSONL(filename, columns, options)
+	case "vtk":
+		return createVTK(filename, options)
+	}
+	return createCSV(filename, columns, options)
+}
+
+// CheckColumns reports column names that are not in Columns.
+func CheckColumns(names []string) error {
+	_, err := columnIndices(names)
+	return err
+}
+
+// columnIndices returns the positions in Values of the named columns.
+func columnIndices(names []string) ([]int, error) {
+	if len(names) == 0 {
+		names = Columns
+	}
+	indices := make([]int, len(names))
+	for i, name := range names {
+		indices[i] = -1
+		for c, column := range Columns {
+			if column == name {
+				indices[i] = c
+			}
+		}
+		if indices[i] < 0 {
+			return nil, fmt.Errorf("unknown column %q (want %s)", name, strings.Join(Columns, ", "))
+		}
+	}
+	return indices, nil
+}
+
+func columnNames(indices []int) []string {
+	names := make([]string, len(indices))
+	for i, index := range indices {
+		names[i] = Columns[index]
+	}
+	return names
+}
+
+// Values returns the value columns of a body, converted to the output units.
+func Values(body *utils.Body, conversion utils.Conversion) []float64 {
+	position := body.Positions.Multiply(conversion.Length)
+	velocity := body.Velocities.Multiply(conversion.Velocity)
+	force := body.Force.Multiply(conversion.Force)
+	return []float64{position.X, position.Y, velocity.X, velocity.Y, force.X, force.Y}
+}
+
+// selectValues returns the chosen columns of a body.
+func selectValues(body *utils.Body, columns []int, conversion utils.Conversion) []float64 {
+	values := Values(body, conversion)
+	selected := make([]float64, len(columns))
+	for i, column := range columns {
+		selected[i] = values[column]
+	}
+	return selected
+}
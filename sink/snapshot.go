@@ -0,0 +1,38 @@
+package sink
+
+import (
+	"proj3-redesigned/snapshot"
+	"proj3-redesigned/utils"
+)
+
+// Snapshot writes a binary snapshot, which keeps every value as a float64.
+type Snapshot struct {
+	writer     *snapshot.Writer
+	columns    []int
+	conversion utils.Conversion
+}
+
+func createSnapshot(filename string, columns []int, options Options) (*Snapshot, error) {
+	header := snapshot.Header{Columns: columnNames(columns), Units: options.Units, Dt: options.Dt * options.Conversion.Time}
+	writer, err := snapshot.Create(filename, header)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{writer: writer, columns: columns, conversion: options.Conversion}, nil
+}
+
+func (sink *Snapshot) WriteFrame(frame int, time float64, bodies []*utils.Body) error {
+	records := make([]snapshot.Record, len(bodies))
+	for i, body := range bodies {
+		records[i] = snapshot.Record{Name: body.Name, Values: selectValues(body, sink.columns, sink.conversion)}
+	}
+	return sink.writer.WriteFrame(frame, time*sink.conversion.Time, records)
+}
+
+func (sink *Snapshot) Flush() error {
+	return sink.writer.Flush()
+}
+
+func (sink *Snapshot) Close() error {
+	return sink.writer.Close()
+}
@@ -0,0 +1,112 @@
+package sink
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"proj3-redesigned/utils"
+	"proj3-redesigned/vtk"
+)
+
+// VTK writes each frame as VTK PolyData (.vtp) for ParaView, with mass,
+// charge, velocity and force as point attributes and a BodyId that follows
+// each body from frame to frame. The frames are indexed by simulated time in
+// a .pvd collection.
+type VTK struct {
+	collection *vtk.Collection
+	conversion utils.Conversion
+	ids        map[string]int
+}
+
+func createVTK(filename string, options Options) (*VTK, error) {
+	collection, err := vtk.CreateCollection(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &VTK{
+		collection: collection,
+		conversion: options.Conversion,
+		ids:        map[string]int{},
+	}, nil
+}
+
+func (sink *VTK) WriteFrame(frame int, time float64, bodies []*utils.Body) error {
+	path := sink.collection.Path(frame)
+	if err := sink.writePolyData(path, bodies); err != nil {
+		return err
+	}
+	return sink.collection.Add(time*sink.conversion.Time, path)
+}
+
+func (sink *VTK) writePolyData(filename string, bodies []*utils.Body) error {
+	n := len(bodies)
+	ids := make([]float64, 0, n)
+	masses := make([]float64, 0, n)
+	charges := make([]float64, 0, n)
+	velocities := make([]float64, 0, 3*n)
+	forces := make([]float64, 0, 3*n)
+	points := make([]float64, 0, 3*n)
+	connectivity := make([]float64, 0, n)
+	offsets := make([]float64, 0, n)
+	for i, body := range bodies {
+		id, ok := sink.ids[body.Name]
+		if !ok {
+			id = len(sink.ids)
+			sink.ids[body.Name] = id
+		}
+		ids = append(ids, float64(id))
+		masses = append(masses, body.Mass*sink.conversion.Mass)
+		charges = append(charges, body.Charge)
+		velocity := body.Velocities.Multiply(sink.conversion.Velocity)
+		velocities = append(velocities, velocity.X, velocity.Y, 0)
+		force := body.Force.Multiply(sink.conversion.Force)
+		forces = append(forces, force.X, force.Y, 0)
+		position := body.Positions.Multiply(sink.conversion.Length)
+		points = append(points, position.X, position.Y, 0)
+		// One vertex cell per body, so every point is drawn
+		connectivity = append(connectivity, float64(i))
+		offsets = append(offsets, float64(i+1))
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(file)
+
+	fmt.Fprintf(out, "<?xml version=\"1.0\"?>\n")
+	fmt.Fprintf(out, "<VTKFile type=\"PolyData\" version=\"1.0\" byte_order=\"LittleEndian\" header_type=\"UInt64\">\n")
+	fmt.Fprintf(out, "  <PolyData>\n")
+	fmt.Fprintf(out, "    <Piece NumberOfPoints=\"%d\" NumberOfVerts=\"%d\" NumberOfLines=\"0\" NumberOfStrips=\"0\" NumberOfPolys=\"0\">\n", n, n)
+	fmt.Fprintf(out, "      <PointData Scalars=\"Mass\" Vectors=\"Velocity\">\n")
+	vtk.WriteArray(out, "Int64", "BodyId", 1, ids)
+	vtk.WriteArray(out, "Float64", "Mass", 1, masses)
+	vtk.WriteArray(out, "Float64", "Charge", 1, charges)
+	vtk.WriteArray(out, "Float64", "Velocity", 3, velocities)
+	vtk.WriteArray(out, "Float64", "Force", 3, forces)
+	fmt.Fprintf(out, "      </PointData>\n")
+	fmt.Fprintf(out, "      <Points>\n")
+	vtk.WriteArray(out, "Float64", "Points", 3, points)
+	fmt.Fprintf(out, "      </Points>\n")
+	fmt.Fprintf(out, "      <Verts>\n")
+	vtk.WriteArray(out, "Int64", "connectivity", 1, connectivity)
+	vtk.WriteArray(out, "Int64", "offsets", 1, offsets)
+	fmt.Fprintf(out, "      </Verts>\n")
+	fmt.Fprintf(out, "    </Piece>\n")
+	fmt.Fprintf(out, "  </PolyData>\n")
+	fmt.Fprintf(out, "</VTKFile>\n")
+
+	err = out.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (sink *VTK) Flush() error {
+	return nil // Every frame is complete on disk once written
+}
+
+func (sink *VTK) Close() error {
+	return sink.collection.Close()
+}
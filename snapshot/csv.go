@@ -0,0 +1,42 @@
+package snapshot
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// WriteCSV writes every frame of a snapshot in the CSV layout of the engines:
+// Frame, Body Name and then one column per value. Values are written with
+// "%f" like the engines' own CSV, or with every digit when full is set.
+func WriteCSV(reader *Reader, out io.Writer, full bool) error {
+	writer := csv.NewWriter(out)
+	if err := writer.Write(append([]string{"Frame", "Body Name"}, reader.Header.Columns...)); err != nil {
+		return err
+	}
+
+	row := make([]string, 2+len(reader.Header.Columns))
+	for i := 0; i < reader.Len(); i++ {
+		frame, err := reader.Frame(i)
+		if err != nil {
+			return err
+		}
+		row[0] = strconv.Itoa(frame.Number)
+		for _, record := range frame.Records {
+			row[1] = record.Name
+			for c, value := range record.Values {
+				if full {
+					row[2+c] = strconv.FormatFloat(value, 'g', -1, 64)
+				} else {
+					row[2+c] = fmt.Sprintf("%f", value)
+				}
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
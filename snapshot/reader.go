@@ -0,0 +1,319 @@
+package snapshot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"proj3-redesigned/compression"
+)
+
+// Reader gives random access to the frames of a snapshot.
+type Reader struct {
+	Header Header
+
+	file   io.ReadSeeker
+	closer io.Closer
+	names  []string
+	index  []IndexEntry
+}
+
+// Open opens a snapshot file. A compressed snapshot is first decompressed to
+// a temporary file, which random access needs and Close removes.
+func Open(filename string) (*Reader, error) {
+	var file *os.File
+	var err error
+	if compression.Extension(filename) != "" {
+		file, err = decompress(filename)
+	} else {
+		file, err = os.Open(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewReader(file)
+	if err != nil {
+		closeFile(file, filename)
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	reader.closer = closerFunc(func() error { return closeFile(file, filename) })
+	return reader, nil
+}
+
+// decompress copies a compressed snapshot into a temporary file.
+func decompress(filename string) (*os.File, error) {
+	in, err := compression.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	file, err := os.CreateTemp("", "snapshot-*.nbs")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(file, in); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return file, nil
+}
+
+// closeFile closes file and removes it if it is a decompressed copy.
+func closeFile(file *os.File, filename string) error {
+	err := file.Close()
+	if file.Name() != filename {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+type closerFunc func() error
+
+func (close closerFunc) Close() error {
+	return close()
+}
+
+// NewReader reads the header and index of the snapshot in file. Without a
+// footer, it scans the frames to rebuild them.
+func NewReader(file io.ReadSeeker) (*Reader, error) {
+	reader := &Reader{file: file}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	in := &decoder{r: bufio.NewReader(file)}
+
+	if string(in.bytes(len(magic))) != magic {
+		if in.err != nil {
+			return nil, in.err
+		}
+		return nil, errors.New("not a snapshot file")
+	}
+	if version := in.uint16(); version != Version && in.err == nil {
+		return nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	columns := int(in.uint16())
+	for i := 0; i < columns; i++ {
+		reader.Header.Columns = append(reader.Header.Columns, in.string())
+	}
+	reader.Header.Units = in.string()
+	reader.Header.Dt = in.float64()
+	if in.err != nil {
+		return nil, fmt.Errorf("reading header: %w", in.err)
+	}
+	start := in.offset
+
+	if ok, err := reader.readFooter(); err != nil {
+		return nil, err
+	} else if !ok {
+		if err := reader.scan(start); err != nil {
+			return nil, err
+		}
+	}
+	return reader, nil
+}
+
+// readFooter loads the name table and index, reporting false if the file
+// has no footer.
+func (reader *Reader) readFooter() (bool, error) {
+	end, err := reader.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+	if end < int64(trailerSize) {
+		return false, nil
+	}
+	if _, err := reader.file.Seek(end-int64(trailerSize), io.SeekStart); err != nil {
+		return false, err
+	}
+	trailer := &decoder{r: bufio.NewReader(reader.file)}
+	footer := int64(trailer.uint64())
+	if string(trailer.bytes(len(footerMagic))) != footerMagic || trailer.err != nil {
+		return false, nil
+	}
+
+	if _, err := reader.file.Seek(footer, io.SeekStart); err != nil {
+		return false, err
+	}
+	in := &decoder{r: bufio.NewReader(reader.file)}
+	names := int(in.uint32())
+	for i := 0; i < names && in.err == nil; i++ {
+		reader.names = append(reader.names, in.string())
+	}
+	frames := int(in.uint32())
+	for i := 0; i < frames && in.err == nil; i++ {
+		frame := int(int64(in.uint64()))
+		offset := int64(in.uint64())
+		reader.index = append(reader.index, IndexEntry{Frame: frame, Offset: offset})
+	}
+	if in.err != nil {
+		return false, fmt.Errorf("reading index: %w", in.err)
+	}
+	return true, nil
+}
+
+// scan walks every frame from start, collecting names and offsets. A frame
+// cut off at the end of the file is dropped.
+func (reader *Reader) scan(start int64) error {
+	if _, err := reader.file.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	in := &decoder{r: bufio.NewReader(reader.file), offset: start}
+	for {
+		offset := in.offset
+		names := len(reader.names)
+		frame, err := reader.decodeFrame(in)
+		if err == io.EOF && in.offset == offset {
+			return nil
+		}
+		if err != nil {
+			// Forget the names of the partial frame
+			reader.names = reader.names[:names]
+			return nil
+		}
+		reader.index = append(reader.index, IndexEntry{Frame: frame.Number, Offset: offset})
+	}
+}
+
+// Len returns the number of frames.
+func (reader *Reader) Len() int {
+	return len(reader.index)
+}
+
+// Index returns the frame numbers and offsets, in file order.
+func (reader *Reader) Index() []IndexEntry {
+	return reader.index
+}
+
+// Names returns every body name in the snapshot, in order of first appearance.
+func (reader *Reader) Names() []string {
+	return reader.names
+}
+
+// Frame reads the i-th frame of the file.
+func (reader *Reader) Frame(i int) (Frame, error) {
+	if i < 0 || i >= len(reader.index) {
+		return Frame{}, fmt.Errorf("frame %d out of range [0, %d)", i, len(reader.index))
+	}
+	offset := reader.index[i].Offset
+	if _, err := reader.file.Seek(offset, io.SeekStart); err != nil {
+		return Frame{}, err
+	}
+	in := &decoder{r: bufio.NewReader(reader.file), offset: offset}
+	// The names defined here are already in the table
+	names := reader.names
+	frame, err := reader.decodeFrame(in)
+	reader.names = names
+	return frame, err
+}
+
+// FindFrame returns the frame with the given frame number.
+func (reader *Reader) FindFrame(number int) (Frame, error) {
+	for i, entry := range reader.index {
+		if entry.Frame == number {
+			return reader.Frame(i)
+		}
+	}
+	return Frame{}, fmt.Errorf("no frame %d in the snapshot", number)
+}
+
+// Close closes the file if the reader opened it.
+func (reader *Reader) Close() error {
+	if reader.closer != nil {
+		return reader.closer.Close()
+	}
+	return nil
+}
+
+// decodeFrame reads one frame and appends the names it defines to the table.
+// Record ids refer to the table as written, so a re-read frame appending
+// its names again does not change any lookup.
+func (reader *Reader) decodeFrame(in *decoder) (Frame, error) {
+	frame := Frame{Number: int(int64(in.uint64()))}
+	if in.err != nil {
+		return frame, in.err
+	}
+	frame.Time = in.float64()
+	fresh := int(in.uint32())
+	for i := 0; i < fresh && in.err == nil; i++ {
+		reader.names = append(reader.names, in.string())
+	}
+
+	count := int(in.uint32())
+	columns := len(reader.Header.Columns)
+	for i := 0; i < count && in.err == nil; i++ {
+		id := int(in.uint32())
+		record := Record{Values: make([]float64, columns)}
+		for c := range record.Values {
+			record.Values[c] = in.float64()
+		}
+		if in.err == nil && id >= len(reader.names) {
+			return frame, fmt.Errorf("frame %d: unknown name id %d", frame.Number, id)
+		}
+		if in.err == nil {
+			record.Name = reader.names[id]
+		}
+		frame.Records = append(frame.Records, record)
+	}
+	if in.err == io.EOF {
+		return frame, io.ErrUnexpectedEOF
+	}
+	return frame, in.err
+}
+
+// decoder reads little-endian values and keeps the first error.
+type decoder struct {
+	r      *bufio.Reader
+	offset int64
+	err    error
+	buffer [8]byte
+}
+
+func (in *decoder) bytes(n int) []byte {
+	if in.err != nil {
+		return nil
+	}
+	data := make([]byte, n)
+	read, err := io.ReadFull(in.r, data)
+	in.offset += int64(read)
+	if err != nil {
+		in.err = err
+		return nil
+	}
+	return data
+}
+
+func (in *decoder) fixed(n int) []byte {
+	if in.err != nil {
+		return in.buffer[:n]
+	}
+	read, err := io.ReadFull(in.r, in.buffer[:n])
+	in.offset += int64(read)
+	if err != nil {
+		in.err = err
+	}
+	return in.buffer[:n]
+}
+
+func (in *decoder) uint16() uint16 {
+	return binary.LittleEndian.Uint16(in.fixed(2))
+}
+
+func (in *decoder) uint32() uint32 {
+	return binary.LittleEndian.Uint32(in.fixed(4))
+}
+
+func (in *decoder) uint64() uint64 {
+	return binary.LittleEndian.Uint64(in.fixed(8))
+}
+
+func (in *decoder) float64() float64 {
+	return math.Float64frombits(in.uint64())
+}
+
+func (in *decoder) string() string {
+	return string(in.bytes(int(in.uint16())))
+}
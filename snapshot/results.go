@@ -0,0 +1,229 @@
+package snapshot
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"proj3-redesigned/compression"
+	"strconv"
+	"strings"
+)
+
+// ErrStop ends a Scan early without an error.
+var ErrStop = errors.New("stop scanning")
+
+// Scan reads a results file in any of the engines' formats (CSV, JSON Lines
+// or a snapshot, each possibly compressed) and calls visit with every frame,
+// in file order. The header gives the value columns; only snapshots record
+// the units and time step. Frames are streamed, so memory use does not grow
+// with the file. Returning ErrStop from visit ends the scan.
+func Scan(filename string, visit func(header Header, frame Frame) error) error {
+	var err error
+	switch strings.ToLower(filepath.Ext(compression.Strip(filename))) {
+	case ".nbs":
+		err = scanSnapshot(filename, visit)
+	case ".csv":
+		err = scanFile(filename, visit, scanCSV)
+	case ".jsonl":
+		err = scanFile(filename, visit, scanJSONL)
+	default:
+		return fmt.Errorf("%s: unknown results format (want a .csv, .nbs or .jsonl file, optionally .gz or .zst)", filename)
+	}
+	if err == ErrStop {
+		return nil
+	}
+	return err
+}
+
+// ScanReader reads results in format csv or jsonl from in, like Scan. With a
+// reader that waits for more data at the end instead of reporting io.EOF, it
+// follows a file that an engine is still writing.
+func ScanReader(in io.Reader, format string, visit func(header Header, frame Frame) error) error {
+	var err error
+	switch format {
+	case "csv":
+		err = scanCSV(in, visit)
+	case "jsonl":
+		err = scanJSONL(in, visit)
+	default:
+		return fmt.Errorf("cannot read %s results from a stream (want csv or jsonl)", format)
+	}
+	if err == ErrStop {
+		return nil
+	}
+	return err
+}
+
+// Columns returns the position of each named column in header, -1 for the
+// ones it does not have.
+func Columns(header Header, names ...string) []int {
+	indices := make([]int, len(names))
+	for i, name := range names {
+		indices[i] = -1
+		for c, column := range header.Columns {
+			if column == name {
+				indices[i] = c
+			}
+		}
+	}
+	return indices
+}
+
+func scanSnapshot(filename string, visit func(Header, Frame) error) error {
+	reader, err := Open(filename)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	for i := 0; i < reader.Len(); i++ {
+		frame, err := reader.Frame(i)
+		if err != nil {
+			return err
+		}
+		if err := visit(reader.Header, frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanFile(filename string, visit func(Header, Frame) error, scan func(io.Reader, func(Header, Frame) error) error) error {
+	file, err := compression.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = scan(file, visit)
+	if err != nil && err != ErrStop {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return err
+}
+
+// scanCSV reads the engines' CSV layout, whose rows are grouped by frame.
+func scanCSV(in io.Reader, visit func(Header, Frame) error) error {
+	reader := csv.NewReader(bufio.NewReader(in))
+	names, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+	if len(names) < 2 || names[0] != "Frame" || names[1] != "Body Name" {
+		return errors.New("not a results file: the header does not start with Frame,Body Name")
+	}
+	header := Header{Columns: names[2:]}
+
+	frame := Frame{Number: -1}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		number, err := strconv.Atoi(row[0])
+		if err != nil {
+			return fmt.Errorf("bad frame number %q", row[0])
+		}
+		if number != frame.Number && frame.Records != nil {
+			if err := visit(header, frame); err != nil {
+				return err
+			}
+			frame = Frame{}
+		}
+		frame.Number = number
+		record := Record{Name: row[1], Values: make([]float64, len(header.Columns))}
+		for c := range record.Values {
+			if record.Values[c], err = strconv.ParseFloat(row[2+c], 64); err != nil {
+				return fmt.Errorf("frame %d: bad %s value %q", number, header.Columns[c], row[2+c])
+			}
+		}
+		frame.Records = append(frame.Records, record)
+	}
+	if frame.Records != nil {
+		return visit(header, frame)
+	}
+	return nil
+}
+
+// scanJSONL reads one {"frame":N,"bodies":[...]} object per line. The columns
+// are the keys of the first body, in their order in the file.
+func scanJSONL(in io.Reader, visit func(Header, Frame) error) error {
+	decoder := json.NewDecoder(bufio.NewReader(in))
+	var header Header
+	for {
+		var line struct {
+			Frame  int               `json:"frame"`
+			Bodies []json.RawMessage `json:"bodies"`
+		}
+		if err := decoder.Decode(&line); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		frame := Frame{Number: line.Frame}
+		for _, body := range line.Bodies {
+			keys, values, err := objectFields(body)
+			if err != nil {
+				return fmt.Errorf("frame %d: %w", line.Frame, err)
+			}
+			if header.Columns == nil {
+				for _, key := range keys {
+					if key != "name" {
+						header.Columns = append(header.Columns, key)
+					}
+				}
+			}
+			record := Record{Values: make([]float64, len(header.Columns))}
+			for i := range record.Values {
+				record.Values[i] = math.NaN()
+			}
+			for i, key := range keys {
+				if key == "name" {
+					record.Name, _ = values[i].(string)
+					continue
+				}
+				for c, column := range header.Columns {
+					if column == key {
+						if value, ok := values[i].(float64); ok {
+							record.Values[c] = value
+						}
+					}
+				}
+			}
+			frame.Records = append(frame.Records, record)
+		}
+		if err := visit(header, frame); err != nil {
+			return err
+		}
+	}
+}
+
+// objectFields returns the keys and scalar values of a flat JSON object, in order.
+func objectFields(data json.RawMessage) ([]string, []any, error) {
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, nil, errors.New("body is not an object")
+	}
+	var keys []string
+	var values []any
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		value, err := decoder.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key.(string))
+		values = append(values, value)
+	}
+	return keys, values, nil
+}
@@ -0,0 +1,213 @@
+// This package reads and writes binary snapshots, a compact alternative to
+// the CSV results that keeps every value as a full float64. A snapshot is:
+//
+//	header  "NBSNAP" magic, uint16 version, the column names, the units name
+//	        and the time step the run started with
+//	frames  per frame: int64 frame number, float64 simulated time, the names
+//	        first seen in this frame, uint32 record count, then per record a
+//	        uint32 name id and one float64 per column
+//	footer  the full name table and an index of (frame number, offset) pairs,
+//	        followed by the uint64 offset of the footer and the "NBINDEX" magic
+//
+// Everything is little-endian, and strings are a uint16 length followed by
+// the bytes. The index gives random access to any frame; a file whose footer
+// is missing, because the run was cut short, can still be read front to back.
+//
+// Scan reads the frames of any results file, including the engines' CSV and
+// JSON Lines, in the same form.
+
+package snapshot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"proj3-redesigned/compression"
+)
+
+const (
+	Version     = 1
+	magic       = "NBSNAP"
+	footerMagic = "NBINDEX\x00"
+	trailerSize = 8 + len(footerMagic)
+)
+
+// Header describes the contents of a snapshot.
+type Header struct {
+	Columns []string // Names of the float64 columns, such as PosX
+	Units   string   // Unit system of the values, "" if not recorded
+	Dt      float64  // Time step the run started with
+}
+
+// Record is one body in one frame.
+type Record struct {
+	Name   string
+	Values []float64 // One per column
+}
+
+// Frame is every record of one frame.
+type Frame struct {
+	Number  int
+	Time    float64 // Simulated time at the end of the frame, 0 if the results do not record it
+	Records []Record
+}
+
+// IndexEntry locates a frame in the file.
+type IndexEntry struct {
+	Frame  int
+	Offset int64
+}
+
+var byteOrder = binary.LittleEndian
+
+// Writer writes a snapshot frame by frame. Close must be called to write the
+// index.
+type Writer struct {
+	header  Header
+	out     *bufio.Writer
+	closer  io.Closer
+	offset  int64
+	ids     map[string]uint32
+	names   []string
+	index   []IndexEntry
+	scratch []byte
+}
+
+// Create creates filename and writes the header to it. The snapshot is
+// compressed if the name ends in .gz or .zst.
+func Create(filename string, header Header) (*Writer, error) {
+	file, err := compression.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := NewWriter(file, header)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	writer.closer = file
+	return writer, nil
+}
+
+// NewWriter writes the header to out, which must be at its start.
+func NewWriter(out io.Writer, header Header) (*Writer, error) {
+	if len(header.Columns) == 0 {
+		return nil, errors.New("snapshot needs at least one column")
+	}
+	writer := &Writer{header: header, out: bufio.NewWriter(out), ids: map[string]uint32{}}
+	writer.write([]byte(magic))
+	writer.uint16(Version)
+	writer.uint16(uint16(len(header.Columns)))
+	for _, column := range header.Columns {
+		writer.string(column)
+	}
+	writer.string(header.Units)
+	writer.float64(header.Dt)
+	return writer, writer.err()
+}
+
+// WriteFrame appends a frame that ends at the given simulated time. Every
+// record must have one value per column, or nothing is written.
+func (writer *Writer) WriteFrame(frame int, time float64, records []Record) error {
+	// A rejected frame leaves the writer as it was
+	for _, record := range records {
+		if len(record.Values) != len(writer.header.Columns) {
+			return fmt.Errorf("record %q has %d values for %d columns", record.Name, len(record.Values), len(writer.header.Columns))
+		}
+	}
+	writer.index = append(writer.index, IndexEntry{Frame: frame, Offset: writer.offset})
+
+	var fresh []string
+	for _, record := range records {
+		if _, ok := writer.ids[record.Name]; !ok {
+			writer.ids[record.Name] = uint32(len(writer.names))
+			writer.names = append(writer.names, record.Name)
+			fresh = append(fresh, record.Name)
+		}
+	}
+
+	writer.uint64(uint64(int64(frame)))
+	writer.float64(time)
+	writer.uint32(uint32(len(fresh)))
+	for _, name := range fresh {
+		writer.string(name)
+	}
+	writer.uint32(uint32(len(records)))
+	for _, record := range records {
+		writer.uint32(writer.ids[record.Name])
+		for _, value := range record.Values {
+			writer.float64(value)
+		}
+	}
+	return writer.err()
+}
+
+// Flush writes buffered frames to the underlying writer.
+func (writer *Writer) Flush() error {
+	return writer.out.Flush()
+}
+
+// Close writes the footer and closes the file if the writer created it.
+func (writer *Writer) Close() error {
+	footer := writer.offset
+	writer.uint32(uint32(len(writer.names)))
+	for _, name := range writer.names {
+		writer.string(name)
+	}
+	writer.uint32(uint32(len(writer.index)))
+	for _, entry := range writer.index {
+		writer.uint64(uint64(int64(entry.Frame)))
+		writer.uint64(uint64(entry.Offset))
+	}
+	writer.uint64(uint64(footer))
+	writer.write([]byte(footerMagic))
+
+	err := writer.out.Flush()
+	if writer.closer != nil {
+		if closeErr := writer.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (writer *Writer) write(data []byte) {
+	n, _ := writer.out.Write(data)
+	writer.offset += int64(n)
+}
+
+func (writer *Writer) err() error {
+	// bufio.Writer keeps the first error and returns it from every later call
+	_, err := writer.out.Write(nil)
+	return err
+}
+
+func (writer *Writer) uint16(value uint16) {
+	writer.scratch = byteOrder.AppendUint16(writer.scratch[:0], value)
+	writer.write(writer.scratch)
+}
+
+func (writer *Writer) uint32(value uint32) {
+	writer.scratch = byteOrder.AppendUint32(writer.scratch[:0], value)
+	writer.write(writer.scratch)
+}
+
+func (writer *Writer) uint64(value uint64) {
+	writer.scratch = byteOrder.AppendUint64(writer.scratch[:0], value)
+	writer.write(writer.scratch)
+}
+
+func (writer *Writer) float64(value float64) {
+	writer.uint64(math.Float64bits(value))
+}
+
+func (writer *Writer) string(value string) {
+	if len(value) > math.MaxUint16 {
+		value = value[:math.MaxUint16]
+	}
+	writer.uint16(uint16(len(value)))
+	writer.write([]byte(value))
+}
@@ -0,0 +1,165 @@
+package snapshot
+
+import (
+	"bytes"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var testHeader = Header{Columns: []string{"PosX", "PosY"}, Units: "au", Dt: 0.01}
+
+// testFrames has a body that appears late, one that leaves, values that CSV
+// would round away and ones it cannot write at all.
+var testFrames = []Frame{
+	{Number: 0, Time: 0.01, Records: []Record{
+		{Name: "Sun", Values: []float64{0, 0}},
+		{Name: "Earth", Values: []float64{1, 1e-300}},
+	}},
+	{Number: 2, Time: 0.025, Records: []Record{
+		{Name: "Earth", Values: []float64{0.999999999, math.Inf(-1)}},
+		{Name: "Comet, the first", Values: []float64{-3.5, 12345.678901234}},
+	}},
+	{Number: 3, Time: 0.05, Records: []Record{
+		{Name: "Comet, the first", Values: []float64{-3.25, math.MaxFloat64}},
+	}},
+}
+
+func writeTestSnapshot(t *testing.T) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer, err := NewWriter(&buffer, testHeader)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for _, frame := range testFrames {
+		if err := writer.WriteFrame(frame.Number, frame.Time, frame.Records); err != nil {
+			t.Fatalf("WriteFrame %d: %v", frame.Number, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func readAll(t *testing.T, reader *Reader) []Frame {
+	t.Helper()
+	var frames []Frame
+	for i := 0; i < reader.Len(); i++ {
+		frame, err := reader.Frame(i)
+		if err != nil {
+			t.Fatalf("Frame(%d): %v", i, err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+func TestRoundTrip(t *testing.T) {
+	reader, err := NewReader(bytes.NewReader(writeTestSnapshot(t)))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if !reflect.DeepEqual(reader.Header, testHeader) {
+		t.Errorf("Header = %+v, want %+v", reader.Header, testHeader)
+	}
+	if want := []string{"Sun", "Earth", "Comet, the first"}; !reflect.DeepEqual(reader.Names(), want) {
+		t.Errorf("Names = %q, want %q", reader.Names(), want)
+	}
+	if frames := readAll(t, reader); !reflect.DeepEqual(frames, testFrames) {
+		t.Errorf("frames = %+v, want %+v", frames, testFrames)
+	}
+
+	// Random access, out of order
+	frame, err := reader.FindFrame(2)
+	if err != nil || !reflect.DeepEqual(frame, testFrames[1]) {
+		t.Errorf("FindFrame(2) = %+v, %v, want %+v", frame, err, testFrames[1])
+	}
+	frame, err = reader.Frame(0)
+	if err != nil || !reflect.DeepEqual(frame, testFrames[0]) {
+		t.Errorf("Frame(0) after FindFrame = %+v, %v, want %+v", frame, err, testFrames[0])
+	}
+	if _, err := reader.FindFrame(1); err == nil {
+		t.Error("FindFrame(1) found a frame that was never written")
+	}
+}
+
+// TestWithoutFooter reads a snapshot whose run was cut short, which has no
+// index and ends partway through a frame.
+func TestWithoutFooter(t *testing.T) {
+	data := writeTestSnapshot(t)
+	complete, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	// Cut into the last frame
+	cut := data[:complete.Index()[2].Offset+20]
+
+	reader, err := NewReader(bytes.NewReader(cut))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if frames := readAll(t, reader); !reflect.DeepEqual(frames, testFrames[:2]) {
+		t.Errorf("frames = %+v, want the first two of %+v", frames, testFrames)
+	}
+	if want := []string{"Sun", "Earth", "Comet, the first"}; !reflect.DeepEqual(reader.Names(), want) {
+		t.Errorf("Names = %q, want %q", reader.Names(), want)
+	}
+}
+
+// TestRejectedFrame checks that a frame with a bad record leaves no trace.
+func TestRejectedFrame(t *testing.T) {
+	var buffer bytes.Buffer
+	writer, err := NewWriter(&buffer, testHeader)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	bad := []Record{{Name: "New", Values: []float64{1, 2}}, {Name: "Short", Values: []float64{1}}}
+	if err := writer.WriteFrame(0, 0.01, bad); err == nil {
+		t.Fatal("WriteFrame accepted a record with too few values")
+	}
+	if err := writer.WriteFrame(testFrames[0].Number, testFrames[0].Time, testFrames[0].Records); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reader, err := NewReader(bytes.NewReader(buffer.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if want := []string{"Sun", "Earth"}; !reflect.DeepEqual(reader.Names(), want) {
+		t.Errorf("Names = %q, want %q", reader.Names(), want)
+	}
+	if frames := readAll(t, reader); !reflect.DeepEqual(frames, testFrames[:1]) {
+		t.Errorf("frames = %+v, want %+v", frames, testFrames[:1])
+	}
+}
+
+func TestCompressedFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "results.nbs.gz")
+	writer, err := Create(filename, testHeader)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for _, frame := range testFrames {
+		if err := writer.WriteFrame(frame.Number, frame.Time, frame.Records); err != nil {
+			t.Fatalf("WriteFrame %d: %v", frame.Number, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reader, err := Open(filename)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer reader.Close()
+	if frames := readAll(t, reader); !reflect.DeepEqual(frames, testFrames) {
+		t.Errorf("frames = %+v, want %+v", frames, testFrames)
+	}
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+)
+
+type BoundaryPolicy int
+
+const (
+	BoundaryRemove  BoundaryPolicy = iota // Remove bodies farther than Radius from the centre of mass
+	BoundaryUnbound                       // Remove bodies with positive total energy
+	BoundaryReflect                       // Reflect bodies off a circular wall of Radius around Center
+	BoundaryAbsorb                        // Remove bodies that reach the circular wall
+)
+
+func ParseBoundaryPolicy(name string) (BoundaryPolicy, error) {
+	switch name {
+	case "remove":
+		return BoundaryRemove, nil
+	case "unbound":
+		return BoundaryUnbound, nil
+	case "reflect":
+		return BoundaryReflect, nil
+	case "absorb":
+		return BoundaryAbsorb, nil
+	}
+	return 0, fmt.Errorf("unknown boundary policy %q (want remove, unbound, reflect or absorb)", name)
+}
+
+// Boundary keeps the domain of an open run bounded, so that a single ejected
+// body cannot stretch the root region of the quadtree without limit.
+type Boundary struct {
+	Policy BoundaryPolicy
+	Radius float64
+	Center Vector2 // Centre of the wall for the reflect and absorb policies
+}
+
+// Escaper records a body removed by the boundary.
+type Escaper struct {
+	Name     string
+	Frame    int
+	Position Vector2
+	Velocity Vector2 // Velocity at the moment of removal
+}
+
+// Apply enforces the boundary on bodies after a frame, using root (built from
+// the current positions) for energies. Removed bodies are dropped from bodies
+// and returned.
+func (boundary *Boundary) Apply(bodies *Bodies, root *QuadNode, params *Params, frame int) []Escaper {
+
+	var escapers []Escaper
+	remove := map[*Body]bool{}
+
+	switch boundary.Policy {
+	case BoundaryRemove:
+		center, _ := bodies.CenterOfMass()
+		for _, body := range bodies.NodeBodies {
+			if body.Positions.Subtract(center).Magnitude() > boundary.Radius {
+				remove[body] = true
+			}
+		}
+	case BoundaryUnbound:
+		_, velocity := bodies.CenterOfMass()
+		for _, leaf := range root.Leaves() {
+			body := leaf.BodiesPtr.NodeBodies[0]
+			if body.KineticEnergy(velocity)+leaf.Potential(root, params) > 0 {
+				remove[body] = true
+			}
+		}
+	case BoundaryReflect:
+		for _, body := range bodies.NodeBodies {
+			offset := body.Positions.Subtract(boundary.Center)
+			distance := offset.Magnitude()
+			if distance > boundary.Radius {
+				normal := offset.Multiply(1 / distance)
+				// Mirror the position back inside the wall and flip the normal velocity
+				body.Positions = boundary.Center.Add(normal.Multiply(math.Max(2*boundary.Radius-distance, 0)))
+				body.Velocities = body.Velocities.Subtract(normal.Multiply(2 * body.Velocities.Dot(normal)))
+			}
+		}
+	case BoundaryAbsorb:
+		for _, body := range bodies.NodeBodies {
+			if body.Positions.Subtract(boundary.Center).Magnitude() >= boundary.Radius {
+				remove[body] = true
+			}
+		}
+	}
+
+	// The Wisdom-Holman central body anchors every orbit, so it stays
+	if wh, ok := params.Integrator.(*WisdomHolman); ok {
+		delete(remove, wh.Central)
+	}
+	if len(remove) == 0 {
+		return nil
+	}
+
+	kept := bodies.NodeBodies[:0]
+	for _, body := range bodies.NodeBodies {
+		if remove[body] {
+			escapers = append(escapers, Escaper{
+				Name:     body.Name,
+				Frame:    frame,
+				Position: body.Positions,
+				Velocity: body.Velocities,
+			})
+		} else {
+			kept = append(kept, body)
+		}
+	}
+	bodies.NodeBodies = kept
+
+	return escapers
+}
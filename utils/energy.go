@@ -0,0 +1,68 @@
+package utils
+
+// Potential returns the potential energy of the body held by this leaf due to
+// every other body, walking the tree with the same opening criterion as the
+// force calculation.
+func (node *QuadNode) Potential(root *QuadNode, params *Params) float64 {
+	return updatePotential(node, root, params)
+}
+
+func updatePotential(curNode *QuadNode, node *QuadNode, params *Params) float64 {
+
+	if node == nil || curNode == node {
+		return 0
+	}
+
+	potential := 0.0
+	for _, child := range node.Children {
+		if child != nil && child.TotalMass > 0 && curNode != child {
+
+			distance := params.Separation(curNode.Center, child.Center)
+			magnitude := distance.Magnitude()
+			s := node.NodeSize()
+			if params.Force.Accept(s, magnitude, params.Theta) || len(child.BodiesPtr.NodeBodies) == 1 {
+				potential += params.Force.Potential(distance, nodeSource(curNode), nodeSource(child))
+			} else {
+				potential += updatePotential(curNode, child, params)
+			}
+		}
+	}
+	return potential
+}
+
+// KineticEnergy returns the kinetic energy of the body relative to a frame
+// moving with velocity frame.
+func (body *Body) KineticEnergy(frame Vector2) float64 {
+	v := body.Velocities.Subtract(frame)
+	return 0.5 * body.Mass * v.Dot(v)
+}
+
+// CenterOfMass returns the mass-weighted mean position and velocity of the bodies.
+func (bodies *Bodies) CenterOfMass() (Vector2, Vector2) {
+	var position, velocity Vector2
+	totalMass := 0.0
+	for _, body := range bodies.NodeBodies {
+		position = position.Add(body.Positions.Multiply(body.Mass))
+		velocity = velocity.Add(body.Velocities.Multiply(body.Mass))
+		totalMass += body.Mass
+	}
+	if totalMass == 0 {
+		return Vector2{}, Vector2{}
+	}
+	return position.Multiply(1 / totalMass), velocity.Multiply(1 / totalMass)
+}
+
+// TotalEnergy returns the kinetic plus potential energy of the bodies by
+// direct summation with the run's force law, independent of the tree.
+// Periodic runs use nearest images only.
+func (bodies *Bodies) TotalEnergy(params *Params) float64 {
+	energy := 0.0
+	for i, body := range bodies.NodeBodies {
+		energy += body.KineticEnergy(Vector2{})
+		for _, other := range bodies.NodeBodies[i+1:] {
+			r := params.Separation(body.Positions, other.Positions)
+			energy += params.Force.Potential(r, bodySource(body), bodySource(other))
+		}
+	}
+	return energy
+}
@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"math"
+)
+
+// Source is one side of a pairwise interaction: a single body, or a tree node
+// standing in for all the bodies below it.
+type Source struct {
+	Mass   float64
+	Charge float64
+	Dipole Vector2 // Charge dipole about the centre of mass
+}
+
+func nodeSource(node *QuadNode) Source {
+	return Source{Mass: node.TotalMass, Charge: node.TotalCharge, Dipole: node.Dipole()}
+}
+
+// ForceLaw is a pairwise interaction used by the tree walk.
+type ForceLaw interface {
+	// Force returns the force on a due to b, where r is the separation from b to a.
+	Force(r Vector2, a Source, b Source) Vector2
+	// Potential returns the potential energy of the pair.
+	Potential(r Vector2, a Source, b Source) float64
+	// Accept reports whether a node of the given size at the given distance
+	// may be treated as a single source. Laws with a length scale refuse nodes
+	// that are large compared to it, since the monopole is no longer accurate.
+	Accept(size float64, distance float64, theta float64) bool
+}
+
+// JerkLaw is implemented by force laws that can also give the time
+// derivative of the force, as the Hermite integrator needs.
+type JerkLaw interface {
+	// Jerk returns the rate of change of the force on a due to b, where r is
+	// the separation from b to a and v the velocity of a relative to b.
+	Jerk(r Vector2, v Vector2, a Source, b Source) Vector2
+}
+
+// openingAngle is the Barnes-Hut criterion shared by the scale-free laws.
+func openingAngle(size float64, distance float64, theta float64) bool {
+	return size/distance < theta
+}
+
+// radial turns a signed force magnitude along r into a vector; negative
+// magnitudes attract.
+func radial(r Vector2, magnitude float64) Vector2 {
+	return r.Normalize().Multiply(magnitude)
+}
+
+// Newtonian is plain inverse-square gravity.
+type Newtonian struct {
+	G float64
+}
+
+func (law Newtonian) Force(r Vector2, a Source, b Source) Vector2 {
+	distance := r.Magnitude()
+	return radial(r, -law.G*a.Mass*b.Mass/(distance*distance))
+}
+
+func (law Newtonian) Potential(r Vector2, a Source, b Source) float64 {
+	return -law.G * a.Mass * b.Mass / r.Magnitude()
+}
+
+func (law Newtonian) Jerk(r Vector2, v Vector2, a Source, b Source) Vector2 {
+	return Softened{G: law.G}.Jerk(r, v, a, b)
+}
+
+func (law Newtonian) Accept(size float64, distance float64, theta float64) bool {
+	return openingAngle(size, distance, theta)
+}
+
+// Softened is Plummer-softened gravity, which stays finite at zero separation.
+type Softened struct {
+	G         float64
+	Softening float64
+}
+
+func (law Softened) Force(r Vector2, a Source, b Source) Vector2 {
+	d2 := r.Dot(r) + law.Softening*law.Softening
+	return r.Multiply(-law.G * a.Mass * b.Mass / (d2 * math.Sqrt(d2)))
+}
+
+func (law Softened) Potential(r Vector2, a Source, b Source) float64 {
+	return -law.G * a.Mass * b.Mass / math.Sqrt(r.Dot(r)+law.Softening*law.Softening)
+}
+
+func (law Softened) Jerk(r Vector2, v Vector2, a Source, b Source) Vector2 {
+	d2 := r.Dot(r) + law.Softening*law.Softening
+	d3 := d2 * math.Sqrt(d2)
+	return v.Subtract(r.Multiply(3 * r.Dot(v) / d2)).Multiply(-law.G * a.Mass * b.Mass / d3)
+}
+
+func (law Softened) Accept(size float64, distance float64, theta float64) bool {
+	return openingAngle(size, distance, theta)
+}
+
+// Yukawa is gravity screened beyond Length, with potential -G m1 m2 e^(-r/L) / r.
+type Yukawa struct {
+	G      float64
+	Length float64
+}
+
+func (law Yukawa) Force(r Vector2, a Source, b Source) Vector2 {
+	distance := r.Magnitude()
+	screening := math.Exp(-distance / law.Length)
+	return radial(r, -law.G*a.Mass*b.Mass*screening*(1/(distance*distance)+1/(law.Length*distance)))
+}
+
+func (law Yukawa) Potential(r Vector2, a Source, b Source) float64 {
+	distance := r.Magnitude()
+	return -law.G * a.Mass * b.Mass * math.Exp(-distance/law.Length) / distance
+}
+
+func (law Yukawa) Accept(size float64, distance float64, theta float64) bool {
+	return openingAngle(size, distance, theta) && size < theta*law.Length
+}
+
+// Coulomb is the electrostatic force between charges; like charges repel.
+// The dipole of b is included, so a node whose charges cancel still pushes
+// and pulls on nearby charges.
+type Coulomb struct {
+	K float64
+}
+
+func (law Coulomb) Force(r Vector2, a Source, b Source) Vector2 {
+	distance := r.Magnitude()
+	force := radial(r, law.K*a.Charge*b.Charge/(distance*distance))
+
+	if b.Dipole != (Vector2{}) {
+		unit := r.Multiply(1 / distance)
+		field := unit.Multiply(3 * b.Dipole.Dot(unit)).Subtract(b.Dipole)
+		force = force.Add(field.Multiply(law.K * a.Charge / (distance * distance * distance)))
+	}
+	return force
+}
+
+func (law Coulomb) Potential(r Vector2, a Source, b Source) float64 {
+	distance := r.Magnitude()
+	return law.K * a.Charge * (b.Charge/distance + b.Dipole.Dot(r)/(distance*distance*distance))
+}
+
+func (law Coulomb) Accept(size float64, distance float64, theta float64) bool {
+	return openingAngle(size, distance, theta)
+}
+
+// Electrogravity is gravity and electrostatics together, so a single tree
+// walk gives both the mass attraction and the attraction or repulsion of charges.
+type Electrogravity struct {
+	G float64
+	K float64
+}
+
+func (law Electrogravity) Force(r Vector2, a Source, b Source) Vector2 {
+	return Newtonian{G: law.G}.Force(r, a, b).Add(Coulomb{K: law.K}.Force(r, a, b))
+}
+
+func (law Electrogravity) Potential(r Vector2, a Source, b Source) float64 {
+	return Newtonian{G: law.G}.Potential(r, a, b) + Coulomb{K: law.K}.Potential(r, a, b)
+}
+
+func (law Electrogravity) Accept(size float64, distance float64, theta float64) bool {
+	return openingAngle(size, distance, theta)
+}
+
+// MOND boosts Newtonian gravity below the acceleration scale A0 using the
+// "simple" interpolating function nu(y) = 1/2 + sqrt(1/4 + 1/y), y = aN/A0.
+type MOND struct {
+	G  float64
+	A0 float64
+}
+
+func (law MOND) Force(r Vector2, a Source, b Source) Vector2 {
+	distance := r.Magnitude()
+	newtonian := law.G * b.Mass / (distance * distance)
+	acceleration := 0.5 * (newtonian + math.Sqrt(newtonian*newtonian+4*newtonian*law.A0))
+	return radial(r, -a.Mass*acceleration)
+}
+
+func (law MOND) Potential(r Vector2, a Source, b Source) float64 {
+	// Closed-form integral of the acceleration above; it grows
+	// logarithmically at large r, as MOND potentials do.
+	distance := r.Magnitude()
+	k := law.G * b.Mass
+	scale := 4 * k * law.A0
+	root := math.Sqrt(k*k + scale*distance*distance)
+	return a.Mass * (-k/(2*distance) + 0.5*(-root/distance+math.Sqrt(scale)*math.Asinh(math.Sqrt(scale)*distance/k)))
+}
+
+func (law MOND) Accept(size float64, distance float64, theta float64) bool {
+	return openingAngle(size, distance, theta)
+}
+
+// PowerLaw is an attractive force falling off as r^-N.
+type PowerLaw struct {
+	G float64
+	N float64
+}
+
+func (law PowerLaw) Force(r Vector2, a Source, b Source) Vector2 {
+	return radial(r, -law.G*a.Mass*b.Mass/math.Pow(r.Magnitude(), law.N))
+}
+
+func (law PowerLaw) Potential(r Vector2, a Source, b Source) float64 {
+	distance := r.Magnitude()
+	if law.N == 1 {
+		return law.G * a.Mass * b.Mass * math.Log(distance)
+	}
+	return -law.G * a.Mass * b.Mass / ((law.N - 1) * math.Pow(distance, law.N-1))
+}
+
+func (law PowerLaw) Accept(size float64, distance float64, theta float64) bool {
+	return openingAngle(size, distance, theta)
+}
@@ -0,0 +1,65 @@
+package utils
+
+// Hermite is the fourth-order Hermite predictor-corrector scheme for
+// collisional work. It needs the jerk, the time derivative of the force,
+// which the force pass computes alongside the force when this integrator is
+// in use. Setting theta to 0 makes the tree walk a direct summation.
+//
+// Each frame the force pass sees the predicted positions and velocities;
+// Step corrects the previous state with the new force and jerk and then
+// predicts the next one, so the positions written out are the predicted ones.
+// The step may change between frames: each correction uses the step its
+// prediction was made over.
+type Hermite struct{}
+
+// hermiteState is the corrected state of a body at the start of its current step.
+type hermiteState struct {
+	position     Vector2
+	velocity     Vector2
+	acceleration Vector2
+	jerk         Vector2
+	dt           float64 // Step the current prediction was made over
+}
+
+func (*Hermite) Init(bodies *Bodies, params *Params)  {}
+func (*Hermite) Begin(bodies *Bodies, params *Params) {}
+func (*Hermite) End(bodies *Bodies, params *Params)   {}
+
+func (*Hermite) Step(body *Body, params *Params) {
+	dt := params.Dt
+	acceleration := body.Force.Multiply(1 / body.Mass)
+	jerk := body.Jerk.Multiply(1 / body.Mass)
+
+	state := body.hermite
+	if state == nil {
+		// First step: the current state is exact
+		state = &hermiteState{position: body.Positions, velocity: body.Velocities}
+		body.hermite = state
+	} else {
+		// Correct using the force and jerk at the predicted state
+		step := state.dt
+		velocity := state.velocity.
+			Add(state.acceleration.Add(acceleration).Multiply(step / 2)).
+			Add(state.jerk.Subtract(jerk).Multiply(step * step / 12))
+		position := state.position.
+			Add(state.velocity.Add(velocity).Multiply(step / 2)).
+			Add(state.acceleration.Subtract(acceleration).Multiply(step * step / 12))
+		if params.Box != nil {
+			position = params.Box.Wrap(position)
+		}
+		state.position, state.velocity = position, velocity
+	}
+	state.acceleration, state.jerk, state.dt = acceleration, jerk, dt
+
+	// Predict the next step
+	body.Positions = state.position.
+		Add(state.velocity.Multiply(dt)).
+		Add(acceleration.Multiply(dt * dt / 2)).
+		Add(jerk.Multiply(dt * dt * dt / 6))
+	body.Velocities = state.velocity.
+		Add(acceleration.Multiply(dt)).
+		Add(jerk.Multiply(dt * dt / 2))
+	if params.Box != nil {
+		body.Positions = params.Box.Wrap(body.Positions)
+	}
+}
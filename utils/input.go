@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"proj3-redesigned/compression"
+	"strconv"
+	"strings"
+)
+
+// FormatVersion is the version of the header block written by this code.
+const FormatVersion = 2
+
+// DefaultColumns is the column schema of files without a Columns row.
+var DefaultColumns = []string{"Name", "PosX", "PosY", "VelX", "VelY", "Mass", "Charge"}
+
+// Header is the run metadata of an input file. Version 2 files start with a
+// block of key/value rows, opened by "Format,2" and closed by the Columns row:
+//
+//	Format,2
+//	Units,au
+//	Dt,0.01
+//	Theta,0.5
+//	Frames,5000
+//	Softening,0
+//	Integrator,leapfrog
+//	Dimension,2
+//	Columns,Name,PosX,PosY,VelX,VelY,Mass,Charge
+//
+// Every key but Format and Columns is optional. Older files without the block are version 1; their frame count and
+// G come from the "SimulationTime,5000,GravitationalConstant,6.6743" trailer.
+type Header struct {
+	Version    int
+	Units      string
+	Dt         float64
+	Theta      float64
+	Frames     float64
+	G          float64 // Version 2 files use it to override the G of the units; version 1 files ignore it
+	Softening  float64
+	Integrator string
+	Dimension  int
+	Columns    []string
+
+	Keys map[string]bool // Header keys present in the file, so that zero values can be told from missing ones
+}
+
+// ReadInput reads bodies and the header from a CSV file, which may be
+// compressed with gzip (.gz) or Zstandard (.zst).
+func ReadInput(filename string) (Bodies, Header) {
+	file, err := compression.Open(filename)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comma = ',' // Correct delimiter for CSV files
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1 // Header rows and the Charge column vary in length
+
+	var bodies Bodies
+	header := Header{Version: 1, Dimension: 2, Columns: DefaultColumns, Keys: map[string]bool{}}
+	inHeader := false
+	columns := columnIndex(header.Columns)
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break // Exit the loop at end of file
+		}
+		if err != nil {
+			fmt.Printf("Error reading input: %s\n", err)
+			if _, malformed := err.(*csv.ParseError); malformed {
+				continue // Skip the bad row
+			}
+			break
+		}
+
+		if len(bodies.NodeBodies) == 0 && !inHeader && record[0] == "Format" {
+			header.Version = int(parseField(record, 1, 64))
+			if header.Version < 2 || header.Version > FormatVersion {
+				panic(fmt.Sprintf("%s: unsupported format version %s", filename, field(record, 1)))
+			}
+			inHeader = true
+			continue
+		}
+
+		if inHeader {
+			header.Keys[record[0]] = true
+			switch record[0] {
+			case "Units":
+				header.Units = field(record, 1)
+			case "Dt":
+				header.Dt = parseField(record, 1, 64)
+			case "Theta":
+				header.Theta = parseField(record, 1, 64)
+			case "Frames":
+				header.Frames = parseField(record, 1, 64)
+			case "G":
+				header.G = parseField(record, 1, 64)
+			case "Softening":
+				header.Softening = parseField(record, 1, 64)
+			case "Integrator":
+				header.Integrator = field(record, 1)
+			case "Dimension":
+				header.Dimension = int(parseField(record, 1, 64))
+				if header.Dimension != 2 {
+					panic(fmt.Sprintf("%s: only two-dimensional input is supported, not %d", filename, header.Dimension))
+				}
+			case "Columns":
+				header.Columns = trimEmpty(record[1:])
+				columns = columnIndex(header.Columns)
+				for _, required := range DefaultColumns[:6] {
+					if _, ok := columns[required]; !ok {
+						panic(fmt.Sprintf("%s: Columns row has no %s column", filename, required))
+					}
+				}
+				inHeader = false
+			default:
+				fmt.Printf("Ignoring unknown header key %q\n", record[0])
+			}
+			continue
+		}
+
+		// Older files: the trailer row and the Units row
+		if record[0] == "SimulationTime" {
+			if len(record) >= 4 { // Check for at least 4 fields
+				if simTime, err := strconv.ParseFloat(record[1], 64); err == nil {
+					header.Frames = simTime
+				}
+				if gravConst, err := strconv.ParseFloat(record[3], 64); err == nil {
+					header.G = gravConst
+				}
+			}
+			continue
+		} else if record[0] == "Units" && header.Version == 1 {
+			header.Units = field(record, 1)
+			continue
+		}
+
+		// Files without a Format row are read in single precision, as they
+		// always have been, so that their runs do not change
+		bitSize := 64
+		if header.Version < 2 {
+			bitSize = 32
+		}
+		var body Body
+		body.Name = field(record, columns["Name"])
+		body.Positions.X = parseField(record, columns["PosX"], bitSize)
+		body.Positions.Y = parseField(record, columns["PosY"], bitSize)
+		body.Velocities.X = parseField(record, columns["VelX"], bitSize)
+		body.Velocities.Y = parseField(record, columns["VelY"], bitSize)
+		body.Mass = parseField(record, columns["Mass"], bitSize)
+		if index, ok := columns["Charge"]; ok {
+			body.Charge = parseField(record, index, bitSize)
+		}
+		bodies.NodeBodies = append(bodies.NodeBodies, &body)
+	}
+
+	if inHeader {
+		panic(fmt.Sprintf("%s: header block has no Columns row", filename))
+	}
+	return bodies, header
+}
+
+func columnIndex(columns []string) map[string]int {
+	index := make(map[string]int, len(columns))
+	for i, name := range columns {
+		index[name] = i
+	}
+	return index
+}
+
+// field returns the trimmed field at index, or "" if the row is shorter.
+func field(record []string, index int) string {
+	if index < 0 || index >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[index])
+}
+
+// parseField returns the number at index, rounded to bitSize bits, or 0 if
+// it is missing or malformed.
+func parseField(record []string, index int, bitSize int) float64 {
+	value, err := strconv.ParseFloat(field(record, index), bitSize)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// trimEmpty drops the empty trailing fields that spreadsheets leave behind.
+func trimEmpty(fields []string) []string {
+	for len(fields) > 0 && strings.TrimSpace(fields[len(fields)-1]) == "" {
+		fields = fields[:len(fields)-1]
+	}
+	return fields
+}
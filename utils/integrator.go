@@ -0,0 +1,80 @@
+package utils
+
+import "fmt"
+
+// Integrator advances the bodies once the force pass of a frame is done.
+// Begin and End run once per frame on the calling goroutine; Step runs once
+// per body and may run concurrently with other Steps.
+type Integrator interface {
+	// Init is called once, after the input has been read and before the first tree is built.
+	Init(bodies *Bodies, params *Params)
+	Begin(bodies *Bodies, params *Params)
+	Step(body *Body, params *Params)
+	End(bodies *Bodies, params *Params)
+}
+
+// NewIntegrator returns the named integrator: leapfrog, wh (Wisdom-Holman
+// around the heaviest body) or hermite.
+func NewIntegrator(name string) (Integrator, error) {
+	switch name {
+	case "leapfrog":
+		return Leapfrog{}, nil
+	case "wh":
+		return &WisdomHolman{}, nil
+	case "hermite":
+		return &Hermite{}, nil
+	}
+	return nil, fmt.Errorf("unknown integrator %q", name)
+}
+
+// treeFilter is implemented by integrators that handle some bodies outside
+// the quadtree.
+type treeFilter interface {
+	InTree(body *Body) bool
+}
+
+// TreeBodies returns the bodies that belong in the quadtree, which are also
+// the bodies the integrator steps. Components of regularized binaries are
+// replaced by their centre of mass.
+func (params *Params) TreeBodies(bodies *Bodies) []*Body {
+	filter, filtered := params.Integrator.(treeFilter)
+	if !filtered && params.Regularizer == nil {
+		return bodies.NodeBodies
+	}
+	var members []*Body
+	for _, body := range bodies.NodeBodies {
+		if filtered && !filter.InTree(body) {
+			continue
+		}
+		if params.Regularizer != nil && params.Regularizer.InBinary(body) {
+			continue
+		}
+		members = append(members, body)
+	}
+	if params.Regularizer != nil {
+		members = append(members, params.Regularizer.centers()...)
+	}
+	return members
+}
+
+// Reverse negates every velocity, including those of regularized binary
+// centres, and drops integrator history so the run can retrace its steps.
+func (params *Params) Reverse(bodies *Bodies) {
+	for _, body := range bodies.NodeBodies {
+		body.Velocities = body.Velocities.Multiply(-1)
+		body.hermite = nil
+	}
+	if params.Regularizer != nil {
+		for _, center := range params.Regularizer.centers() {
+			center.Velocities = center.Velocities.Multiply(-1)
+		}
+	}
+}
+
+// Leapfrog is the kick-drift scheme of Body.Update.
+type Leapfrog struct{}
+
+func (Leapfrog) Init(bodies *Bodies, params *Params)  {}
+func (Leapfrog) Begin(bodies *Bodies, params *Params) {}
+func (Leapfrog) Step(body *Body, params *Params)      { body.Update(params) }
+func (Leapfrog) End(bodies *Bodies, params *Params)   {}
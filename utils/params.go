@@ -0,0 +1,307 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+)
+
+// Params holds the per-run settings that every engine threads through the
+// force calculation and the body update.
+type Params struct {
+	Dt         float64      // Time step size
+	Theta      float64      // Barnes-Hut opening angle
+	G          float64      // Gravitational constant
+	Force      ForceLaw     // Pairwise interaction used by the tree walk
+	Integrator Integrator   // Advances the bodies after each force pass
+	Box        *PeriodicBox // Periodic domain, nil for an open domain
+
+	Boundary *Boundary      // Boundary policy for an open domain, nil to let bodies roam freely
+	PN       *PostNewtonian // Post-Newtonian corrections for close pairs, nil for none
+
+	Regularizer *Regularizer // Regularized close binaries, nil for none
+
+	Units        UnitSystem   // Units of the input, which set G; unset until the input is read unless given up front
+	OutputUnits  string       // Unit system requested for the output, "" for the input units
+	Output       Conversion   // Factors from Units to OutputUnits
+	Outputs      []string     // Results files, in the format of their extension; nil for the engine's default
+	OutputFormat string       // Format of the engine's default results file: csv, binary, jsonl or vtk
+	Sinks        []OutputSink // Sinks attached to the run besides the files, such as an in-memory sink
+	Select       Selection    // Which frames, bodies and columns are written
+	OutputBuffer int          // Frames queued for the writer goroutine, 0 to write on the engine's goroutine
+	TreeOutput   string       // File the quadtree of each written frame is exported to, "" for none
+
+	Overrides map[string]bool // Settings given on the command line, by flag name, which the input header leaves alone
+
+	constants UnitSystem // Units the Coulomb constant, a0 and the speed of light are in, SI until SetUnits
+}
+
+// NewParams returns the settings the engines have always used: dt = 0.01,
+// theta = 0.5, Newtonian gravity with the SI gravitational constant and the
+// leapfrog update.
+func NewParams() *Params {
+	return &Params{
+		Dt:         0.01,
+		Theta:      0.5,
+		G:          G,
+		Force:      Newtonian{G: G},
+		Integrator: Leapfrog{},
+		Output:     Identity,
+
+		OutputFormat: "csv",
+		Select:       Selection{Every: 1, Flush: 1},
+
+		OutputBuffer: 8,
+	}
+}
+
+// Selection picks what goes into the results and how often they are flushed.
+type Selection struct {
+	Every    int      // Write every Every-th frame, starting with the first
+	Interval float64  // Write once per Interval of simulated time instead, when positive
+	Columns  []string // Value columns to write, nil for all
+	Bodies   []string // Shell patterns matched against body names, nil for all bodies
+	Flush    int      // Flush after this many written frames, 0 only when the run ends
+}
+
+// Due reports whether frame is written. The frame advances the simulated
+// time by dt to time, and with an Interval it is written when it crosses a
+// multiple of Interval.
+func (selection Selection) Due(frame int, time float64, dt float64) bool {
+	if selection.Interval > 0 {
+		const slack = 1e-9 // Keeps rounding from moving a crossing to the next frame
+		before := math.Floor((time-dt)/selection.Interval + slack)
+		after := math.Floor(time/selection.Interval + slack)
+		return after > before
+	}
+	return frame%selection.Every == 0
+}
+
+// Separation returns the vector from b to a, using the nearest periodic image
+// when the run has a periodic box.
+func (params *Params) Separation(a Vector2, b Vector2) Vector2 {
+	r := a.Subtract(b)
+	if params.Box != nil {
+		r = params.Box.NearestImage(r)
+	}
+	return r
+}
+
+// Validate reports settings that cannot be combined.
+func (params *Params) Validate() error {
+	if _, newtonian := params.Force.(Newtonian); params.Box != nil && params.Box.Ewald && !newtonian {
+		return fmt.Errorf("the Ewald correction is only valid for the newton force law")
+	}
+	if _, wh := params.Integrator.(*WisdomHolman); wh {
+		// The Kepler drift is exact only for the plain inverse-square law
+		if _, newtonian := params.Force.(Newtonian); !newtonian {
+			return fmt.Errorf("the Wisdom-Holman integrator needs the newton force law")
+		}
+		if params.PN != nil {
+			return fmt.Errorf("the Wisdom-Holman integrator cannot be combined with post-Newtonian corrections")
+		}
+		if params.Box != nil {
+			return fmt.Errorf("the Wisdom-Holman integrator cannot run in a periodic box")
+		}
+	}
+	if params.Regularizer != nil {
+		if _, newtonian := params.Force.(Newtonian); !newtonian {
+			return fmt.Errorf("binary regularization needs the newton force law")
+		}
+		if _, leapfrog := params.Integrator.(Leapfrog); !leapfrog {
+			return fmt.Errorf("binary regularization needs the leapfrog integrator")
+		}
+		if params.Regularizer.Radius <= 0 {
+			return fmt.Errorf("binary regularization needs a positive radius")
+		}
+	}
+	if _, hermite := params.Integrator.(*Hermite); hermite {
+		if _, ok := params.Force.(JerkLaw); !ok {
+			return fmt.Errorf("the Hermite integrator needs the newton or softened force law")
+		}
+		if params.Box != nil && params.Box.Ewald {
+			return fmt.Errorf("the Hermite integrator has no jerk for the Ewald correction")
+		}
+		if params.PN != nil {
+			return fmt.Errorf("the Hermite integrator has no jerk for post-Newtonian corrections")
+		}
+	}
+	if params.Box != nil && params.Boundary != nil {
+		return fmt.Errorf("a periodic box cannot be combined with a boundary policy")
+	}
+	if params.Boundary != nil && params.Boundary.Policy != BoundaryUnbound && params.Boundary.Radius <= 0 {
+		return fmt.Errorf("boundary policy needs a positive radius")
+	}
+	if _, newtonian := params.Force.(Newtonian); params.PN != nil && !newtonian {
+		return fmt.Errorf("post-Newtonian corrections need the newton force law")
+	}
+	if params.PN != nil && (params.PN.C <= 0 || params.PN.Radius <= 0) {
+		return fmt.Errorf("post-Newtonian corrections need a positive speed of light and radius")
+	}
+	if params.Select.Every < 1 || params.Select.Interval < 0 || params.Select.Flush < 0 {
+		return fmt.Errorf("output cadence needs every >= 1, interval >= 0 and flush >= 0")
+	}
+	if params.OutputBuffer < 0 {
+		return fmt.Errorf("output buffer cannot be negative")
+	}
+	if params.Select.Every > 1 && params.Select.Interval > 0 {
+		return fmt.Errorf("output cadence is either every k frames or an interval of simulated time, not both")
+	}
+	return nil
+}
+
+// jerkLaw returns the force law's jerk when the integrator needs it, nil otherwise.
+func (params *Params) jerkLaw() JerkLaw {
+	if _, hermite := params.Integrator.(*Hermite); !hermite {
+		return nil
+	}
+	law, _ := params.Force.(JerkLaw)
+	return law
+}
+
+// SetUnits declares the unit system of the input. G, including the copy held
+// by the force law, is derived from it, the other physical constants are
+// converted to it, and the output conversion is set up for OutputUnits;
+// Henon output units are derived from bodies.
+func (params *Params) SetUnits(units UnitSystem, bodies *Bodies) error {
+	params.Units = units
+	params.setG(units.G())
+	params.convertConstants(units)
+
+	output := units
+	if params.OutputUnits == "henon" {
+		var err error
+		if output, err = HenonUnits(bodies, units); err != nil {
+			return err
+		}
+	} else if params.OutputUnits != "" {
+		var err error
+		if output, err = LookupUnits(params.OutputUnits); err != nil {
+			return err
+		}
+	}
+
+	conversion, err := NewConversion(units, output)
+	if err != nil {
+		return err
+	}
+	params.Output = conversion
+	return nil
+}
+
+// ApplyHeader takes the settings of an input file's header, except those in
+// Overrides, and declares the units of bodies. Version 1 files only carry
+// their units; the G of their trailer has never been used. Every body needs a
+// positive mass, since the update divides the force by it.
+func (params *Params) ApplyHeader(header Header, bodies *Bodies) error {
+	for _, body := range bodies.NodeBodies {
+		if !(body.Mass > 0) {
+			return fmt.Errorf("body %s needs a positive mass, not %g", body.Name, body.Mass)
+		}
+	}
+
+	given := func(key string, flag string) bool {
+		return header.Version >= 2 && header.Keys[key] && !params.Overrides[flag]
+	}
+
+	if given("Dt", "dt") {
+		if header.Dt <= 0 {
+			return fmt.Errorf("header Dt must be positive")
+		}
+		params.Dt = header.Dt
+	}
+	if given("Theta", "theta") {
+		params.Theta = header.Theta
+	}
+	if given("Integrator", "integrator") {
+		integrator, err := NewIntegrator(header.Integrator)
+		if err != nil {
+			return err
+		}
+		params.Integrator = integrator
+	}
+	// A softening length turns the default force law into the softened one
+	if given("Softening", "softening") && !params.Overrides["force"] && header.Softening > 0 {
+		if _, newtonian := params.Force.(Newtonian); newtonian {
+			params.Force = Softened{G: params.G, Softening: header.Softening}
+		}
+	}
+
+	// Units given up front take precedence over the file's
+	units := SI
+	name := header.Units
+	if params.Units.Name != "" {
+		name = params.Units.Name
+	}
+	if name != "" {
+		var err error
+		if units, err = LookupUnits(name); err != nil {
+			return err
+		}
+	}
+	if err := params.SetUnits(units, bodies); err != nil {
+		return err
+	}
+	if given("G", "units") {
+		params.setG(header.G)
+	}
+
+	return params.Validate()
+}
+
+// convertConstants takes the Coulomb constant, the MOND acceleration scale
+// and the speed of light, which are given in SI like G, to units. Henon units
+// have no physical scale, so there they are taken as given.
+func (params *Params) convertConstants(units UnitSystem) {
+	from := params.constants
+	if from.Name == "" {
+		from = SI
+	}
+	conversion, err := NewConversion(from, units)
+	if err != nil {
+		return
+	}
+	params.constants = units
+
+	length, mass, time := conversion.Length, conversion.Mass, conversion.Time
+	coulomb := mass * length * length * length / (time * time) // K is in kg m^3 s^-2 C^-2
+	acceleration := length / (time * time)
+	switch law := params.Force.(type) {
+	case Coulomb:
+		law.K *= coulomb
+		params.Force = law
+	case Electrogravity:
+		law.K *= coulomb
+		params.Force = law
+	case MOND:
+		law.A0 *= acceleration
+		params.Force = law
+	}
+	if params.PN != nil {
+		params.PN.C *= conversion.Velocity
+	}
+}
+
+// setG changes the gravitational constant of the run and of the force law.
+func (params *Params) setG(G float64) {
+	params.G = G
+	switch law := params.Force.(type) {
+	case Newtonian:
+		law.G = G
+		params.Force = law
+	case Softened:
+		law.G = G
+		params.Force = law
+	case Yukawa:
+		law.G = G
+		params.Force = law
+	case Electrogravity:
+		law.G = G
+		params.Force = law
+	case MOND:
+		law.G = G
+		params.Force = law
+	case PowerLaw:
+		law.G = G
+		params.Force = law
+	}
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"math"
+)
+
+// Number of cells per axis in the tabulated Ewald correction.
+const ewaldGrid = 32
+
+// PeriodicBox describes a rectangular domain that repeats in x and y.
+// Bodies leaving one side re-enter on the opposite side, and forces are
+// computed between nearest images. With Ewald enabled, the contribution of
+// all the other periodic images is added as a tabulated correction.
+type PeriodicBox struct {
+	Min, Max Vector2
+	Ewald    bool
+	table    [ewaldGrid + 1][ewaldGrid + 1]Vector2
+}
+
+func NewPeriodicBox(min Vector2, max Vector2, ewald bool) *PeriodicBox {
+	box := &PeriodicBox{Min: min, Max: max, Ewald: ewald}
+	if ewald {
+		box.buildEwaldTable()
+	}
+	return box
+}
+
+func (box *PeriodicBox) Size() Vector2 {
+	return box.Max.Subtract(box.Min)
+}
+
+// Region returns the box as a quadtree region. The root cell of a periodic
+// run is always the box itself rather than the bounds of the bodies.
+func (box *PeriodicBox) Region() [2]Vector2 {
+	return [2]Vector2{box.Min, box.Max}
+}
+
+// Wrap maps a position back into [Min, Max).
+func (box *PeriodicBox) Wrap(p Vector2) Vector2 {
+	size := box.Size()
+	return Vector2{
+		X: wrapAxis(p.X, box.Min.X, size.X),
+		Y: wrapAxis(p.Y, box.Min.Y, size.Y),
+	}
+}
+
+func wrapAxis(x float64, min float64, length float64) float64 {
+	x = min + math.Mod(x-min, length)
+	if x < min {
+		x += length
+	}
+	if x >= min+length { // Rounding can land exactly on the upper edge
+		x = min
+	}
+	return x
+}
+
+// NearestImage returns the shortest periodic equivalent of separation r.
+func (box *PeriodicBox) NearestImage(r Vector2) Vector2 {
+	size := box.Size()
+	r.X -= size.X * math.Round(r.X/size.X)
+	r.Y -= size.Y * math.Round(r.Y/size.Y)
+	return r
+}
+
+// EwaldCorrection returns the acceleration on a unit test mass at nearest-image
+// separation r from a unit source, due to every periodic image of the source
+// except the nearest one, in units of G. The table is bilinearly interpolated.
+func (box *PeriodicBox) EwaldCorrection(r Vector2) Vector2 {
+	size := box.Size()
+	fx := (r.X/size.X + 0.5) * ewaldGrid
+	fy := (r.Y/size.Y + 0.5) * ewaldGrid
+	fx = math.Max(0, math.Min(fx, ewaldGrid))
+	fy = math.Max(0, math.Min(fy, ewaldGrid))
+
+	i, j := int(fx), int(fy)
+	if i == ewaldGrid {
+		i--
+	}
+	if j == ewaldGrid {
+		j--
+	}
+	tx, ty := fx-float64(i), fy-float64(j)
+
+	c00, c10 := box.table[i][j], box.table[i+1][j]
+	c01, c11 := box.table[i][j+1], box.table[i+1][j+1]
+	return c00.Multiply((1 - tx) * (1 - ty)).
+		Add(c10.Multiply(tx * (1 - ty))).
+		Add(c01.Multiply((1 - tx) * ty)).
+		Add(c11.Multiply(tx * ty))
+}
+
+// buildEwaldTable tabulates the Ewald sum minus the nearest-image Newtonian
+// term over one box of separations. Bodies live in the z = 0 plane of a
+// lattice that is periodic in x and y only, so the reciprocal-space part is
+// the z = 0 limit of the slab Ewald sum.
+func (box *PeriodicBox) buildEwaldTable() {
+	size := box.Size()
+	alpha := 2 / math.Min(size.X, size.Y)
+	for i := 0; i <= ewaldGrid; i++ {
+		for j := 0; j <= ewaldGrid; j++ {
+			r := Vector2{
+				X: (float64(i)/ewaldGrid - 0.5) * size.X,
+				Y: (float64(j)/ewaldGrid - 0.5) * size.Y,
+			}
+			box.table[i][j] = ewaldAcceleration(r, size, alpha)
+		}
+	}
+}
+
+func ewaldAcceleration(r Vector2, size Vector2, alpha float64) Vector2 {
+	const images = 4
+	var acc Vector2
+
+	// Real-space sum. The nearest image is handled by the tree walk, so its
+	// plain Newtonian part is left out here.
+	for nx := -images; nx <= images; nx++ {
+		for ny := -images; ny <= images; ny++ {
+			d := Vector2{X: r.X + float64(nx)*size.X, Y: r.Y + float64(ny)*size.Y}
+			s := d.Magnitude()
+			if s == 0 {
+				continue
+			}
+			gauss := 2 * alpha / math.SqrtPi * math.Exp(-alpha*alpha*s*s) / s
+			var scale float64
+			if nx == 0 && ny == 0 {
+				scale = math.Erf(alpha*s)/(s*s) - gauss
+			} else {
+				scale = -(math.Erfc(alpha*s)/(s*s) + gauss)
+			}
+			acc = acc.Add(d.Multiply(scale / s))
+		}
+	}
+
+	// Reciprocal-space sum
+	area := size.X * size.Y
+	for kx := -images; kx <= images; kx++ {
+		for ky := -images; ky <= images; ky++ {
+			if kx == 0 && ky == 0 {
+				continue
+			}
+			k := Vector2{X: 2 * math.Pi * float64(kx) / size.X, Y: 2 * math.Pi * float64(ky) / size.Y}
+			kMag := k.Magnitude()
+			scale := -2 * math.Pi / area * math.Erfc(kMag/(2*alpha)) / kMag * math.Sin(k.Dot(r))
+			acc = acc.Add(k.Multiply(scale))
+		}
+	}
+
+	return acc
+}
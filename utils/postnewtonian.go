@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"math"
+)
+
+// PostNewtonian adds relativistic corrections to the force between bodies
+// closer than Radius, for compact binaries where Newtonian gravity alone
+// misses the periapsis precession and the orbital decay.
+type PostNewtonian struct {
+	C         float64 // Speed of light
+	Radius    float64 // Only pairs closer than this are corrected
+	Radiation bool    // Also add the 2.5PN radiation-reaction term
+}
+
+// relativeAcceleration returns the post-Newtonian part of the relative
+// acceleration of a pair with separation r, relative velocity v and total
+// mass m, in harmonic coordinates (Kidder 1995, eq. 2.2).
+func (pn *PostNewtonian) relativeAcceleration(r Vector2, v Vector2, m float64, eta float64, G float64) Vector2 {
+	distance := r.Magnitude()
+	n := r.Multiply(1 / distance)
+	rDot := n.Dot(v)
+	v2 := v.Dot(v)
+	gmr := G * m / distance // GM/r
+	c2 := pn.C * pn.C
+
+	// 1PN: periapsis precession
+	a := -(1.5*eta*rDot*rDot - (1+3*eta)*v2 + (4+2*eta)*gmr) / c2
+	b := -(4 - 2*eta) * rDot / c2
+
+	// 2.5PN: radiation reaction
+	if pn.Radiation {
+		c5 := c2 * c2 * pn.C
+		a += -1.6 * eta * gmr * rDot * (18*v2 + 2.0/3.0*gmr - 25*rDot*rDot) / c5
+		b += 1.6 * eta * gmr * (6*v2 - 2*gmr - 15*rDot*rDot) / c5
+	}
+
+	return n.Multiply(a).Add(v.Multiply(b)).Multiply(-gmr / distance)
+}
+
+// addPostNewtonian adds the correction from every body within Radius of the
+// body held by leaf. Each body only writes its own force, so leaves can be
+// processed concurrently.
+func addPostNewtonian(leaf *QuadNode, root *QuadNode, params *Params) {
+	body := leaf.BodiesPtr.NodeBodies[0]
+	for _, other := range root.Within(body.Positions, params.PN.Radius, params) {
+		if other == body {
+			continue
+		}
+		m := body.Mass + other.Mass
+		mu := body.Mass * other.Mass / m
+		r := params.Separation(body.Positions, other.Positions)
+		v := body.Velocities.Subtract(other.Velocities)
+		acceleration := params.PN.relativeAcceleration(r, v, m, mu/m, params.G)
+		body.Force = body.Force.Add(acceleration.Multiply(mu))
+	}
+}
+
+// Within returns the bodies below this node within radius of position.
+func (node *QuadNode) Within(position Vector2, radius float64, params *Params) []*Body {
+	// Skip nodes whose region lies entirely outside the circle
+	center := node.Region[0].Add(node.Region[1]).Multiply(0.5)
+	half := node.Region[1].Subtract(node.Region[0]).Multiply(0.5)
+	offset := params.Separation(position, center)
+	dx := math.Max(math.Abs(offset.X)-half.X, 0)
+	dy := math.Max(math.Abs(offset.Y)-half.Y, 0)
+	if dx*dx+dy*dy > radius*radius {
+		return nil
+	}
+
+	var found []*Body
+	if node.BodiesPtr != nil {
+		for _, body := range node.BodiesPtr.NodeBodies {
+			if params.Separation(position, body.Positions).Magnitude() <= radius {
+				found = append(found, body)
+			}
+		}
+	}
+	for _, child := range node.Children {
+		if child != nil {
+			found = append(found, child.Within(position, radius, params)...)
+		}
+	}
+	return found
+}
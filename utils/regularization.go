@@ -0,0 +1,260 @@
+package utils
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Regularizer integrates tightly bound pairs in Levi-Civita coordinates, the
+// planar form of Kustaanheimo-Stiefel regularization, so hard binaries need
+// neither tiny timesteps nor blow up at pericentre. Each binary appears in
+// the quadtree as a single body at its centre of mass, which the integrator
+// advances like any other; the relative orbit is advanced separately under
+// the tidal pull of the rest of the system.
+type Regularizer struct {
+	Radius        float64 // Bound pairs closer than this become binaries; they split beyond twice this
+	StepsPerOrbit int     // Regularized steps per orbit of the relative motion
+
+	binaries []*Binary
+	members  map[*Body]*Binary // Components and centres of every binary
+}
+
+// Binary is a regularized pair and the pseudo-body that stands in for it.
+type Binary struct {
+	Primary   *Body
+	Secondary *Body
+	Center    *Body
+}
+
+func NewRegularizer(radius float64) *Regularizer {
+	return &Regularizer{
+		Radius:        radius,
+		StepsPerOrbit: 64,
+		members:       map[*Body]*Binary{},
+	}
+}
+
+// InBinary reports whether body is a component, or the centre-of-mass
+// pseudo-body, of a regularized binary.
+func (reg *Regularizer) InBinary(body *Body) bool {
+	_, ok := reg.members[body]
+	return ok
+}
+
+// Binaries returns the current regularized pairs.
+func (reg *Regularizer) Binaries() []*Binary {
+	return reg.binaries
+}
+
+func (reg *Regularizer) centers() []*Body {
+	centers := make([]*Body, len(reg.binaries))
+	for i, binary := range reg.binaries {
+		centers[i] = binary.Center
+	}
+	return centers
+}
+
+// Advance moves the components of every binary to follow its centre of
+// mass, which the integrator has already advanced by one step. root is the
+// tree the frame's forces were computed from.
+func (reg *Regularizer) Advance(root *QuadNode, params *Params) {
+	for _, binary := range reg.binaries {
+		primary, secondary := binary.Primary, binary.Secondary
+
+		// Tidal acceleration on the relative orbit from everything else
+		primaryForce := root.forceAt(primary.Positions, bodySource(primary), binary.Center, params)
+		secondaryForce := root.forceAt(secondary.Positions, bodySource(secondary), binary.Center, params)
+		perturbation := primaryForce.Multiply(1 / primary.Mass).Subtract(secondaryForce.Multiply(1 / secondary.Mass))
+
+		r := params.Separation(primary.Positions, secondary.Positions)
+		v := primary.Velocities.Subtract(secondary.Velocities)
+		mu := params.G * binary.Center.Mass
+		r, v = reg.levCivitaDrift(r, v, mu, perturbation, params.Dt)
+
+		reg.place(binary, r, v, params)
+
+		// Report the total force on each component for output
+		mutual := r.Multiply(-mu / math.Pow(r.Magnitude(), 3))
+		primary.Force = primaryForce.Add(mutual.Multiply(primary.Mass * secondary.Mass / binary.Center.Mass))
+		secondary.Force = secondaryForce.Subtract(mutual.Multiply(primary.Mass * secondary.Mass / binary.Center.Mass))
+	}
+}
+
+// place puts the components of binary at relative position r and velocity v
+// around its centre of mass.
+func (reg *Regularizer) place(binary *Binary, r Vector2, v Vector2, params *Params) {
+	center := binary.Center
+	primaryShare := binary.Secondary.Mass / center.Mass
+	secondaryShare := binary.Primary.Mass / center.Mass
+
+	binary.Primary.Positions = center.Positions.Add(r.Multiply(primaryShare))
+	binary.Secondary.Positions = center.Positions.Subtract(r.Multiply(secondaryShare))
+	binary.Primary.Velocities = center.Velocities.Add(v.Multiply(primaryShare))
+	binary.Secondary.Velocities = center.Velocities.Subtract(v.Multiply(secondaryShare))
+
+	if params.Box != nil {
+		binary.Primary.Positions = params.Box.Wrap(binary.Primary.Positions)
+		binary.Secondary.Positions = params.Box.Wrap(binary.Secondary.Positions)
+	}
+}
+
+// levCivitaDrift advances a perturbed Kepler orbit by dt. With r = u^2 and
+// dt = |u|^2 ds the motion becomes a harmonic oscillator in u,
+//
+//	u'' = (h/2) u + (|u|^2/2) conj(u) P,   h' = |u|^2 (dr/dt . P),   t' = |u|^2,
+//
+// which is regular at r = 0. It is integrated with RK4 in s.
+func (reg *Regularizer) levCivitaDrift(r Vector2, v Vector2, mu float64, perturbation Vector2, dt float64) (Vector2, Vector2) {
+	z := complex(r.X, r.Y)
+	zDot := complex(v.X, v.Y)
+	p := complex(perturbation.X, perturbation.Y)
+
+	u := cmplx.Sqrt(z)
+	uPrime := cmplx.Conj(u) * zDot / 2
+	h := 0.5*real(zDot*cmplx.Conj(zDot)) - mu/cmplx.Abs(z)
+	t := 0.0
+
+	// The oscillator has frequency sqrt(-h/2) for a bound orbit
+	ds := 2 * math.Pi / math.Sqrt(math.Max(-h/2, mu/(2*reg.Radius))) / float64(reg.StepsPerOrbit)
+
+	derivative := func(u complex128, uPrime complex128, h float64) (complex128, complex128, float64, float64) {
+		r2 := real(u * cmplx.Conj(u))
+		uSecond := complex(h/2, 0)*u + complex(r2/2, 0)*cmplx.Conj(u)*p
+		velocity := 2 * u * uPrime / complex(r2, 0)
+		hPrime := r2 * (real(velocity)*real(p) + imag(velocity)*imag(p))
+		return uPrime, uSecond, hPrime, r2
+	}
+
+	for i := 0; i < 1000000 && dt-t > 1e-12*dt; i++ {
+		step := math.Min(ds, (dt-t)/real(u*cmplx.Conj(u)))
+		half := complex(step/2, 0)
+		full := complex(step, 0)
+
+		k1u, k1p, k1h, k1t := derivative(u, uPrime, h)
+		k2u, k2p, k2h, k2t := derivative(u+half*k1u, uPrime+half*k1p, h+step/2*k1h)
+		k3u, k3p, k3h, k3t := derivative(u+half*k2u, uPrime+half*k2p, h+step/2*k2h)
+		k4u, k4p, k4h, k4t := derivative(u+full*k3u, uPrime+full*k3p, h+step*k3h)
+
+		u += full / 6 * (k1u + 2*k2u + 2*k3u + k4u)
+		uPrime += full / 6 * (k1p + 2*k2p + 2*k3p + k4p)
+		h += step / 6 * (k1h + 2*k2h + 2*k3h + k4h)
+		t += step / 6 * (k1t + 2*k2t + 2*k3t + k4t)
+	}
+
+	z = u * u
+	zDot = 2 * u * uPrime / complex(real(u*cmplx.Conj(u)), 0)
+	// Absorb any overshoot in physical time
+	z += zDot * complex(dt-t, 0)
+
+	return Vector2{X: real(z), Y: imag(z)}, Vector2{X: real(zDot), Y: imag(zDot)}
+}
+
+// Update splits binaries that have widened or become unbound and
+// regularizes new bound pairs, using root built from the current positions.
+// It reports whether the set of binaries changed, in which case the tree
+// must be rebuilt.
+func (reg *Regularizer) Update(root *QuadNode, bodies *Bodies, params *Params) bool {
+	changed := false
+
+	present := make(map[*Body]bool, len(bodies.NodeBodies))
+	for _, body := range bodies.NodeBodies {
+		present[body] = true
+	}
+
+	kept := reg.binaries[:0]
+	for _, binary := range reg.binaries {
+		r := params.Separation(binary.Primary.Positions, binary.Secondary.Positions)
+		v := binary.Primary.Velocities.Subtract(binary.Secondary.Velocities)
+		energy := 0.5*v.Dot(v) - params.G*binary.Center.Mass/r.Magnitude()
+		if !present[binary.Primary] || !present[binary.Secondary] || r.Magnitude() > 2*reg.Radius || energy > 0 {
+			delete(reg.members, binary.Primary)
+			delete(reg.members, binary.Secondary)
+			delete(reg.members, binary.Center)
+			changed = true
+			continue
+		}
+		kept = append(kept, binary)
+	}
+	reg.binaries = kept
+
+	for _, body := range bodies.NodeBodies {
+		if reg.InBinary(body) {
+			continue
+		}
+		partner := reg.boundPartner(body, root, params)
+		if partner == nil || reg.InBinary(partner) || reg.boundPartner(partner, root, params) != body {
+			continue
+		}
+		reg.pair(body, partner, params)
+		changed = true
+	}
+
+	return changed
+}
+
+// boundPartner returns the nearest body within Radius that is bound to body,
+// or nil.
+func (reg *Regularizer) boundPartner(body *Body, root *QuadNode, params *Params) *Body {
+	var partner *Body
+	nearest := math.Inf(1)
+	for _, other := range root.Within(body.Positions, reg.Radius, params) {
+		if other == body || reg.InBinary(other) {
+			continue
+		}
+		r := params.Separation(body.Positions, other.Positions)
+		v := body.Velocities.Subtract(other.Velocities)
+		distance := r.Magnitude()
+		if 0.5*v.Dot(v)-params.G*(body.Mass+other.Mass)/distance < 0 && distance < nearest {
+			partner, nearest = other, distance
+		}
+	}
+	return partner
+}
+
+func (reg *Regularizer) pair(primary *Body, secondary *Body, params *Params) {
+	mass := primary.Mass + secondary.Mass
+	r := params.Separation(primary.Positions, secondary.Positions)
+	center := &Body{
+		Name:       primary.Name + "+" + secondary.Name,
+		Positions:  secondary.Positions.Add(r.Multiply(primary.Mass / mass)),
+		Velocities: primary.Velocities.Multiply(primary.Mass / mass).Add(secondary.Velocities.Multiply(secondary.Mass / mass)),
+		Mass:       mass,
+		Charge:     primary.Charge + secondary.Charge,
+	}
+	if params.Box != nil {
+		center.Positions = params.Box.Wrap(center.Positions)
+	}
+
+	binary := &Binary{Primary: primary, Secondary: secondary, Center: center}
+	reg.binaries = append(reg.binaries, binary)
+	reg.members[primary] = binary
+	reg.members[secondary] = binary
+	reg.members[center] = binary
+}
+
+func bodySource(body *Body) Source {
+	return Source{Mass: body.Mass, Charge: body.Charge}
+}
+
+// forceAt returns the force on a point source at position from every body in
+// the tree except exclude, with the usual opening criterion.
+func (node *QuadNode) forceAt(position Vector2, source Source, exclude *Body, params *Params) Vector2 {
+	var force Vector2
+	for _, child := range node.Children {
+		if child == nil || child.TotalMass <= 0 {
+			continue
+		}
+		leaf := len(child.BodiesPtr.NodeBodies) == 1
+		if leaf && child.BodiesPtr.NodeBodies[0] == exclude {
+			continue
+		}
+
+		distance := params.Separation(position, child.Center)
+		if params.Force.Accept(node.NodeSize(), distance.Magnitude(), params.Theta) || leaf {
+			force = force.Add(params.Force.Force(distance, source, nodeSource(child)))
+		} else {
+			force = force.Add(child.forceAt(position, source, exclude, params))
+		}
+	}
+	return force
+}
@@ -0,0 +1,12 @@
+package utils
+
+// OutputSink receives the bodies of the frames of a run, along with the
+// simulated time each frame ends at, which is the sum of the steps so far
+// since dt can change during a run. Sinks may keep the bodies only until
+// WriteFrame returns; the engine goes on to change them. The sink package
+// has the implementations.
+type OutputSink interface {
+	WriteFrame(frame int, time float64, bodies []*Body) error
+	Flush() error
+	Close() error
+}
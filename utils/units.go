@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	astronomicalUnit = 1.495978707e11        // metres
+	kiloparsec       = 3.0856775814913673e19 // metres
+	solarMass        = 1.98847e30            // kilograms
+	julianYear       = 365.25 * 24 * 60 * 60 // seconds
+	gigayear         = 1e9 * julianYear      // seconds
+)
+
+// UnitSystem gives the size of the length, mass and time units in SI. The
+// Henon system (G = M = 1, E = -1/4) has no fixed size; it is only known once
+// derived from a set of bodies, and has zero scales until then.
+type UnitSystem struct {
+	Name   string
+	Length float64 // metres
+	Mass   float64 // kilograms
+	Time   float64 // seconds
+}
+
+var SI = UnitSystem{Name: "si", Length: 1, Mass: 1, Time: 1}
+
+var unitSystems = map[string]UnitSystem{
+	"si":    SI,
+	"au":    {Name: "au", Length: astronomicalUnit, Mass: solarMass, Time: julianYear},
+	"kpc":   {Name: "kpc", Length: kiloparsec, Mass: solarMass, Time: gigayear},
+	"henon": {Name: "henon"},
+}
+
+// LookupUnits returns the named unit system: si, au (AU, solar mass, year),
+// kpc (kiloparsec, solar mass, gigayear) or henon.
+func LookupUnits(name string) (UnitSystem, error) {
+	units, ok := unitSystems[name]
+	if !ok {
+		return UnitSystem{}, fmt.Errorf("unknown unit system %q (want si, au, kpc or henon)", name)
+	}
+	return units, nil
+}
+
+// Scaled reports whether the size of the units is known.
+func (units UnitSystem) Scaled() bool {
+	return units.Length > 0 && units.Mass > 0 && units.Time > 0
+}
+
+// G returns the gravitational constant in this unit system.
+func (units UnitSystem) G() float64 {
+	if !units.Scaled() {
+		return 1 // Henon units
+	}
+	return G * units.Mass * units.Time * units.Time / (units.Length * units.Length * units.Length)
+}
+
+// HenonUnits returns the Henon unit system of bodies measured in units: the
+// total mass is 1 and the virial radius G M^2 / (2 |W|) is 1, with G = 1.
+func HenonUnits(bodies *Bodies, units UnitSystem) (UnitSystem, error) {
+	if !units.Scaled() {
+		return unitSystems["henon"], nil
+	}
+
+	mass, potential := 0.0, 0.0
+	for i, body := range bodies.NodeBodies {
+		mass += body.Mass * units.Mass
+		for _, other := range bodies.NodeBodies[i+1:] {
+			distance := body.Positions.Subtract(other.Positions).Magnitude() * units.Length
+			potential -= G * body.Mass * other.Mass * units.Mass * units.Mass / distance
+		}
+	}
+	if mass == 0 || potential == 0 {
+		return UnitSystem{}, fmt.Errorf("henon units need at least two bodies with mass")
+	}
+
+	length := G * mass * mass / (2 * math.Abs(potential))
+	return UnitSystem{
+		Name:   "henon",
+		Length: length,
+		Mass:   mass,
+		Time:   math.Sqrt(length * length * length / (G * mass)),
+	}, nil
+}
+
+// Conversion holds the factors that take quantities from one unit system to another.
+type Conversion struct {
+	Length   float64
+	Velocity float64
+	Force    float64
+	Time     float64
+	Mass     float64
+}
+
+var Identity = Conversion{Length: 1, Velocity: 1, Force: 1, Time: 1, Mass: 1}
+
+func NewConversion(from UnitSystem, to UnitSystem) (Conversion, error) {
+	if from == to {
+		return Identity, nil
+	}
+	if !from.Scaled() || !to.Scaled() {
+		return Conversion{}, fmt.Errorf("cannot convert from %s to %s units without a physical scale", from.Name, to.Name)
+	}
+	length := from.Length / to.Length
+	time := from.Time / to.Time
+	mass := from.Mass / to.Mass
+	return Conversion{
+		Length:   length,
+		Velocity: length / time,
+		Force:    mass * length / (time * time),
+		Time:     time,
+		Mass:     mass,
+	}, nil
+}
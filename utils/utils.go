@@ -1,12 +1,7 @@
 package utils
 
 import (
-	"encoding/csv"
-	"fmt"
-	"io"
 	"math"
-	"os"
-	"strconv"
 )
 
 const G = 6.67430e-11 // Gravitational constant
@@ -16,7 +11,11 @@ type Body struct {
 	Positions  Vector2 // [x, y]
 	Velocities Vector2
 	Mass       float64
+	Charge     float64
 	Force      Vector2
+	Jerk       Vector2 // Time derivative of Force, computed for the Hermite integrator
+
+	hermite *hermiteState
 }
 
 type Bodies struct {
@@ -24,11 +23,20 @@ type Bodies struct {
 }
 
 type QuadNode struct {
-	Center    Vector2
-	TotalMass float64
-	Region    [2]Vector2   // min and max values for all 3 dimensions (x, y, and z).
-	Children  [4]*QuadNode // up to 4 octonode children per node. Consider a 2x2x2 cube.
-	BodiesPtr *Bodies
+	Center      Vector2
+	TotalMass   float64
+	TotalCharge float64
+	Velocity    Vector2      // Mass-weighted mean velocity, for the jerk
+	ChargeSum   Vector2      // Sum of charge times position, for the charge dipole
+	Region      [2]Vector2   // min and max values for all 3 dimensions (x, y, and z).
+	Children    [4]*QuadNode // up to 4 octonode children per node. Consider a 2x2x2 cube.
+	BodiesPtr   *Bodies
+}
+
+// Dipole returns the charge dipole moment of the node about its centre of
+// mass. It carries the field of nodes whose net charge cancels.
+func (node *QuadNode) Dipole() Vector2 {
+	return node.ChargeSum.Subtract(node.Center.Multiply(node.TotalCharge))
 }
 
 func (node *QuadNode) IsLeaf() bool {
@@ -40,64 +48,18 @@ func (node *QuadNode) IsLeaf() bool {
 	return true
 }
 
-// Fixed function to read bodies from CSV
-func ReadInput(filename string) (Bodies, float64, float64) {
-	file, err := os.Open(filename)
-	if err != nil {
-		panic(err)
+// Leaves returns every node below this one that holds a body.
+func (node *QuadNode) Leaves() []*QuadNode {
+	if node.BodiesPtr != nil && len(node.BodiesPtr.NodeBodies) > 0 {
+		return []*QuadNode{node}
 	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	reader.Comma = ',' // Correct delimiter for CSV files
-	reader.TrimLeadingSpace = true
-
-	var bodies Bodies
-	var SimulationTimeInSeconds float64
-	var GravitationalConstant float64
-
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break // Exit the loop at end of file
-		}
-		if err != nil {
-			fmt.Printf("Error reading input: %s\n", err)
-			continue
-		}
-
-		if record[0] == "SimulationTime" {
-			if len(record) >= 4 { // Check for at least 4 fields
-				if simTime, err := strconv.ParseFloat(record[1], 64); err == nil {
-					SimulationTimeInSeconds = simTime
-				}
-				if gravConst, err := strconv.ParseFloat(record[3], 64); err == nil {
-					GravitationalConstant = gravConst
-				}
-			}
-			continue
-		} else {
-			var body Body
-			body.Name = record[0]
-			if xPosition, err := strconv.ParseFloat(record[1], 32); err == nil {
-				body.Positions.X = float64(xPosition)
-			}
-			if yPosition, err := strconv.ParseFloat(record[2], 32); err == nil {
-				body.Positions.Y = float64(yPosition)
-			}
-			if xVelocity, err := strconv.ParseFloat(record[3], 32); err == nil {
-				body.Velocities.X = float64(xVelocity)
-			}
-			if yVelocity, err := strconv.ParseFloat(record[4], 32); err == nil {
-				body.Velocities.Y = float64(yVelocity)
-			}
-			if mass, err := strconv.ParseFloat(record[5], 32); err == nil {
-				body.Mass = float64(mass)
-			}
-			bodies.NodeBodies = append(bodies.NodeBodies, &body)
+	var leaves []*QuadNode
+	for _, child := range node.Children {
+		if child != nil {
+			leaves = append(leaves, child.Leaves()...)
 		}
 	}
-	return bodies, SimulationTimeInSeconds, GravitationalConstant
+	return leaves
 }
 
 type Vector2 struct {
@@ -131,7 +93,10 @@ func (v Vector2) Multiply(scalar float64) Vector2 {
 	return Vector2{v.X * scalar, v.Y * scalar}
 }
 
-func updateForce(curNode *QuadNode, node *QuadNode, theta float64, dt float64) {
+// updateForce adds the force of the cells below node to the body of curNode.
+// An accepted cell acts as its total mass and net charge at its centre of
+// mass, plus its charge dipole about that point.
+func updateForce(curNode *QuadNode, node *QuadNode, params *Params) {
 
 	if node == nil { // base case
 		return
@@ -144,23 +109,31 @@ func updateForce(curNode *QuadNode, node *QuadNode, theta float64, dt float64) {
 	for _, child := range node.Children {
 		if child != nil && child.TotalMass > 0 && curNode != child { // Ensure the child is not nil before recursing
 
-			distance := curNode.Center.Subtract(child.Center)
+			distance := params.Separation(curNode.Center, child.Center)
 			magnitude := distance.Magnitude()
 			s := node.NodeSize()
-			if s/magnitude < theta || len(child.BodiesPtr.NodeBodies) == 1 {
-				newForce := calculateGravitationalForce(*curNode, *child)
+			if params.Force.Accept(s, magnitude, params.Theta) || len(child.BodiesPtr.NodeBodies) == 1 {
+				newForce := calculateForce(*curNode, *child, params)
 				curNode.BodiesPtr.NodeBodies[0].Force = curNode.BodiesPtr.NodeBodies[0].Force.Add(newForce)
+				if law := params.jerkLaw(); law != nil {
+					newJerk := law.Jerk(distance, curNode.Velocity.Subtract(child.Velocity), nodeSource(curNode), nodeSource(child))
+					curNode.BodiesPtr.NodeBodies[0].Jerk = curNode.BodiesPtr.NodeBodies[0].Jerk.Add(newJerk)
+				}
 				continue
 			} else {
-				updateForce(curNode, child, theta, dt)
+				updateForce(curNode, child, params)
 			}
 		}
 	}
 }
 
-func (node *QuadNode) CalculateForce(root *QuadNode, theta float64, dt float64) {
+func (node *QuadNode) CalculateForce(root *QuadNode, params *Params) {
 	node.BodiesPtr.NodeBodies[0].Force = Vector2{0, 0}
-	updateForce(node, root, theta, dt)
+	node.BodiesPtr.NodeBodies[0].Jerk = Vector2{0, 0}
+	updateForce(node, root, params)
+	if params.PN != nil {
+		addPostNewtonian(node, root, params)
+	}
 }
 
 func (node *QuadNode) NodeSize() float64 {
@@ -179,23 +152,32 @@ func calculateDistance(pos1 [3]float64, pos2 [3]float64) float64 {
 
 }
 
-func calculateGravitationalForce(node1 QuadNode, node2 QuadNode) Vector2 {
-	r := node1.Center.Subtract(node2.Center)                                         // vector from body1 to body2
-	distance := r.Magnitude()                                                        // scalar distance between bodies
-	forceMagnitude := -G * node1.TotalMass * node2.TotalMass / (distance * distance) // magnitude of the gravitational force
-	forceDirection := r.Normalize()                                                  // unit vector in the direction of the force
-	return forceDirection.Multiply(forceMagnitude)                                   // vector representation of the force
+func calculateForce(node1 QuadNode, node2 QuadNode, params *Params) Vector2 {
+	r := params.Separation(node1.Center, node2.Center) // vector from body2 to body1 (nearest image if periodic)
+	force := params.Force.Force(r, nodeSource(&node1), nodeSource(&node2))
+
+	// Add the pull of every other periodic image of node2
+	if params.Box != nil && params.Box.Ewald {
+		correction := params.Box.EwaldCorrection(r)
+		force = force.Add(correction.Multiply(params.G * node1.TotalMass * node2.TotalMass))
+	}
+	return force
 }
 
 // Assuming Vector2 and Body are already defined with basic methods
 
-func (body *Body) Update(dt float64) {
+func (body *Body) Update(params *Params) {
+	dt := params.Dt
 	// Leapfrog Integration: update velocities at full step using accumulated force
 	acceleration := body.Force.Multiply(1 / body.Mass)
 	body.Velocities = body.Velocities.Add(acceleration.Multiply(dt))
 	// Update position using new velocities
 	changePos := body.Velocities.Multiply(dt)
 	body.Positions = body.Positions.Add(changePos)
+	// Bodies leaving a periodic box re-enter on the opposite side
+	if params.Box != nil {
+		body.Positions = params.Box.Wrap(body.Positions)
+	}
 }
 
 func Pop(n *[]*QuadNode) (*QuadNode, *[]*QuadNode) {
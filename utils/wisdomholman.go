@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"math"
+)
+
+// WisdomHolman is the Wisdom-Holman map in democratic heliocentric
+// coordinates, for systems dominated by one heavy body. Each frame the
+// planets get a kick from the planet-planet forces (computed by the tree,
+// which leaves the central body out), then drift along Kepler orbits around
+// the central body, with half a "jump" from the barycentric momentum either side.
+//
+// During a frame the planets hold heliocentric positions and barycentric
+// velocities; End restores inertial coordinates for output and the next tree.
+type WisdomHolman struct {
+	Central *Body // Dominant body, the heaviest one unless set beforehand
+
+	centerPosition Vector2 // Barycentre of the whole system
+	centerVelocity Vector2
+}
+
+func (wh *WisdomHolman) Init(bodies *Bodies, params *Params) {
+	if wh.Central == nil {
+		for _, body := range bodies.NodeBodies {
+			if wh.Central == nil || body.Mass > wh.Central.Mass {
+				wh.Central = body
+			}
+		}
+	}
+	if wh.Central != nil {
+		wh.Central.Force = Vector2{}
+	}
+}
+
+func (wh *WisdomHolman) InTree(body *Body) bool {
+	return body != wh.Central
+}
+
+func (wh *WisdomHolman) Begin(bodies *Bodies, params *Params) {
+	wh.centerPosition, wh.centerVelocity = bodies.CenterOfMass()
+	origin := wh.Central.Positions
+
+	for _, body := range bodies.NodeBodies {
+		if body == wh.Central {
+			continue
+		}
+		// Democratic heliocentric coordinates, then the interaction kick
+		body.Positions = body.Positions.Subtract(origin)
+		body.Velocities = body.Velocities.Subtract(wh.centerVelocity)
+		body.Velocities = body.Velocities.Add(body.Force.Multiply(params.Dt / body.Mass))
+	}
+
+	wh.jump(bodies, params.Dt/2)
+}
+
+// Step drifts one planet along its Kepler orbit around the central body.
+func (wh *WisdomHolman) Step(body *Body, params *Params) {
+	if body == wh.Central {
+		return
+	}
+	body.Positions, body.Velocities = KeplerDrift(body.Positions, body.Velocities, params.G*wh.Central.Mass, params.Dt)
+}
+
+func (wh *WisdomHolman) End(bodies *Bodies, params *Params) {
+	wh.jump(bodies, params.Dt/2)
+
+	// Back to inertial coordinates; the barycentre moves uniformly
+	totalMass := 0.0
+	var weightedPosition, momentum Vector2
+	for _, body := range bodies.NodeBodies {
+		totalMass += body.Mass
+		if body == wh.Central {
+			continue
+		}
+		weightedPosition = weightedPosition.Add(body.Positions.Multiply(body.Mass))
+		momentum = momentum.Add(body.Velocities.Multiply(body.Mass))
+	}
+
+	center := wh.centerPosition.Add(wh.centerVelocity.Multiply(params.Dt))
+	origin := center.Subtract(weightedPosition.Multiply(1 / totalMass))
+	for _, body := range bodies.NodeBodies {
+		if body == wh.Central {
+			continue
+		}
+		body.Positions = body.Positions.Add(origin)
+		body.Velocities = body.Velocities.Add(wh.centerVelocity)
+	}
+	wh.Central.Positions = origin
+	wh.Central.Velocities = wh.centerVelocity.Subtract(momentum.Multiply(1 / wh.Central.Mass))
+}
+
+// jump moves every planet by the barycentric momentum of all the planets
+// divided by the central mass.
+func (wh *WisdomHolman) jump(bodies *Bodies, dt float64) {
+	var momentum Vector2
+	for _, body := range bodies.NodeBodies {
+		if body != wh.Central {
+			momentum = momentum.Add(body.Velocities.Multiply(body.Mass))
+		}
+	}
+	shift := momentum.Multiply(dt / wh.Central.Mass)
+	for _, body := range bodies.NodeBodies {
+		if body != wh.Central {
+			body.Positions = body.Positions.Add(shift)
+		}
+	}
+}
+
+// KeplerDrift advances a Kepler orbit with gravitational parameter mu by dt
+// using universal variables, which handle elliptic, parabolic and hyperbolic
+// orbits alike.
+func KeplerDrift(position Vector2, velocity Vector2, mu float64, dt float64) (Vector2, Vector2) {
+	r0 := position.Magnitude()
+	if r0 == 0 || mu == 0 || dt == 0 {
+		return position.Add(velocity.Multiply(dt)), velocity
+	}
+	eta0 := position.Dot(velocity)
+	beta := 2*mu/r0 - velocity.Dot(velocity)
+
+	// Solve r0 G1 + eta0 G2 + mu G3 = dt for s with the Laguerre-Conway method
+	s := dt / r0
+	var g0, g1, g2, g3 float64
+	for i := 0; i < 50; i++ {
+		g0, g1, g2, g3 = stumpffG(beta, s)
+		f := r0*g1 + eta0*g2 + mu*g3 - dt
+		df := r0*g0 + eta0*g1 + mu*g2
+		ddf := eta0*g0 + (mu-beta*r0)*g1
+
+		const n = 5.0
+		root := math.Sqrt(math.Abs((n-1)*(n-1)*df*df - n*(n-1)*f*ddf))
+		denominator := df + math.Copysign(root, df)
+		if denominator == 0 {
+			break
+		}
+		step := n * f / denominator
+		s -= step
+		if math.Abs(step) <= 1e-15*math.Abs(s) {
+			break
+		}
+	}
+	g0, g1, g2, g3 = stumpffG(beta, s)
+
+	r := r0*g0 + eta0*g1 + mu*g2
+	f := 1 - mu*g2/r0
+	g := dt - mu*g3
+	fDot := -mu * g1 / (r * r0)
+	gDot := 1 - mu*g2/r
+
+	return position.Multiply(f).Add(velocity.Multiply(g)),
+		position.Multiply(fDot).Add(velocity.Multiply(gDot))
+}
+
+// stumpffG returns the universal-variable functions G_k(beta, s) = s^k c_k(beta s^2), k = 0..3.
+func stumpffG(beta float64, s float64) (float64, float64, float64, float64) {
+	z := beta * s * s
+	var c0, c1, c2, c3 float64
+	switch {
+	case math.Abs(z) < 1e-4:
+		// Series, to avoid cancellation near z = 0
+		c0 = 1 - z/2 + z*z/24
+		c1 = 1 - z/6 + z*z/120
+		c2 = 0.5 - z/24 + z*z/720
+		c3 = 1.0/6 - z/120 + z*z/5040
+	case z > 0:
+		root := math.Sqrt(z)
+		c0 = math.Cos(root)
+		c1 = math.Sin(root) / root
+		c2 = (1 - c0) / z
+		c3 = (1 - c1) / z
+	default:
+		root := math.Sqrt(-z)
+		c0 = math.Cosh(root)
+		c1 = math.Sinh(root) / root
+		c2 = (1 - c0) / z
+		c3 = (1 - c1) / z
+	}
+	return c0, s * c1, s * s * c2, s * s * s * c3
+}
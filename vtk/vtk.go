@@ -0,0 +1,96 @@
+// This package writes the pieces of VTK XML files that the body and tree
+// exports share: ASCII data arrays and the ParaView .pvd collection that
+// indexes the files of a run by simulated time.
+
+package vtk
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	collectionHeader = `<?xml version="1.0"?>` + "\n" +
+		`<VTKFile type="Collection" version="0.1" byte_order="LittleEndian">` + "\n" +
+		"  <Collection>\n"
+	collectionFooter = "  </Collection>\n</VTKFile>\n"
+)
+
+// Collection is a .pvd file listing one data file per frame. The data files
+// go to a directory named after it. The collection is rewritten in place as
+// frames are added, so it stays valid while the run goes on.
+type Collection struct {
+	file      *os.File
+	footer    int64 // Offset of the closing tags
+	directory string
+	base      string
+}
+
+// CreateCollection creates the .pvd file and the directory of its frames.
+func CreateCollection(filename string) (*Collection, error) {
+	directory := strings.TrimSuffix(filename, filepath.Ext(filename))
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.WriteString(collectionHeader + collectionFooter); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &Collection{
+		file:      file,
+		footer:    int64(len(collectionHeader)),
+		directory: directory,
+		base:      filepath.Base(directory),
+	}, nil
+}
+
+// Path returns the name of the data file of a frame, such as
+// run/run_000100.vtp.
+func (collection *Collection) Path(frame int) string {
+	return filepath.Join(collection.directory, fmt.Sprintf("%s_%06d.vtp", collection.base, frame))
+}
+
+// Add lists the data file of a frame at the given time.
+func (collection *Collection) Add(time float64, path string) error {
+	// Paths in the collection are relative to it
+	relative := filepath.ToSlash(filepath.Join(collection.base, filepath.Base(path)))
+	entry := fmt.Sprintf("    <DataSet timestep=\"%s\" group=\"\" part=\"0\" file=\"%s\"/>\n",
+		strconv.FormatFloat(time, 'g', -1, 64), relative)
+	if _, err := collection.file.WriteAt([]byte(entry+collectionFooter), collection.footer); err != nil {
+		return err
+	}
+	collection.footer += int64(len(entry))
+	return nil
+}
+
+func (collection *Collection) Close() error {
+	return collection.file.Close()
+}
+
+// WriteArray writes an ASCII DataArray of kind Int64 or Float64, with
+// components values per tuple.
+func WriteArray(out io.Writer, kind string, name string, components int, values []float64) {
+	fmt.Fprintf(out, "        <DataArray type=\"%s\" Name=\"%s\" NumberOfComponents=\"%d\" format=\"ascii\">\n", kind, name, components)
+	buffer := make([]byte, 0, 64)
+	for i := 0; i < len(values); i += components {
+		buffer = buffer[:0]
+		for _, value := range values[i : i+components] {
+			buffer = append(buffer, ' ')
+			if kind == "Int64" {
+				buffer = strconv.AppendInt(buffer, int64(value), 10)
+			} else {
+				buffer = strconv.AppendFloat(buffer, value, 'g', -1, 64)
+			}
+		}
+		out.Write(buffer)
+	}
+	fmt.Fprintf(out, "\n        </DataArray>\n")
+}
@@ -0,0 +1,68 @@
+package watch
+
+import "strings"
+
+// Canvas is a grid of dots, two wide and four high per character cell, that
+// counts how many bodies fall on each dot.
+type Canvas struct {
+	Columns int // Size in character cells
+	Rows    int
+	dots    []int
+}
+
+func NewCanvas(columns int, rows int) *Canvas {
+	return &Canvas{Columns: columns, Rows: rows, dots: make([]int, columns*2*rows*4)}
+}
+
+// Width and Height give the size in dots.
+func (canvas *Canvas) Width() int  { return canvas.Columns * 2 }
+func (canvas *Canvas) Height() int { return canvas.Rows * 4 }
+
+// Plot adds a body at dot (x, y), from the top left. Dots off the canvas are
+// ignored.
+func (canvas *Canvas) Plot(x int, y int) {
+	if x >= 0 && y >= 0 && x < canvas.Width() && y < canvas.Height() {
+		canvas.dots[y*canvas.Width()+x]++
+	}
+}
+
+// Bits of each dot of a braille cell, by column and row.
+var brailleBits = [2][4]rune{{0x01, 0x02, 0x04, 0x40}, {0x08, 0x10, 0x20, 0x80}}
+
+// Lines returns the canvas as text, one string per row, with spaces for
+// empty cells. Braille shows every dot; ASCII shows how many bodies each
+// cell holds: . for one, : for two, o for up to four and @ for more.
+func (canvas *Canvas) Lines(ascii bool) []string {
+	lines := make([]string, canvas.Rows)
+	var line strings.Builder
+	for row := 0; row < canvas.Rows; row++ {
+		line.Reset()
+		for column := 0; column < canvas.Columns; column++ {
+			pattern, count := rune(0), 0
+			for dx := 0; dx < 2; dx++ {
+				for dy := 0; dy < 4; dy++ {
+					if n := canvas.dots[(row*4+dy)*canvas.Width()+column*2+dx]; n > 0 {
+						pattern |= brailleBits[dx][dy]
+						count += n
+					}
+				}
+			}
+			switch {
+			case !ascii && count > 0:
+				line.WriteRune(0x2800 + pattern)
+			case count == 0:
+				line.WriteByte(' ')
+			case count == 1:
+				line.WriteByte('.')
+			case count == 2:
+				line.WriteByte(':')
+			case count <= 4:
+				line.WriteByte('o')
+			default:
+				line.WriteByte('@')
+			}
+		}
+		lines[row] = line.String()
+	}
+	return lines
+}
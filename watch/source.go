@@ -0,0 +1,326 @@
+// This package shows a run in the terminal: the body positions of a frame
+// are drawn as a scatter plot of Unicode braille dots, two by four to a
+// character, or in plain ASCII. It follows the results files of the engines
+// as they are written, so a run on a headless machine can be watched over
+// SSH while it goes on.
+
+package watch
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"proj3-redesigned/compression"
+	"proj3-redesigned/snapshot"
+	"proj3-redesigned/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// poll is how often a source checks for new data at the end of its file.
+const poll = 100 * time.Millisecond
+
+var (
+	errTruncated = errors.New("file truncated")
+	errStopped   = errors.New("source closed")
+)
+
+// Frame is the positions of the bodies in one frame.
+type Frame struct {
+	Number    int
+	Positions []utils.Vector2
+}
+
+// Source holds the frames of one results file, read on its own goroutine.
+// Uncompressed CSV and JSON Lines files are followed as they grow, like
+// tail -f; a file that is rewritten by a new run starts over. Other files
+// are read once. Frames are numbered from 0 in the order they were read;
+// past the history limit the oldest are dropped.
+type Source struct {
+	Filename string
+
+	mutex   sync.Mutex
+	frames  []Frame
+	first   int   // Index of frames[0]
+	pending Frame // CSV rows of a frame that may not be complete yet
+	columns []int // Columns of PosX and PosY in a followed CSV file
+	limit   int
+	waiting bool // The file does not exist yet
+	done    bool // The file has been read to its end and is not followed
+	err     error
+	stop    chan struct{}
+}
+
+// Open starts reading filename, keeping at most limit frames.
+func Open(filename string, limit int) *Source {
+	source := &Source{Filename: filename, limit: limit, waiting: true, stop: make(chan struct{})}
+	go source.read()
+	return source
+}
+
+// Close stops reading.
+func (source *Source) Close() {
+	close(source.stop)
+}
+
+// Range returns the indices of the first frame held and one past the last.
+func (source *Source) Range() (int, int) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	return source.first, source.first + len(source.frames)
+}
+
+// Frame returns the frame at index i, if it is still held.
+func (source *Source) Frame(i int) (Frame, bool) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	if i < source.first || i >= source.first+len(source.frames) {
+		return Frame{}, false
+	}
+	return source.frames[i-source.first], true
+}
+
+// Find returns the index of the frame with the given number, or of the
+// nearest frame held after it.
+func (source *Source) Find(number int) int {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	for i, frame := range source.frames {
+		if frame.Number >= number {
+			return source.first + i
+		}
+	}
+	return source.first + len(source.frames) - 1
+}
+
+// Status reports whether the source is waiting for its file to appear,
+// whether it has read all of a file it does not follow, and any error.
+func (source *Source) Status() (waiting bool, done bool, err error) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	return source.waiting, source.done, source.err
+}
+
+func (source *Source) read() {
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(compression.Strip(source.Filename))), ".")
+	follow := compression.Extension(source.Filename) == "" && (format == "csv" || format == "jsonl")
+	for {
+		if !source.wait() {
+			return
+		}
+		var err error
+		if follow {
+			err = source.follow(format)
+		} else {
+			err = snapshot.Scan(source.Filename, source.add)
+		}
+		if errors.Is(err, errStopped) {
+			return
+		}
+		if errors.Is(err, errTruncated) {
+			source.reset()
+			continue
+		}
+
+		source.mutex.Lock()
+		source.done, source.err = true, err
+		source.mutex.Unlock()
+		return
+	}
+}
+
+// wait polls until the file exists, reporting false if the source is closed first.
+func (source *Source) wait() bool {
+	for {
+		if _, err := os.Stat(source.Filename); err == nil {
+			source.mutex.Lock()
+			source.waiting = false
+			source.mutex.Unlock()
+			return true
+		}
+		select {
+		case <-source.stop:
+			return false
+		case <-time.After(poll):
+		}
+	}
+}
+
+// follow reads the file line by line as it grows. A CSV frame is complete
+// once the next one starts, or once the file stops growing after it.
+func (source *Source) follow(format string) error {
+	file, err := os.Open(source.Filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var offset int64
+	var partial []byte
+	buffer := make([]byte, 64*1024)
+	for line := 0; ; {
+		n, err := file.Read(buffer)
+		offset += int64(n)
+		if n > 0 {
+			partial = append(partial, buffer[:n]...)
+			for {
+				end := bytes.IndexByte(partial, '\n')
+				if end < 0 {
+					break
+				}
+				if err := source.line(format, line, partial[:end]); err != nil {
+					return fmt.Errorf("%s: line %d: %w", source.Filename, line+1, err)
+				}
+				partial = partial[end+1:]
+				line++
+			}
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		// At the end of the file, waiting for the engine to write more
+		if len(partial) == 0 {
+			source.commit()
+		}
+		current, errCurrent := os.Stat(source.Filename)
+		opened, errOpened := file.Stat()
+		if errCurrent == nil && errOpened == nil && (!os.SameFile(current, opened) || current.Size() < offset) {
+			return errTruncated // A new run rewrote the file
+		}
+		select {
+		case <-source.stop:
+			return errStopped
+		case <-time.After(poll):
+		}
+	}
+}
+
+// line takes in one line of a followed file.
+func (source *Source) line(format string, number int, text []byte) error {
+	if format == "jsonl" {
+		return snapshot.ScanReader(bytes.NewReader(text), "jsonl", source.add)
+	}
+	reader := csv.NewReader(bytes.NewReader(text))
+	reader.FieldsPerRecord = -1
+	fields, err := reader.Read()
+	if err == io.EOF {
+		return nil // Blank line
+	}
+	if err != nil {
+		return err
+	}
+	if number == 0 {
+		if len(fields) < 2 || fields[0] != "Frame" || fields[1] != "Body Name" {
+			return errors.New("not a results file: the header does not start with Frame,Body Name")
+		}
+		source.columns = snapshot.Columns(snapshot.Header{Columns: fields[2:]}, "PosX", "PosY")
+		if source.columns[0] < 0 || source.columns[1] < 0 {
+			return errors.New("the results have no PosX and PosY columns")
+		}
+		return nil
+	}
+
+	frame, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return fmt.Errorf("bad frame number %q", fields[0])
+	}
+	if 2+source.columns[0] >= len(fields) || 2+source.columns[1] >= len(fields) {
+		return errors.New("short row")
+	}
+	x, errX := strconv.ParseFloat(fields[2+source.columns[0]], 64)
+	y, errY := strconv.ParseFloat(fields[2+source.columns[1]], 64)
+	if errX != nil || errY != nil {
+		return errors.New("bad position")
+	}
+	position := utils.Vector2{X: x, Y: y}
+
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	if source.pending.Positions != nil && frame != source.pending.Number {
+		source.keep(source.pending)
+		source.pending = Frame{}
+	}
+	if source.pending.Positions == nil && len(source.frames) > 0 && source.frames[len(source.frames)-1].Number == frame {
+		// The rest of a frame committed while the engine was writing it
+		last := &source.frames[len(source.frames)-1]
+		if finite(position) {
+			last.Positions = append(last.Positions, position)
+		}
+		return nil
+	}
+	source.pending.Number = frame
+	if finite(position) {
+		source.pending.Positions = append(source.pending.Positions, position)
+	} else if source.pending.Positions == nil {
+		source.pending.Positions = []utils.Vector2{}
+	}
+	return nil
+}
+
+// commit keeps the pending CSV frame, when the file has stopped growing.
+func (source *Source) commit() {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	if source.pending.Positions != nil {
+		source.keep(source.pending)
+		source.pending = Frame{}
+	}
+}
+
+// add keeps the positions of a frame.
+func (source *Source) add(header snapshot.Header, frame snapshot.Frame) error {
+	columns := snapshot.Columns(header, "PosX", "PosY")
+	if columns[0] < 0 || columns[1] < 0 {
+		return errors.New("the results have no PosX and PosY columns")
+	}
+	positions := make([]utils.Vector2, 0, len(frame.Records))
+	for _, record := range frame.Records {
+		position := utils.Vector2{X: record.Values[columns[0]], Y: record.Values[columns[1]]}
+		if finite(position) {
+			positions = append(positions, position)
+		}
+	}
+
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	source.keep(Frame{Number: frame.Number, Positions: positions})
+	select {
+	case <-source.stop:
+		return errStopped
+	default:
+		return nil
+	}
+}
+
+// keep appends a frame, dropping the oldest past the history limit. The
+// mutex must be held.
+func (source *Source) keep(frame Frame) {
+	source.frames = append(source.frames, frame)
+	if source.limit > 0 && len(source.frames) > source.limit {
+		drop := len(source.frames) - source.limit
+		source.frames = append(source.frames[:0:0], source.frames[drop:]...)
+		source.first += drop
+	}
+}
+
+func finite(position utils.Vector2) bool {
+	return !math.IsNaN(position.X) && !math.IsNaN(position.Y) && !math.IsInf(position.X, 0) && !math.IsInf(position.Y, 0)
+}
+
+// reset forgets every frame, for a file that a new run has started over.
+func (source *Source) reset() {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	source.first += len(source.frames)
+	source.frames = nil
+	source.pending = Frame{}
+}
@@ -0,0 +1,235 @@
+package watch
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"proj3-redesigned/utils"
+	"unicode/utf8"
+)
+
+// Help lists the key bindings of the viewer.
+const Help = "space pause  n/b step  +/- zoom  arrows or hjkl pan  0 reset  tab or 1-9 file  q quit"
+
+// Viewer is the state of the terminal view: which source and frame are
+// shown, and how the plot is zoomed and panned. Live, it shows the newest
+// frame of the source; paused, it stays on one frame, which the step keys
+// move.
+type Viewer struct {
+	Sources []*Source
+	ASCII   bool // Plain ASCII instead of braille
+
+	current  int
+	paused   bool
+	position int // Index of the frame shown while paused
+	zoom     float64
+	pan      utils.Vector2 // Shift of the centre, in spans of the fitted view
+}
+
+func NewViewer(sources []*Source, ascii bool) *Viewer {
+	return &Viewer{Sources: sources, ASCII: ascii, zoom: 1}
+}
+
+// Key applies a key press, reporting false when the viewer should quit.
+func (viewer *Viewer) Key(key string) bool {
+	switch key {
+	case "q", "Q", "ctrl-c":
+		return false
+	case " ":
+		viewer.paused = !viewer.paused
+		if viewer.paused {
+			viewer.position = viewer.latest()
+		}
+	case "n", ".":
+		viewer.step(1)
+	case "b", ",":
+		viewer.step(-1)
+	case "+", "=":
+		viewer.zoom *= 1.5
+	case "-", "_":
+		viewer.zoom /= 1.5
+	case "0":
+		viewer.zoom, viewer.pan = 1, utils.Vector2{}
+	case "left", "h":
+		viewer.pan.X -= 0.1 / viewer.zoom
+	case "right", "l":
+		viewer.pan.X += 0.1 / viewer.zoom
+	case "up", "k":
+		viewer.pan.Y += 0.1 / viewer.zoom
+	case "down", "j":
+		viewer.pan.Y -= 0.1 / viewer.zoom
+	case "tab":
+		viewer.show((viewer.current + 1) % len(viewer.Sources))
+	default:
+		if len(key) == 1 && key[0] >= '1' && key[0] <= '9' && int(key[0]-'1') < len(viewer.Sources) {
+			viewer.show(int(key[0] - '1'))
+		}
+	}
+	return true
+}
+
+func (viewer *Viewer) latest() int {
+	_, end := viewer.Sources[viewer.current].Range()
+	return end - 1
+}
+
+// step pauses on the newest frame, if live, then moves by delta frames.
+func (viewer *Viewer) step(delta int) {
+	if !viewer.paused {
+		viewer.paused = true
+		viewer.position = viewer.latest()
+	}
+	viewer.position += delta
+	viewer.clamp()
+}
+
+func (viewer *Viewer) clamp() {
+	first, end := viewer.Sources[viewer.current].Range()
+	if viewer.position > end-1 {
+		viewer.position = end - 1
+	}
+	if viewer.position < first {
+		viewer.position = first
+	}
+}
+
+// show switches to another source. Paused, it stays on the same frame number,
+// so the engines' outputs can be compared.
+func (viewer *Viewer) show(i int) {
+	frame, ok := viewer.Sources[viewer.current].Frame(viewer.position)
+	viewer.current = i
+	if viewer.paused {
+		if ok {
+			viewer.position = viewer.Sources[i].Find(frame.Number)
+		}
+		viewer.clamp()
+	}
+}
+
+// Render draws the view into columns by rows characters: the plot, a status
+// line and the key bindings.
+func (viewer *Viewer) Render(columns int, rows int) []string {
+	source := viewer.Sources[viewer.current]
+	if rows < 3 {
+		rows = 3
+	}
+	canvas := NewCanvas(columns, rows-2)
+
+	index := viewer.latest()
+	if viewer.paused {
+		viewer.clamp()
+		index = viewer.position
+	}
+	first, end := source.Range()
+	frame, ok := source.Frame(index)
+	if ok {
+		viewer.plot(canvas, frame.Positions)
+	}
+
+	label := fmt.Sprintf("[%d/%d] %s", viewer.current+1, len(viewer.Sources), source.Filename)
+	var status string
+	waiting, done, err := source.Status()
+	switch {
+	case err != nil:
+		status = fmt.Sprintf("%s  error: %v", label, err)
+	case waiting:
+		status = fmt.Sprintf("%s  waiting for the file", label)
+	case !ok:
+		status = fmt.Sprintf("%s  no frames yet", label)
+	default:
+		state := "live"
+		if viewer.paused {
+			state = "paused"
+		} else if done {
+			state = "end"
+		}
+		status = fmt.Sprintf("%s  frame %d (%d of %d)  bodies %d  zoom %.3g  %s",
+			label, frame.Number, index-first+1, end-first, len(frame.Positions), viewer.zoom, state)
+	}
+
+	lines := canvas.Lines(viewer.ASCII)
+	lines = append(lines, truncate(status, columns), truncate(Help, columns))
+	return lines[len(lines)-rows:]
+}
+
+// plot fits the positions to the canvas, then applies the zoom and pan. Dots
+// are about square, so both axes share one scale.
+func (viewer *Viewer) plot(canvas *Canvas, positions []utils.Vector2) {
+	if len(positions) == 0 {
+		return
+	}
+	low, high := positions[0], positions[0]
+	for _, position := range positions {
+		low = utils.Vector2{X: math.Min(low.X, position.X), Y: math.Min(low.Y, position.Y)}
+		high = utils.Vector2{X: math.Max(high.X, position.X), Y: math.Max(high.Y, position.Y)}
+	}
+	width, height := float64(canvas.Width()), float64(canvas.Height())
+	spanX, spanY := (high.X-low.X)*1.1, (high.Y-low.Y)*1.1
+	scale := math.Inf(1)
+	if spanX > 0 {
+		scale = width / spanX
+	}
+	if spanY > 0 {
+		scale = math.Min(scale, height/spanY)
+	}
+	span := math.Max(spanX, spanY)
+	if span == 0 {
+		// All bodies at one point: show a region the size of its distance from the origin
+		span = math.Max(math.Max(math.Abs(low.X), math.Abs(low.Y)), 1)
+		scale = math.Min(width, height) / span
+	}
+	scale *= viewer.zoom
+	center := low.Add(high).Multiply(0.5).Add(viewer.pan.Multiply(span))
+
+	for _, position := range positions {
+		x := width/2 + (position.X-center.X)*scale
+		y := height/2 - (position.Y-center.Y)*scale
+		if x > -1 && y > -1 && x < width && y < height {
+			canvas.Plot(int(math.Floor(x)), int(math.Floor(y)))
+		}
+	}
+}
+
+func truncate(text string, columns int) string {
+	if utf8.RuneCountInString(text) <= columns {
+		return text
+	}
+	if columns < 0 {
+		columns = 0
+	}
+	return string([]rune(text)[:columns])
+}
+
+// ReadKeys sends the keys pressed on in, a terminal without line buffering,
+// until it fails. Arrow keys come as up, down, left and right, tab as tab,
+// and control-C as ctrl-c; other keys as themselves.
+func ReadKeys(in io.Reader, keys chan<- string) {
+	buffer := make([]byte, 64)
+	for {
+		n, err := in.Read(buffer)
+		if err != nil {
+			close(keys)
+			return
+		}
+		data := buffer[:n]
+		for len(data) > 0 {
+			switch {
+			case len(data) >= 3 && data[0] == 0x1b && (data[1] == '[' || data[1] == 'O'):
+				if arrow, ok := map[byte]string{'A': "up", 'B': "down", 'C': "right", 'D': "left"}[data[2]]; ok {
+					keys <- arrow
+				}
+				data = data[3:]
+			case data[0] == '\t':
+				keys <- "tab"
+				data = data[1:]
+			case data[0] == 3:
+				keys <- "ctrl-c"
+				data = data[1:]
+			default:
+				r, size := utf8.DecodeRune(data)
+				keys <- string(r)
+				data = data[size:]
+			}
+		}
+	}
+}
@@ -15,25 +15,24 @@ type TerminationTask struct{}
 func (t *TerminationTask) Execute() {}
 
 type NodeTask struct {
-	Node  *utils.QuadNode
-	Root  *utils.QuadNode
-	Theta float64
-	Dt    float64
+	Node   *utils.QuadNode
+	Root   *utils.QuadNode
+	Params *utils.Params
 }
 
 func (nt *NodeTask) Execute() {
 	if nt.Node.BodiesPtr != nil && nt.Node.BodiesPtr.NodeBodies != nil {
-		nt.Node.CalculateForce(nt.Root, nt.Theta, nt.Dt)
+		nt.Node.CalculateForce(nt.Root, nt.Params)
 	}
 }
 
 type BodyTask struct {
-	Body *utils.Body
-	Dt   float64
+	Body   *utils.Body
+	Params *utils.Params
 }
 
 func (bt *BodyTask) Execute() {
-	bt.Body.Update(bt.Dt)
+	bt.Params.Integrator.Step(bt.Body, bt.Params)
 }
 
 type node struct {